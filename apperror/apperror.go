@@ -0,0 +1,100 @@
+// Package apperror defines the errors reported to API clients. Each carries
+// the HTTP status, a stable code clients can rely on and a detail that is
+// safe to show; the underlying cause is only logged.
+package apperror
+
+import (
+	"net/http"
+	"time"
+
+	"go-restful-api/models"
+)
+
+// StatusClientClosedRequest is recorded for requests the client abandoned
+// before the response, after nginx. The client never sees it, it only shows
+// up in logs and metrics.
+const StatusClientClosedRequest = 499
+
+// Error is an error with everything needed to render it as a problem
+type Error struct {
+	Status int
+	Code   string
+	Detail string
+	// Fields lists the invalid fields of a validation error
+	Fields []models.FieldError
+	// RetryAfter is set for errors the client can retry later
+	RetryAfter time.Duration
+	// Err is the cause, never shown to clients
+	Err error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Detail + ": " + e.Err.Error()
+	}
+	return e.Detail
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// New creates an Error with any status
+func New(status int, code, detail string) *Error {
+	return &Error{Status: status, Code: code, Detail: detail}
+}
+
+// BadRequest reports a request that cannot be processed as sent
+func BadRequest(code, detail string) *Error {
+	return New(http.StatusBadRequest, code, detail)
+}
+
+// Validation reports invalid fields of the request body
+func Validation(fields ...models.FieldError) *Error {
+	return &Error{
+		Status: http.StatusBadRequest,
+		Code:   "validation_failed",
+		Detail: "The request has invalid fields",
+		Fields: fields,
+	}
+}
+
+// Unauthorized reports missing or invalid credentials
+func Unauthorized(code, detail string) *Error {
+	return New(http.StatusUnauthorized, code, detail)
+}
+
+// Forbidden reports an authenticated request that is not allowed
+func Forbidden(code, detail string) *Error {
+	return New(http.StatusForbidden, code, detail)
+}
+
+// NotFound reports a missing resource
+func NotFound(code, detail string) *Error {
+	return New(http.StatusNotFound, code, detail)
+}
+
+// Conflict reports a request clashing with the current state, e.g. a duplicate
+func Conflict(code, detail string) *Error {
+	return New(http.StatusConflict, code, detail)
+}
+
+// TooManyRequests reports a throttled client that may retry after retryAfter
+func TooManyRequests(code, detail string, retryAfter time.Duration) *Error {
+	return &Error{Status: http.StatusTooManyRequests, Code: code, Detail: detail, RetryAfter: retryAfter}
+}
+
+// Internal reports a server-side failure. Only detail is shown, err is logged.
+func Internal(detail string, err error) *Error {
+	return &Error{Status: http.StatusInternalServerError, Code: "internal_error", Detail: detail, Err: err}
+}
+
+// Timeout reports a request that ran out of its time budget
+func Timeout(err error) *Error {
+	return &Error{Status: http.StatusGatewayTimeout, Code: "timeout", Detail: "Request timed out", Err: err}
+}
+
+// ClientClosed reports a request whose client went away
+func ClientClosed(err error) *Error {
+	return &Error{Status: StatusClientClosedRequest, Code: "client_closed_request", Detail: "Client closed the request", Err: err}
+}
@@ -0,0 +1,42 @@
+// Package blob stores uploaded files such as avatar images
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"go-restful-api/config"
+)
+
+// ErrNotFound is returned when no blob is stored under a key
+var ErrNotFound = errors.New("blob not found")
+
+// Object is a stored blob opened for reading. The caller closes Body.
+type Object struct {
+	Body        io.ReadCloser
+	ContentType string
+	Size        int64
+}
+
+// Store keeps blobs under slash-separated keys
+type Store interface {
+	Put(ctx context.Context, key, contentType string, data []byte) error
+	// Get returns ErrNotFound when the key holds no blob
+	Get(ctx context.Context, key string) (*Object, error)
+	// Delete removes the blob, it is not an error when there is none
+	Delete(ctx context.Context, key string) error
+}
+
+// New creates the Store selected by the configuration
+func New(cfg config.BlobConfig) (Store, error) {
+	switch cfg.Driver {
+	case config.BlobLocal:
+		return NewFileStore(cfg.Dir)
+	case config.BlobS3:
+		return NewS3Store(cfg.S3)
+	default:
+		return nil, fmt.Errorf("unknown blob driver %q", cfg.Driver)
+	}
+}
@@ -0,0 +1,61 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"go-restful-api/utils"
+)
+
+func runGenKeys(args []string) error {
+	flags := flag.NewFlagSet("gen-keys", flag.ContinueOnError)
+	alg := flags.String("alg", utils.AlgEdDSA, "signing algorithm: RS256, ES256 or EdDSA")
+	out := flags.String("out", "jwt", "path prefix of the generated <out>.key and <out>.pub files")
+	force := flags.Bool("force", false, "overwrite existing key files")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *alg == utils.AlgHS256 {
+		return errors.New("gen-keys: HS256 uses JWT_SECRET and has no key pair")
+	}
+
+	privatePEM, publicPEM, err := utils.GenerateKeyPair(*alg)
+	if err != nil {
+		return err
+	}
+
+	privatePath, publicPath := *out+".key", *out+".pub"
+	mode := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if *force {
+		mode = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	if err := writeFile(privatePath, privatePEM, mode, 0o600); err != nil {
+		return err
+	}
+	if err := writeFile(publicPath, publicPEM, mode, 0o644); err != nil {
+		return err
+	}
+
+	key, err := utils.LoadPrivateKey(privatePath, *alg, "")
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote %s and %s (kid %s)\n\n", privatePath, publicPath, key.ID)
+	fmt.Printf("JWT_ALGORITHM=%s\nJWT_PRIVATE_KEY_FILE=%s\n", *alg, privatePath)
+	return nil
+}
+
+func writeFile(path string, data []byte, flag int, perm os.FileMode) error {
+	f, err := os.OpenFile(path, flag, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
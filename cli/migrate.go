@@ -0,0 +1,34 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"log"
+	"time"
+)
+
+// storageTimeout bounds connecting to the database and running migrations
+const storageTimeout = 30 * time.Second
+
+func runMigrate(args []string) error {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), storageTimeout)
+	defer cancel()
+
+	cfg, store, err := openStore(ctx)
+	if err != nil {
+		return err
+	}
+	defer store.Close(context.Background())
+
+	if err := store.Migrate(ctx); err != nil {
+		return err
+	}
+
+	log.Printf("Storage %q is up to date", cfg.Storage.Driver)
+	return nil
+}
@@ -0,0 +1,257 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go-restful-api/apperror"
+	"go-restful-api/blob"
+	"go-restful-api/config"
+	"go-restful-api/controllers"
+	"go-restful-api/docs"
+	"go-restful-api/logging"
+	"go-restful-api/mail"
+	"go-restful-api/metrics"
+	"go-restful-api/middleware"
+	"go-restful-api/repository"
+	"go-restful-api/routes"
+	"go-restful-api/services"
+	"go-restful-api/tracing"
+	"go-restful-api/validation"
+
+	swaggerFiles "github.com/swaggo/files"
+	ginSwagger "github.com/swaggo/gin-swagger"
+)
+
+func runServe(args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	// Open the configured storage backend
+	ctx, cancel := context.WithTimeout(context.Background(), storageTimeout)
+	cfg, store, err := openStore(ctx)
+	if err != nil {
+		cancel()
+		return err
+	}
+	// Runs last, once in-flight requests are done with the database, and
+	// also when migrating fails
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), storageTimeout)
+		defer cancel()
+		if err := store.Close(ctx); err != nil {
+			log.Printf("Failed to close database connections: %v", err)
+			return
+		}
+		log.Println("Closed database connections")
+	}()
+	if cfg.Storage.AutoMigrate {
+		err = store.Migrate(ctx)
+	}
+	cancel()
+	if err != nil {
+		return err
+	}
+
+	if err := validation.Setup(cfg.Password); err != nil {
+		return err
+	}
+
+	tokens, err := newTokenManager(cfg.JWT)
+	if err != nil {
+		return err
+	}
+	sessions := services.NewSessionService(store.Users, store.RefreshTokens, store.Revocations, tokens, cfg.JWT.RefreshTTL)
+
+	mailer, err := mail.New(cfg.Mail)
+	if err != nil {
+		return err
+	}
+	accounts := services.NewAccountService(store.Users, store.AccountTokens, sessions, mailer, cfg.Auth, cfg.Server.PublicURL)
+	guard := services.NewLoginGuard(store.LoginAttempts, cfg.Lockout)
+
+	blobs, err := blob.New(cfg.Blob)
+	if err != nil {
+		return err
+	}
+	avatars := services.NewAvatarService(store.Profiles, blobs, cfg.Server.PublicURL)
+	mfa := services.NewMFAService(store.Users, store.Revocations, tokens, sessions, guard, cfg.Auth)
+
+	if !cfg.IsDevelopment() {
+		gin.SetMode(gin.ReleaseMode)
+	}
+
+	// Everything the server logs, including the standard log package, is JSON on stdout
+	logger := logging.New(cfg.Log, os.Stdout)
+	slog.SetDefault(logger)
+
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		return err
+	}
+	// Flush the spans still buffered when the server stops
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), storageTimeout)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			log.Printf("Failed to flush traces: %v", err)
+		}
+	}()
+
+	// Set up Gin router
+	router := gin.New()
+	router.Use(middleware.RequestID(), middleware.Tracing(), middleware.LoggerMiddleware(logger, cfg.Log), middleware.Metrics(), middleware.Timeout(cfg.RequestTimeout), middleware.Errors(), middleware.Recovery())
+	router.NoRoute(func(c *gin.Context) {
+		c.Error(apperror.NotFound("route_not_found", "No route matches "+c.Request.URL.Path))
+	})
+	// Client IPs key the login lockout, so forwarded headers are only
+	// believed from configured proxies
+	if err := router.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		return err
+	}
+
+	var metricsServer *http.Server
+	if cfg.Metrics.Enabled {
+		if metricsServer, err = serveMetrics(router, cfg.Metrics); err != nil {
+			return err
+		}
+	}
+
+	// Add Swagger UI at /api/v1/swagger/*
+	if u, err := url.Parse(cfg.Server.PublicURL); err == nil {
+		docs.SwaggerInfo.Host = u.Host
+	}
+	swaggerURL := ginSwagger.URL(cfg.Server.PublicURL + "/api/v1/swagger/doc.json")
+	router.GET("/api/v1/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler, swaggerURL))
+
+	auth := middleware.AuthMiddleware(tokens, sessions)
+
+	// Probes for the orchestrator
+	health := controllers.NewHealthController(map[string]controllers.HealthCheck{
+		"database": store.Ping,
+	}, cfg.Server.ReadinessTimeout)
+	routes.RegisterHealthRoutes(router, health)
+
+	// Public keys for services verifying our tokens
+	routes.RegisterWellKnownRoutes(router, controllers.NewJWKSController(tokens))
+
+	global, limits := rateLimits(cfg.RateLimit, store)
+
+	// Group routes under /api/v1
+	api := router.Group("/api/v1", global)
+	{
+		// Register user routes within the /api/v1 group
+		routes.RegisterUserRoutes(api, controllers.NewUserController(store.Users, store.Profiles, avatars, sessions, accounts, mfa, guard), auth, limits)
+		routes.RegiterProfileRoutes(api, controllers.NewProfileController(store.Profiles, avatars, cfg.Avatar), auth, limits)
+		routes.RegisterAuthRoutes(api, controllers.NewAuthController(sessions, accounts, mfa), auth, limits)
+	}
+
+	server := &http.Server{
+		Addr:         cfg.Addr(),
+		Handler:      router,
+		ReadTimeout:  cfg.Server.ReadTimeout,
+		WriteTimeout: cfg.Server.WriteTimeout,
+		IdleTimeout:  cfg.Server.IdleTimeout,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Start the server
+	serveErr := make(chan error, 1)
+	go func() {
+		log.Printf("Listening on %s", cfg.Addr())
+		serveErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+	// A second signal kills the process without waiting
+	stop()
+
+	log.Println("Shutting down")
+	health.Drain()
+	// Give load balancers time to see /readyz fail before refusing connections
+	time.Sleep(cfg.Server.ShutdownDelay)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	if metricsServer != nil {
+		defer metricsServer.Shutdown(shutdownCtx)
+	}
+	// Shutdown stops accepting connections and waits for in-flight requests
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		server.Close()
+		return fmt.Errorf("requests still running after %s were cut off: %w", cfg.Server.ShutdownTimeout, err)
+	}
+	log.Println("Drained all requests")
+	// Emails queued by the last requests still need the database
+	if err := accounts.Wait(shutdownCtx); err != nil {
+		log.Printf("Emails still being sent after %s were cut off: %v", cfg.Server.ShutdownTimeout, err)
+	}
+	return nil
+}
+
+// serveMetrics exposes GET /metrics on the API router, or on its own
+// listener when an admin address is configured so it can stay off the
+// public network. It returns the separate server, nil without one.
+func serveMetrics(router *gin.Engine, cfg config.MetricsConfig) (*http.Server, error) {
+	handler := metrics.Handler(cfg.Token)
+	if cfg.Addr == "" {
+		router.GET("/metrics", gin.WrapH(handler))
+		return nil, nil
+	}
+
+	// Listen right away so a taken port stops the server from starting
+	listener, err := net.Listen("tcp", cfg.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for metrics: %w", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", handler)
+	server := &http.Server{Handler: mux, ReadTimeout: 10 * time.Second, WriteTimeout: 30 * time.Second}
+	go func() {
+		log.Printf("Serving metrics on %s", cfg.Addr)
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("Metrics server stopped: %v", err)
+		}
+	}()
+	return server, nil
+}
+
+// rateLimits builds the global and per-group throttling middleware. When
+// rate limiting is disabled they only pass requests on.
+func rateLimits(cfg config.RateLimitConfig, store *repository.Store) (gin.HandlerFunc, routes.RateLimits) {
+	if !cfg.Enabled {
+		next := func(c *gin.Context) { c.Next() }
+		return next, routes.RateLimits{Auth: next, Register: next, ProfileRead: next}
+	}
+
+	buckets := repository.RateLimitRepository(repository.NewMemoryRateLimitRepository())
+	if cfg.Store == config.RateLimitStoreStorage {
+		buckets = store.RateLimits
+	}
+
+	return middleware.RateLimit("global", cfg.Global, buckets), routes.RateLimits{
+		Auth:        middleware.RateLimit("auth", cfg.Auth, buckets),
+		Register:    middleware.RateLimit("register", cfg.Register, buckets),
+		ProfileRead: middleware.RateLimit("profile_read", cfg.ProfileRead, buckets),
+	}
+}
@@ -0,0 +1,272 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"go-restful-api/config"
+	"go-restful-api/models"
+	"go-restful-api/repository"
+	"go-restful-api/services"
+	"go-restful-api/utils"
+	"go-restful-api/validation"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func runCreateAdmin(args []string) error {
+	flags := flag.NewFlagSet("create-admin", flag.ContinueOnError)
+	name := flags.String("name", "Administrator", "display name of a new admin")
+	email := flags.String("email", "", "email address of the admin (required)")
+	password := flags.String("password", "", "password of a new admin, read from ADMIN_PASSWORD or stdin when empty")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	*email = models.NormalizeEmail(*email)
+	if *email == "" {
+		return errors.New("create-admin: -email is required")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), storageTimeout)
+	defer cancel()
+
+	cfg, store, err := openStore(ctx)
+	if err != nil {
+		return err
+	}
+	defer store.Close(context.Background())
+	if err := validation.Setup(cfg.Password); err != nil {
+		return err
+	}
+
+	// Promote an existing account instead of failing
+	user, err := store.Users.FindByEmail(ctx, *email)
+	if err == nil {
+		if hasRole(user.Roles, models.RoleAdmin) {
+			log.Printf("%s is already an admin", user.Email)
+			return nil
+		}
+		user.Roles = append(user.Roles, models.RoleAdmin)
+		if err := store.Users.Update(ctx, user); err != nil {
+			return err
+		}
+		// Access tokens carry the roles, so the ones issued before must go
+		if err := logoutAll(ctx, cfg, store, user.ID); err != nil {
+			return err
+		}
+		log.Printf("Promoted %s (%s) to admin and ended all sessions", user.Email, user.ID.Hex())
+		return nil
+	}
+	if !errors.Is(err, repository.ErrNotFound) {
+		return err
+	}
+
+	plain, err := readPassword(*password, "ADMIN_PASSWORD")
+	if err != nil {
+		return err
+	}
+	if err := validation.CheckPassword(plain, *email); err != nil {
+		return fmt.Errorf("create-admin: %w", err)
+	}
+	*name = models.NormalizeName(*name)
+	if len([]rune(*name)) > 100 || !validation.IsPersonName(*name) {
+		return fmt.Errorf("create-admin: name %s", validation.Message(validation.RulePersonName))
+	}
+	hashed, err := utils.HashPassword(plain)
+	if err != nil {
+		return err
+	}
+
+	user = &models.User{
+		ID:       primitive.NewObjectID(),
+		Name:     *name,
+		Email:    *email,
+		Password: hashed,
+		Roles:    []string{models.RoleAdmin, models.RoleUser},
+		// The operator vouches for the address
+		EmailVerified: true,
+	}
+	if err := store.Users.Insert(ctx, user); err != nil {
+		return err
+	}
+
+	log.Printf("Created admin %s (%s)", user.Email, user.ID.Hex())
+	return nil
+}
+
+func runResetPassword(args []string) error {
+	flags := flag.NewFlagSet("reset-password", flag.ContinueOnError)
+	email := flags.String("email", "", "email address of the user (required)")
+	password := flags.String("password", "", "new password, read from NEW_PASSWORD or stdin when empty")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	*email = models.NormalizeEmail(*email)
+	if *email == "" {
+		return errors.New("reset-password: -email is required")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), storageTimeout)
+	defer cancel()
+
+	cfg, store, err := openStore(ctx)
+	if err != nil {
+		return err
+	}
+	defer store.Close(context.Background())
+	if err := validation.Setup(cfg.Password); err != nil {
+		return err
+	}
+
+	user, err := store.Users.FindByEmail(ctx, *email)
+	if errors.Is(err, repository.ErrNotFound) {
+		return fmt.Errorf("no user with email %s", *email)
+	}
+	if err != nil {
+		return err
+	}
+
+	plain, err := readPassword(*password, "NEW_PASSWORD")
+	if err != nil {
+		return err
+	}
+	if err := validation.CheckPassword(plain, user.Email); err != nil {
+		return fmt.Errorf("reset-password: %w", err)
+	}
+	user.Password, err = utils.HashPassword(plain)
+	if err != nil {
+		return err
+	}
+	if err := store.Users.Update(ctx, user); err != nil {
+		return err
+	}
+
+	// Sessions opened with the old password must not outlive it
+	if err := logoutAll(ctx, cfg, store, user.ID); err != nil {
+		return err
+	}
+
+	log.Printf("Reset password of %s and ended all sessions", user.Email)
+	return nil
+}
+
+func runDisableMFA(args []string) error {
+	flags := flag.NewFlagSet("disable-mfa", flag.ContinueOnError)
+	email := flags.String("email", "", "email address of the user (required)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	*email = models.NormalizeEmail(*email)
+	if *email == "" {
+		return errors.New("disable-mfa: -email is required")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), storageTimeout)
+	defer cancel()
+
+	_, store, err := openStore(ctx)
+	if err != nil {
+		return err
+	}
+	defer store.Close(context.Background())
+
+	user, err := store.Users.FindByEmail(ctx, *email)
+	if errors.Is(err, repository.ErrNotFound) {
+		return fmt.Errorf("no user with email %s", *email)
+	}
+	if err != nil {
+		return err
+	}
+	if !user.MFAEnabled && user.TOTPSecret == "" {
+		log.Printf("Two-factor authentication is not enabled for %s", user.Email)
+		return nil
+	}
+
+	user.MFAEnabled = false
+	user.TOTPSecret = ""
+	user.TOTPLastStep = 0
+	user.RecoveryCodes = nil
+	if err := store.Users.Update(ctx, user); err != nil {
+		return err
+	}
+
+	log.Printf("Disabled two-factor authentication for %s", user.Email)
+	return nil
+}
+
+func runListUsers(args []string) error {
+	flags := flag.NewFlagSet("list-users", flag.ContinueOnError)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), storageTimeout)
+	defer cancel()
+
+	_, store, err := openStore(ctx)
+	if err != nil {
+		return err
+	}
+	defer store.Close(context.Background())
+
+	users, _, err := store.Users.List(ctx, repository.UserListOptions{})
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tEMAIL\tNAME\tROLES\tCREATED")
+	for _, user := range users {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", user.ID.Hex(), user.Email, user.Name,
+			strings.Join(user.Roles, ","), user.CreatedAt.Format(time.RFC3339))
+	}
+	return w.Flush()
+}
+
+// logoutAll revokes every access and refresh token of the user
+func logoutAll(ctx context.Context, cfg *config.Config, store *repository.Store, userID primitive.ObjectID) error {
+	tokens, err := newTokenManager(cfg.JWT)
+	if err != nil {
+		return err
+	}
+	sessions := services.NewSessionService(store.Users, store.RefreshTokens, store.Revocations, tokens, cfg.JWT.RefreshTTL)
+	return sessions.LogoutAll(ctx, userID)
+}
+
+// readPassword returns the flag value, the environment variable or the first
+// line of stdin, in that order, so passwords need not appear in shell history
+func readPassword(flagValue, envVar string) (string, error) {
+	if flagValue != "" {
+		return flagValue, nil
+	}
+	if value := os.Getenv(envVar); value != "" {
+		return value, nil
+	}
+
+	fmt.Fprint(os.Stderr, "Password: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("failed to read password: %w", err)
+	}
+	password := strings.TrimRight(line, "\r\n")
+	if password == "" {
+		return "", errors.New("password must not be empty")
+	}
+	return password, nil
+}
+
+func hasRole(roles []string, role string) bool {
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,50 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go-restful-api/config"
+	"go-restful-api/models"
+	"go-restful-api/repository"
+	"go-restful-api/services"
+	"go-restful-api/utils"
+)
+
+func TestLogoutAll(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{JWT: config.JWTConfig{Algorithm: utils.AlgHS256, Secret: "test-secret", TTL: time.Minute, RefreshTTL: time.Hour}}
+	store := repository.NewMemoryStore()
+	user := &models.User{Name: "Ann", Email: "ann@example.com", Roles: []string{models.RoleUser}}
+	if err := store.Users.Insert(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+
+	tokens, err := newTokenManager(cfg.JWT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessions := services.NewSessionService(store.Users, store.RefreshTokens, store.Revocations, tokens, cfg.JWT.RefreshTTL)
+	pair, err := sessions.Start(ctx, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := logoutAll(ctx, cfg, store, user.ID); err != nil {
+		t.Fatalf("logoutAll() error = %v", err)
+	}
+
+	// The access token still carrying the old roles is revoked
+	claims, err := tokens.ValidateToken(pair.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revoked, err := sessions.IsRevoked(ctx, claims); err != nil || !revoked {
+		t.Errorf("IsRevoked() = %v, %v, want true", revoked, err)
+	}
+	if _, err := sessions.Refresh(ctx, pair.RefreshToken); !errors.Is(err, services.ErrInvalidRefreshToken) {
+		t.Errorf("Refresh() error = %v, want ErrInvalidRefreshToken", err)
+	}
+}
@@ -0,0 +1,980 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultJWTSecret is the placeholder secret used in development. The server
+// refuses to start with it outside development mode.
+const DefaultJWTSecret = "your_secret_key"
+
+const (
+	EnvDevelopment = "development"
+	EnvProduction  = "production"
+)
+
+// Supported storage drivers
+const (
+	StorageMongo    = "mongo"
+	StorageMemory   = "memory"
+	StorageSQLite   = "sqlite"
+	StoragePostgres = "postgres"
+)
+
+// Rate limiting algorithms, stores and keys
+const (
+	RateLimitTokenBucket   = "token_bucket"
+	RateLimitSlidingWindow = "sliding_window"
+
+	RateLimitStoreMemory  = "memory"
+	RateLimitStoreStorage = "storage"
+
+	RateLimitKeyIP   = "ip"
+	RateLimitKeyUser = "user"
+)
+
+// Supported blob stores
+const (
+	BlobLocal = "local"
+	BlobS3    = "s3"
+)
+
+// Supported trace exporters
+const (
+	TracingNone   = "none"
+	TracingStdout = "stdout"
+	TracingOTLP   = "otlp"
+)
+
+// Supported mail drivers
+const (
+	MailLog  = "log"
+	MailFile = "file"
+	MailSMTP = "smtp"
+)
+
+// MaxPasswordBytes is the longest password bcrypt can hash
+const MaxPasswordBytes = 72
+
+// DefaultSQLiteDSN is the database file used by the sqlite driver when no DSN is set
+const DefaultSQLiteDSN = "go_restful_api.db"
+
+// Config holds all runtime settings of the API
+type Config struct {
+	Env            string               `yaml:"env"`
+	Log            LogConfig            `yaml:"log"`
+	Server         ServerConfig         `yaml:"server"`
+	Storage        StorageConfig        `yaml:"storage"`
+	Mongo          MongoConfig          `yaml:"mongo"`
+	SQL            SQLConfig            `yaml:"sql"`
+	JWT            JWTConfig            `yaml:"jwt"`
+	Auth           AuthConfig           `yaml:"auth"`
+	Password       PasswordConfig       `yaml:"password"`
+	Lockout        LockoutConfig        `yaml:"lockout"`
+	RateLimit      RateLimitConfig      `yaml:"rate_limit"`
+	Mail           MailConfig           `yaml:"mail"`
+	Blob           BlobConfig           `yaml:"blob"`
+	Avatar         AvatarConfig         `yaml:"avatar"`
+	Tracing        TracingConfig        `yaml:"tracing"`
+	Metrics        MetricsConfig        `yaml:"metrics"`
+	RequestTimeout RequestTimeoutConfig `yaml:"request_timeout"`
+}
+
+// LogConfig controls the structured request log
+type LogConfig struct {
+	// Level is debug, info, warn or error. At debug, request headers and
+	// JSON bodies are logged as well.
+	Level string `yaml:"level"`
+	// SampleRate is the share of successful requests that are logged, from
+	// 0 to 1. Requests answered with 4xx or 5xx are always logged.
+	SampleRate float64 `yaml:"sample_rate"`
+	// RedactFields are extra header, query and body field names whose values
+	// are never logged, on top of Authorization, passwords and tokens
+	RedactFields []string `yaml:"redact_fields"`
+}
+
+// ServerConfig holds the HTTP listener settings
+type ServerConfig struct {
+	Host string `yaml:"host"`
+	Port int    `yaml:"port"`
+	// PublicURL is the externally reachable base URL, used for Swagger and links
+	PublicURL string `yaml:"public_url"`
+	// TrustedProxies are the addresses or CIDRs of reverse proxies whose
+	// X-Forwarded-For header is believed. Without them the peer address is the client IP.
+	TrustedProxies []string `yaml:"trusted_proxies"`
+	// ReadinessTimeout bounds each dependency check of /readyz
+	ReadinessTimeout time.Duration `yaml:"readiness_timeout"`
+	// ReadTimeout, WriteTimeout and IdleTimeout bound reading a request,
+	// writing its response and keeping an idle connection open
+	ReadTimeout  time.Duration `yaml:"read_timeout"`
+	WriteTimeout time.Duration `yaml:"write_timeout"`
+	IdleTimeout  time.Duration `yaml:"idle_timeout"`
+	// ShutdownDelay is how long the server keeps serving with /readyz
+	// failing after SIGTERM, so load balancers stop routing to it first
+	ShutdownDelay time.Duration `yaml:"shutdown_delay"`
+	// ShutdownTimeout is how long in-flight requests get to finish
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+}
+
+// RequestTimeoutConfig sets how long handlers may work on a request before
+// it is answered with 504
+type RequestTimeoutConfig struct {
+	// Default applies to routes without an entry in Routes
+	Default time.Duration `yaml:"default"`
+	// Routes maps "<METHOD> <route template>" to its budget, e.g.
+	// "POST /api/v1/users/login": 5s
+	Routes map[string]time.Duration `yaml:"routes"`
+}
+
+// For returns the budget of the route
+func (c RequestTimeoutConfig) For(method, route string) time.Duration {
+	if d, ok := c.Routes[method+" "+route]; ok {
+		return d
+	}
+	return c.Default
+}
+
+// StorageConfig selects the persistence backend
+type StorageConfig struct {
+	Driver string `yaml:"driver"`
+	// AutoMigrate applies schema migrations and indexes when the server starts
+	AutoMigrate bool `yaml:"auto_migrate"`
+}
+
+// MongoConfig holds the MongoDB connection settings
+type MongoConfig struct {
+	URI            string        `yaml:"uri"`
+	Database       string        `yaml:"database"`
+	ConnectTimeout time.Duration `yaml:"connect_timeout"`
+}
+
+// SQLConfig holds the SQLite or Postgres connection settings
+type SQLConfig struct {
+	DSN          string `yaml:"dsn"`
+	MaxOpenConns int    `yaml:"max_open_conns"`
+}
+
+// JWTConfig holds the token signing settings
+type JWTConfig struct {
+	// Algorithm is HS256 (shared Secret) or RS256, ES256 or EdDSA (PrivateKeyFile)
+	Algorithm string `yaml:"algorithm"`
+	Secret    string `yaml:"secret"`
+	// PrivateKeyFile is the PEM key that signs new tokens
+	PrivateKeyFile string `yaml:"private_key_file"`
+	// KeyID is the kid of the signing key, defaults to its RFC 7638 thumbprint
+	KeyID string `yaml:"key_id"`
+	// PublicKeyFiles are PEM keys still accepted for verification, e.g. the
+	// previous signing key during a rotation. Keys that signed with a custom
+	// kid are given as kid=path.
+	PublicKeyFiles []string `yaml:"public_key_files"`
+	// TTL is the lifetime of access tokens
+	TTL time.Duration `yaml:"ttl"`
+	// RefreshTTL is the lifetime of refresh tokens
+	RefreshTTL time.Duration `yaml:"refresh_ttl"`
+}
+
+// AuthConfig holds the settings of the account workflows
+type AuthConfig struct {
+	// RequireVerifiedEmail rejects logins until the user verified their email
+	RequireVerifiedEmail bool `yaml:"require_verified_email"`
+	// VerificationTTL is the lifetime of email verification tokens
+	VerificationTTL time.Duration `yaml:"verification_ttl"`
+	// PasswordResetTTL is the lifetime of password reset tokens
+	PasswordResetTTL time.Duration `yaml:"password_reset_ttl"`
+	// MFAIssuer names the service in authenticator apps
+	MFAIssuer string `yaml:"mfa_issuer"`
+	// MFAChallengeTTL is how long a user has to enter the second factor after the password
+	MFAChallengeTTL time.Duration `yaml:"mfa_challenge_ttl"`
+}
+
+// PasswordConfig is the policy new passwords have to meet
+type PasswordConfig struct {
+	// MinLength is counted in characters
+	MinLength int `yaml:"min_length"`
+	// MaxLength is counted in bytes; bcrypt ignores everything after 72
+	MaxLength int `yaml:"max_length"`
+	// BreachedList is a file of known breached passwords, one per line,
+	// that are rejected. Empty disables the check.
+	BreachedList string `yaml:"breached_list"`
+}
+
+// LockoutConfig controls the brute-force protection of the login. Failed
+// attempts are counted per account and per client IP; once a counter reaches
+// its threshold the key is locked, for BaseDuration at first and twice as
+// long for every further failure, up to MaxDuration.
+type LockoutConfig struct {
+	Enabled          bool `yaml:"enabled"`
+	AccountThreshold int  `yaml:"account_threshold"`
+	IPThreshold      int  `yaml:"ip_threshold"`
+	// Window is how long failures are remembered after the last failure or lockout
+	Window       time.Duration `yaml:"window"`
+	BaseDuration time.Duration `yaml:"base_duration"`
+	MaxDuration  time.Duration `yaml:"max_duration"`
+}
+
+// RateLimitConfig holds the throttling policies of the route groups
+type RateLimitConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Store is memory (per process) or storage (the storage backend, shared by replicas)
+	Store string `yaml:"store"`
+	// Global applies to every API request
+	Global RateLimitPolicy `yaml:"global"`
+	// Auth applies to login, the second factor and the mailed token endpoints
+	Auth RateLimitPolicy `yaml:"auth"`
+	// Register applies to account registration
+	Register RateLimitPolicy `yaml:"register"`
+	// ProfileRead applies to reading profiles
+	ProfileRead RateLimitPolicy `yaml:"profile_read"`
+}
+
+// RateLimitPolicy allows Limit requests per Period for each key
+type RateLimitPolicy struct {
+	// Algorithm is token_bucket (bursts of up to Limit, refilled evenly) or sliding_window
+	Algorithm string        `yaml:"algorithm"`
+	Limit     int           `yaml:"limit"`
+	Period    time.Duration `yaml:"period"`
+	// Key is ip or user; user falls back to the IP for anonymous requests
+	Key string `yaml:"key"`
+}
+
+// Policies returns the policies by name, for validation and logging
+func (c RateLimitConfig) Policies() map[string]RateLimitPolicy {
+	return map[string]RateLimitPolicy{
+		"global":       c.Global,
+		"auth":         c.Auth,
+		"register":     c.Register,
+		"profile_read": c.ProfileRead,
+	}
+}
+
+// MailConfig selects how outgoing email is delivered
+type MailConfig struct {
+	// Driver is log (print messages, development only), file (write .eml
+	// files to Dir) or smtp
+	Driver string     `yaml:"driver"`
+	From   string     `yaml:"from"`
+	Dir    string     `yaml:"dir"`
+	SMTP   SMTPConfig `yaml:"smtp"`
+}
+
+// BlobConfig selects where uploaded files such as avatars are kept
+type BlobConfig struct {
+	// Driver is local (files under Dir) or s3 (an S3-compatible bucket)
+	Driver string   `yaml:"driver"`
+	Dir    string   `yaml:"dir"`
+	S3     S3Config `yaml:"s3"`
+}
+
+// S3Config addresses a bucket on AWS S3 or a compatible service such as MinIO
+type S3Config struct {
+	// Endpoint is the service URL, e.g. http://localhost:9000 for MinIO.
+	// Empty means AWS S3 in Region.
+	Endpoint        string `yaml:"endpoint"`
+	Region          string `yaml:"region"`
+	Bucket          string `yaml:"bucket"`
+	AccessKeyID     string `yaml:"access_key_id"`
+	SecretAccessKey string `yaml:"secret_access_key"`
+	// PathStyle puts the bucket in the URL path instead of the host name, as MinIO expects
+	PathStyle bool `yaml:"path_style"`
+}
+
+// AvatarConfig limits avatar uploads and sets how long clients cache them
+type AvatarConfig struct {
+	// MaxUploadSize is the largest accepted image file in bytes
+	MaxUploadSize int `yaml:"max_upload_size"`
+	// CacheMaxAge is the max-age of served avatars
+	CacheMaxAge time.Duration `yaml:"cache_max_age"`
+}
+
+// TracingConfig controls OpenTelemetry tracing. Trace context is propagated
+// with W3C traceparent headers even when no exporter is configured.
+type TracingConfig struct {
+	// Exporter is none, stdout (JSON spans on stdout) or otlp (OTLP over HTTP)
+	Exporter    string `yaml:"exporter"`
+	ServiceName string `yaml:"service_name"`
+	// OTLPEndpoint is the collector URL, e.g. http://localhost:4318
+	OTLPEndpoint string `yaml:"otlp_endpoint"`
+	// SampleRatio is the share of new traces that are recorded, from 0 to 1.
+	// Requests continuing a trace follow the sampling decision of the caller.
+	SampleRatio float64 `yaml:"sample_ratio"`
+}
+
+// MetricsConfig controls the Prometheus metrics endpoint
+type MetricsConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Addr is a separate listen address for /metrics, e.g. 127.0.0.1:9090.
+	// When empty the metrics are served by the API listener.
+	Addr string `yaml:"addr"`
+	// Token is a bearer token scrapers have to send; empty leaves /metrics open
+	Token string `yaml:"token"`
+}
+
+// SMTPConfig holds the SMTP relay settings. STARTTLS is used when the server offers it.
+type SMTPConfig struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// Default returns the configuration used when nothing else is provided
+func Default() *Config {
+	return &Config{
+		Env: EnvDevelopment,
+		Log: LogConfig{
+			Level:      "info",
+			SampleRate: 1,
+		},
+		Server: ServerConfig{
+			Port:             8080,
+			ReadinessTimeout: 2 * time.Second,
+			ReadTimeout:      15 * time.Second,
+			WriteTimeout:     30 * time.Second,
+			IdleTimeout:      2 * time.Minute,
+			ShutdownTimeout:  20 * time.Second,
+		},
+		Storage: StorageConfig{
+			Driver:      StorageMongo,
+			AutoMigrate: true,
+		},
+		Mongo: MongoConfig{
+			URI:            "mongodb://localhost:27017",
+			Database:       "go_restful_api",
+			ConnectTimeout: 10 * time.Second,
+		},
+		JWT: JWTConfig{
+			Algorithm:  "HS256",
+			Secret:     DefaultJWTSecret,
+			TTL:        15 * time.Minute,
+			RefreshTTL: 30 * 24 * time.Hour,
+		},
+		Auth: AuthConfig{
+			VerificationTTL:  24 * time.Hour,
+			PasswordResetTTL: time.Hour,
+			MFAIssuer:        "Go RESTful API",
+			MFAChallengeTTL:  5 * time.Minute,
+		},
+		Password: PasswordConfig{
+			MinLength: 8,
+			MaxLength: MaxPasswordBytes,
+		},
+		Lockout: LockoutConfig{
+			Enabled:          true,
+			AccountThreshold: 5,
+			IPThreshold:      20,
+			Window:           15 * time.Minute,
+			BaseDuration:     time.Minute,
+			MaxDuration:      time.Hour,
+		},
+		RateLimit: RateLimitConfig{
+			Enabled:     true,
+			Store:       RateLimitStoreMemory,
+			Global:      RateLimitPolicy{Algorithm: RateLimitTokenBucket, Limit: 600, Period: time.Minute, Key: RateLimitKeyIP},
+			Auth:        RateLimitPolicy{Algorithm: RateLimitSlidingWindow, Limit: 10, Period: time.Minute, Key: RateLimitKeyIP},
+			Register:    RateLimitPolicy{Algorithm: RateLimitSlidingWindow, Limit: 5, Period: time.Hour, Key: RateLimitKeyIP},
+			ProfileRead: RateLimitPolicy{Algorithm: RateLimitTokenBucket, Limit: 300, Period: time.Minute, Key: RateLimitKeyUser},
+		},
+		Mail: MailConfig{
+			Driver: MailLog,
+			From:   "no-reply@localhost",
+			Dir:    "mailbox",
+			SMTP: SMTPConfig{
+				Port: 587,
+			},
+		},
+		Blob: BlobConfig{
+			Driver: BlobLocal,
+			Dir:    "uploads",
+			S3: S3Config{
+				Region:    "us-east-1",
+				PathStyle: true,
+			},
+		},
+		Avatar: AvatarConfig{
+			MaxUploadSize: 5 << 20,
+			CacheMaxAge:   time.Hour,
+		},
+		Tracing: TracingConfig{
+			Exporter:     TracingNone,
+			ServiceName:  "go-restful-api",
+			OTLPEndpoint: "http://localhost:4318",
+			SampleRatio:  1,
+		},
+		Metrics: MetricsConfig{
+			Enabled: true,
+		},
+		RequestTimeout: RequestTimeoutConfig{
+			Default: 10 * time.Second,
+		},
+	}
+}
+
+// Load builds the configuration from defaults, an optional config file
+// (CONFIG_FILE, YAML or TOML), an optional .env file and the environment,
+// in increasing order of precedence, and validates the result.
+func Load() (*Config, error) {
+	// Variables already present in the environment win over the .env file
+	if err := godotenv.Load(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to load .env file: %w", err)
+	}
+
+	cfg := Default()
+
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := cfg.loadEnv(); err != nil {
+		return nil, err
+	}
+
+	if cfg.Server.PublicURL == "" {
+		host := cfg.Server.Host
+		if host == "" || host == "0.0.0.0" {
+			host = "localhost"
+		}
+		cfg.Server.PublicURL = "http://" + net.JoinHostPort(host, strconv.Itoa(cfg.Server.Port))
+	}
+	cfg.Server.PublicURL = strings.TrimRight(cfg.Server.PublicURL, "/")
+
+	if cfg.Storage.Driver == StorageSQLite && cfg.SQL.DSN == "" {
+		cfg.SQL.DSN = DefaultSQLiteDSN
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// loadFile merges a YAML or TOML file into the configuration
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+	case ".toml":
+		// TOML is normalised through the YAML decoder so both formats share
+		// the same field names and duration parsing ("30s", "24h")
+		var raw map[string]any
+		if err := toml.Unmarshal(data, &raw); err != nil {
+			return fmt.Errorf("failed to parse config file %s: %w", path, err)
+		}
+		if data, err = yaml.Marshal(raw); err != nil {
+			return fmt.Errorf("failed to parse config file %s: %w", path, err)
+		}
+	default:
+		return fmt.Errorf("unsupported config file format %q", filepath.Ext(path))
+	}
+
+	if err := yaml.Unmarshal(data, c); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// loadEnv overrides the configuration with environment variables
+func (c *Config) loadEnv() error {
+	setString(&c.Env, "APP_ENV")
+	setString(&c.Log.Level, "LOG_LEVEL")
+	setStringList(&c.Log.RedactFields, "LOG_REDACT_FIELDS")
+	setString(&c.Server.Host, "HOST")
+	setString(&c.Server.PublicURL, "PUBLIC_URL")
+	setStringList(&c.Server.TrustedProxies, "TRUSTED_PROXIES")
+	setString(&c.Storage.Driver, "STORAGE")
+	setString(&c.Mongo.URI, "MONGO_URI")
+	setString(&c.Mongo.Database, "MONGO_DATABASE")
+	setString(&c.SQL.DSN, "SQL_DSN")
+	setString(&c.JWT.Algorithm, "JWT_ALGORITHM")
+	setString(&c.JWT.Secret, "JWT_SECRET")
+	setString(&c.JWT.PrivateKeyFile, "JWT_PRIVATE_KEY_FILE")
+	setString(&c.JWT.KeyID, "JWT_KEY_ID")
+	setStringList(&c.JWT.PublicKeyFiles, "JWT_PUBLIC_KEY_FILES")
+	setString(&c.Auth.MFAIssuer, "AUTH_MFA_ISSUER")
+	setString(&c.Password.BreachedList, "PASSWORD_BREACHED_LIST")
+	setString(&c.RateLimit.Store, "RATE_LIMIT_STORE")
+	setString(&c.Mail.Driver, "MAIL_DRIVER")
+	setString(&c.Mail.From, "MAIL_FROM")
+	setString(&c.Mail.Dir, "MAIL_DIR")
+	setString(&c.Mail.SMTP.Host, "SMTP_HOST")
+	setString(&c.Mail.SMTP.Username, "SMTP_USERNAME")
+	setString(&c.Mail.SMTP.Password, "SMTP_PASSWORD")
+	setString(&c.Blob.Driver, "BLOB_DRIVER")
+	setString(&c.Blob.Dir, "BLOB_DIR")
+	setString(&c.Blob.S3.Endpoint, "S3_ENDPOINT")
+	setString(&c.Blob.S3.Region, "S3_REGION")
+	setString(&c.Blob.S3.Bucket, "S3_BUCKET")
+	setString(&c.Blob.S3.AccessKeyID, "S3_ACCESS_KEY_ID")
+	setString(&c.Blob.S3.SecretAccessKey, "S3_SECRET_ACCESS_KEY")
+	setString(&c.Tracing.Exporter, "TRACING_EXPORTER")
+	setString(&c.Tracing.ServiceName, "OTEL_SERVICE_NAME")
+	setString(&c.Tracing.OTLPEndpoint, "OTEL_EXPORTER_OTLP_ENDPOINT")
+	setString(&c.Metrics.Addr, "METRICS_ADDR")
+	setString(&c.Metrics.Token, "METRICS_TOKEN")
+
+	if err := setFloat(&c.Log.SampleRate, "LOG_SAMPLE_RATE"); err != nil {
+		return err
+	}
+	if err := setBool(&c.Storage.AutoMigrate, "STORAGE_AUTO_MIGRATE"); err != nil {
+		return err
+	}
+	if err := setInt(&c.Server.Port, "PORT"); err != nil {
+		return err
+	}
+	if err := setInt(&c.SQL.MaxOpenConns, "SQL_MAX_OPEN_CONNS"); err != nil {
+		return err
+	}
+	if err := setDuration(&c.Server.ReadinessTimeout, "READINESS_TIMEOUT"); err != nil {
+		return err
+	}
+	if err := setDuration(&c.RequestTimeout.Default, "REQUEST_TIMEOUT"); err != nil {
+		return err
+	}
+	if err := setDurationMap(&c.RequestTimeout.Routes, "REQUEST_TIMEOUT_ROUTES"); err != nil {
+		return err
+	}
+	if err := setDuration(&c.Server.ReadTimeout, "SERVER_READ_TIMEOUT"); err != nil {
+		return err
+	}
+	if err := setDuration(&c.Server.WriteTimeout, "SERVER_WRITE_TIMEOUT"); err != nil {
+		return err
+	}
+	if err := setDuration(&c.Server.IdleTimeout, "SERVER_IDLE_TIMEOUT"); err != nil {
+		return err
+	}
+	if err := setDuration(&c.Server.ShutdownDelay, "SHUTDOWN_DELAY"); err != nil {
+		return err
+	}
+	if err := setDuration(&c.Server.ShutdownTimeout, "SHUTDOWN_TIMEOUT"); err != nil {
+		return err
+	}
+	if err := setDuration(&c.Mongo.ConnectTimeout, "MONGO_CONNECT_TIMEOUT"); err != nil {
+		return err
+	}
+	if err := setDuration(&c.JWT.TTL, "JWT_TTL"); err != nil {
+		return err
+	}
+	if err := setDuration(&c.JWT.RefreshTTL, "JWT_REFRESH_TTL"); err != nil {
+		return err
+	}
+	if err := setBool(&c.Auth.RequireVerifiedEmail, "AUTH_REQUIRE_VERIFIED_EMAIL"); err != nil {
+		return err
+	}
+	if err := setDuration(&c.Auth.VerificationTTL, "AUTH_VERIFICATION_TTL"); err != nil {
+		return err
+	}
+	if err := setDuration(&c.Auth.PasswordResetTTL, "AUTH_PASSWORD_RESET_TTL"); err != nil {
+		return err
+	}
+	if err := setDuration(&c.Auth.MFAChallengeTTL, "AUTH_MFA_CHALLENGE_TTL"); err != nil {
+		return err
+	}
+	if err := setInt(&c.Password.MinLength, "PASSWORD_MIN_LENGTH"); err != nil {
+		return err
+	}
+	if err := setInt(&c.Password.MaxLength, "PASSWORD_MAX_LENGTH"); err != nil {
+		return err
+	}
+	if err := setBool(&c.Lockout.Enabled, "LOCKOUT_ENABLED"); err != nil {
+		return err
+	}
+	if err := setInt(&c.Lockout.AccountThreshold, "LOCKOUT_ACCOUNT_THRESHOLD"); err != nil {
+		return err
+	}
+	if err := setInt(&c.Lockout.IPThreshold, "LOCKOUT_IP_THRESHOLD"); err != nil {
+		return err
+	}
+	if err := setDuration(&c.Lockout.Window, "LOCKOUT_WINDOW"); err != nil {
+		return err
+	}
+	if err := setDuration(&c.Lockout.BaseDuration, "LOCKOUT_BASE_DURATION"); err != nil {
+		return err
+	}
+	if err := setDuration(&c.Lockout.MaxDuration, "LOCKOUT_MAX_DURATION"); err != nil {
+		return err
+	}
+	if err := setBool(&c.RateLimit.Enabled, "RATE_LIMIT_ENABLED"); err != nil {
+		return err
+	}
+	if err := setRate(&c.RateLimit.Global, "RATE_LIMIT_GLOBAL"); err != nil {
+		return err
+	}
+	if err := setRate(&c.RateLimit.Auth, "RATE_LIMIT_AUTH"); err != nil {
+		return err
+	}
+	if err := setRate(&c.RateLimit.Register, "RATE_LIMIT_REGISTER"); err != nil {
+		return err
+	}
+	if err := setRate(&c.RateLimit.ProfileRead, "RATE_LIMIT_PROFILE_READ"); err != nil {
+		return err
+	}
+	if err := setInt(&c.Mail.SMTP.Port, "SMTP_PORT"); err != nil {
+		return err
+	}
+	if err := setBool(&c.Blob.S3.PathStyle, "S3_PATH_STYLE"); err != nil {
+		return err
+	}
+	if err := setInt(&c.Avatar.MaxUploadSize, "AVATAR_MAX_UPLOAD_SIZE"); err != nil {
+		return err
+	}
+	if err := setDuration(&c.Avatar.CacheMaxAge, "AVATAR_CACHE_MAX_AGE"); err != nil {
+		return err
+	}
+	if err := setFloat(&c.Tracing.SampleRatio, "TRACING_SAMPLE_RATIO"); err != nil {
+		return err
+	}
+	if err := setBool(&c.Metrics.Enabled, "METRICS_ENABLED"); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Validate checks the configuration for values the server cannot run with
+func (c *Config) Validate() error {
+	var errs []error
+
+	if c.Env != EnvDevelopment && c.Env != EnvProduction {
+		errs = append(errs, fmt.Errorf("env must be %q or %q, got %q", EnvDevelopment, EnvProduction, c.Env))
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Log.Level)); err != nil {
+		errs = append(errs, fmt.Errorf("log level must be debug, info, warn or error, got %q", c.Log.Level))
+	}
+	if c.Log.SampleRate < 0 || c.Log.SampleRate > 1 {
+		errs = append(errs, fmt.Errorf("log sample rate must be between 0 and 1, got %v", c.Log.SampleRate))
+	}
+	if c.Server.Port <= 0 || c.Server.Port > 65535 {
+		errs = append(errs, fmt.Errorf("server port %d is out of range", c.Server.Port))
+	}
+	if c.Server.ReadinessTimeout <= 0 {
+		errs = append(errs, errors.New("server readiness timeout must be positive"))
+	}
+	if c.Server.ReadTimeout <= 0 || c.Server.WriteTimeout <= 0 || c.Server.IdleTimeout <= 0 {
+		errs = append(errs, errors.New("server read, write and idle timeouts must be positive"))
+	}
+	if c.Server.ShutdownDelay < 0 || c.Server.ShutdownTimeout <= 0 {
+		errs = append(errs, errors.New("server shutdown delay must not be negative and the shutdown timeout must be positive"))
+	}
+	// A budget past the write timeout would drop the connection instead of answering 504
+	if c.RequestTimeout.Default <= 0 || c.RequestTimeout.Default >= c.Server.WriteTimeout {
+		errs = append(errs, fmt.Errorf("request timeout must be positive and shorter than the server write timeout %s", c.Server.WriteTimeout))
+	}
+	for route, d := range c.RequestTimeout.Routes {
+		if method, path, ok := strings.Cut(route, " "); !ok || method == "" || !strings.HasPrefix(path, "/") {
+			errs = append(errs, fmt.Errorf("request timeout route must look like \"GET /api/v1/users/\", got %q", route))
+		}
+		if d <= 0 || d >= c.Server.WriteTimeout {
+			errs = append(errs, fmt.Errorf("request timeout of %s must be positive and shorter than the server write timeout %s", route, c.Server.WriteTimeout))
+		}
+	}
+	switch c.Storage.Driver {
+	case StorageMemory:
+	case StorageMongo:
+		if c.Mongo.URI == "" {
+			errs = append(errs, errors.New("mongo uri is required"))
+		}
+		if c.Mongo.Database == "" {
+			errs = append(errs, errors.New("mongo database is required"))
+		}
+	case StorageSQLite, StoragePostgres:
+		if c.SQL.DSN == "" {
+			errs = append(errs, errors.New("sql dsn is required"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("storage driver must be one of %q, %q, %q or %q, got %q",
+			StorageMongo, StorageMemory, StorageSQLite, StoragePostgres, c.Storage.Driver))
+	}
+	switch c.JWT.Algorithm {
+	case "HS256":
+		if c.JWT.Secret == "" {
+			errs = append(errs, errors.New("jwt secret is required"))
+		} else if c.JWT.Secret == DefaultJWTSecret && !c.IsDevelopment() {
+			errs = append(errs, errors.New("jwt secret must be changed from the default outside development"))
+		}
+	case "RS256", "ES256", "EdDSA":
+		if c.JWT.PrivateKeyFile == "" {
+			errs = append(errs, fmt.Errorf("jwt private key file is required for %s", c.JWT.Algorithm))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("jwt algorithm must be HS256, RS256, ES256 or EdDSA, got %q", c.JWT.Algorithm))
+	}
+	if c.JWT.TTL <= 0 {
+		errs = append(errs, errors.New("jwt ttl must be positive"))
+	}
+	if c.JWT.RefreshTTL <= c.JWT.TTL {
+		errs = append(errs, errors.New("jwt refresh ttl must be longer than the access token ttl"))
+	}
+	if c.Auth.VerificationTTL <= 0 {
+		errs = append(errs, errors.New("auth verification ttl must be positive"))
+	}
+	if c.Auth.PasswordResetTTL <= 0 {
+		errs = append(errs, errors.New("auth password reset ttl must be positive"))
+	}
+	if c.Auth.MFAIssuer == "" {
+		errs = append(errs, errors.New("auth mfa issuer is required"))
+	}
+	if c.Auth.MFAChallengeTTL <= 0 {
+		errs = append(errs, errors.New("auth mfa challenge ttl must be positive"))
+	}
+	if c.Password.MinLength <= 0 || c.Password.MaxLength < c.Password.MinLength || c.Password.MaxLength > MaxPasswordBytes {
+		errs = append(errs, fmt.Errorf("password min length must be positive and the max length between it and %d", MaxPasswordBytes))
+	}
+	if c.Lockout.Enabled {
+		if c.Lockout.AccountThreshold <= 0 || c.Lockout.IPThreshold <= 0 {
+			errs = append(errs, errors.New("lockout thresholds must be positive"))
+		}
+		if c.Lockout.Window <= 0 || c.Lockout.BaseDuration <= 0 {
+			errs = append(errs, errors.New("lockout window and base duration must be positive"))
+		}
+		if c.Lockout.MaxDuration < c.Lockout.BaseDuration {
+			errs = append(errs, errors.New("lockout max duration must not be shorter than the base duration"))
+		}
+	}
+	if c.RateLimit.Enabled {
+		if c.RateLimit.Store != RateLimitStoreMemory && c.RateLimit.Store != RateLimitStoreStorage {
+			errs = append(errs, fmt.Errorf("rate limit store must be %q or %q, got %q",
+				RateLimitStoreMemory, RateLimitStoreStorage, c.RateLimit.Store))
+		}
+		for name, policy := range c.RateLimit.Policies() {
+			if err := policy.validate(); err != nil {
+				errs = append(errs, fmt.Errorf("rate limit policy %s: %w", name, err))
+			}
+		}
+	}
+	if c.Mail.From == "" {
+		errs = append(errs, errors.New("mail from address is required"))
+	}
+	switch c.Mail.Driver {
+	case MailLog:
+		// Printed emails would put the tokens of their links in the logs
+		if !c.IsDevelopment() {
+			errs = append(errs, fmt.Errorf("mail driver %q is only allowed in development, set it to %q or %q", MailLog, MailFile, MailSMTP))
+		}
+	case MailFile:
+		if c.Mail.Dir == "" {
+			errs = append(errs, errors.New("mail dir is required for the file driver"))
+		}
+	case MailSMTP:
+		if c.Mail.SMTP.Host == "" {
+			errs = append(errs, errors.New("smtp host is required for the smtp mail driver"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("mail driver must be one of %q, %q or %q, got %q",
+			MailLog, MailFile, MailSMTP, c.Mail.Driver))
+	}
+	switch c.Blob.Driver {
+	case BlobLocal:
+		if c.Blob.Dir == "" {
+			errs = append(errs, errors.New("blob dir is required for the local driver"))
+		}
+	case BlobS3:
+		if c.Blob.S3.Bucket == "" || c.Blob.S3.Region == "" {
+			errs = append(errs, errors.New("s3 bucket and region are required for the s3 blob driver"))
+		}
+		if c.Blob.S3.AccessKeyID == "" || c.Blob.S3.SecretAccessKey == "" {
+			errs = append(errs, errors.New("s3 access key id and secret access key are required for the s3 blob driver"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("blob driver must be %q or %q, got %q", BlobLocal, BlobS3, c.Blob.Driver))
+	}
+	if c.Avatar.MaxUploadSize <= 0 {
+		errs = append(errs, errors.New("avatar max upload size must be positive"))
+	}
+	if c.Avatar.CacheMaxAge < 0 {
+		errs = append(errs, errors.New("avatar cache max age must not be negative"))
+	}
+
+	switch c.Tracing.Exporter {
+	case TracingNone, TracingStdout:
+	case TracingOTLP:
+		if c.Tracing.OTLPEndpoint == "" {
+			errs = append(errs, errors.New("tracing otlp endpoint is required for the otlp exporter"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("tracing exporter must be one of %q, %q or %q, got %q",
+			TracingNone, TracingStdout, TracingOTLP, c.Tracing.Exporter))
+	}
+	if c.Tracing.ServiceName == "" {
+		errs = append(errs, errors.New("tracing service name is required"))
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		errs = append(errs, fmt.Errorf("tracing sample ratio must be between 0 and 1, got %v", c.Tracing.SampleRatio))
+	}
+	if c.Metrics.Enabled && c.Metrics.Addr != "" {
+		if _, _, err := net.SplitHostPort(c.Metrics.Addr); err != nil {
+			errs = append(errs, fmt.Errorf("metrics addr must be host:port, got %q", c.Metrics.Addr))
+		} else if c.Metrics.Addr == c.Addr() {
+			errs = append(errs, errors.New("metrics addr must differ from the server address"))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+func (p RateLimitPolicy) validate() error {
+	if p.Algorithm != RateLimitTokenBucket && p.Algorithm != RateLimitSlidingWindow {
+		return fmt.Errorf("algorithm must be %q or %q, got %q", RateLimitTokenBucket, RateLimitSlidingWindow, p.Algorithm)
+	}
+	if p.Limit <= 0 || p.Period <= 0 {
+		return errors.New("limit and period must be positive")
+	}
+	if p.Key != RateLimitKeyIP && p.Key != RateLimitKeyUser {
+		return fmt.Errorf("key must be %q or %q, got %q", RateLimitKeyIP, RateLimitKeyUser, p.Key)
+	}
+	return nil
+}
+
+// IsDevelopment reports whether the server runs in development mode
+func (c *Config) IsDevelopment() bool {
+	return c.Env == EnvDevelopment
+}
+
+// Addr returns the address the HTTP server listens on
+func (c *Config) Addr() string {
+	return net.JoinHostPort(c.Server.Host, strconv.Itoa(c.Server.Port))
+}
+
+func setString(dst *string, key string) {
+	if v, ok := os.LookupEnv(key); ok && v != "" {
+		*dst = v
+	}
+}
+
+// setStringList reads a comma-separated list
+func setStringList(dst *[]string, key string) {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return
+	}
+
+	var list []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	*dst = list
+}
+
+func setBool(dst *bool, key string) error {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return fmt.Errorf("%s must be true or false: %w", key, err)
+	}
+	*dst = b
+	return nil
+}
+
+func setInt(dst *int, key string) error {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return fmt.Errorf("%s must be an integer: %w", key, err)
+	}
+	*dst = n
+	return nil
+}
+
+func setFloat(dst *float64, key string) error {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return fmt.Errorf("%s must be a number: %w", key, err)
+	}
+	*dst = f
+	return nil
+}
+
+func setDuration(dst *time.Duration, key string) error {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return fmt.Errorf("%s must be a duration such as 30s or 24h: %w", key, err)
+	}
+	*dst = d
+	return nil
+}
+
+// setDurationMap reads comma-separated key=duration pairs such as
+// "POST /api/v1/users/login=5s,GET /api/v1/users/=3s"
+func setDurationMap(dst *map[string]time.Duration, key string) error {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return nil
+	}
+
+	m := make(map[string]time.Duration)
+	for _, item := range strings.Split(v, ",") {
+		name, value, found := strings.Cut(item, "=")
+		if !found {
+			return fmt.Errorf("%s must look like \"POST /api/v1/users/login=5s\", got %q", key, item)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("%s must look like \"POST /api/v1/users/login=5s\": %w", key, err)
+		}
+		m[strings.TrimSpace(name)] = d
+	}
+	*dst = m
+	return nil
+}
+
+// setRate sets the limit and period of a policy from a "<limit>/<period>"
+// value such as "10/1m"
+func setRate(dst *RateLimitPolicy, key string) error {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return nil
+	}
+	limit, period, found := strings.Cut(v, "/")
+	if !found {
+		return fmt.Errorf("%s must look like 10/1m, got %q", key, v)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(limit))
+	if err != nil {
+		return fmt.Errorf("%s must look like 10/1m: %w", key, err)
+	}
+	d, err := time.ParseDuration(strings.TrimSpace(period))
+	if err != nil {
+		return fmt.Errorf("%s must look like 10/1m: %w", key, err)
+	}
+	dst.Limit = n
+	dst.Period = d
+	return nil
+}
@@ -2,40 +2,33 @@ package config
 
 import (
 	"context"
+	"fmt"
 	"log"
-	"time"
-	
+
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-var DB *mongo.Client
-
-func ConnectDatabase() {
-	// MongoDB connection URI
-	uri := "mongodb://localhost:27017" // Change this to your MongoDB URI
-	clientOptions := options.Client().ApplyURI(uri)
+// ConnectDatabase connects to MongoDB and returns the configured database.
+// opts are applied after the URI, e.g. to install a command monitor.
+func ConnectDatabase(cfg MongoConfig, opts ...*options.ClientOptions) (*mongo.Database, error) {
+	clientOptions := options.MergeClientOptions(append([]*options.ClientOptions{options.Client().ApplyURI(cfg.URI)}, opts...)...)
 
 	// Create context and connect
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ConnectTimeout)
 	defer cancel()
 
 	client, err := mongo.Connect(ctx, clientOptions)
 	if err != nil {
-		log.Fatalf("Failed to connect to MongoDB: %v", err)
+		return nil, fmt.Errorf("failed to connect to MongoDB: %w", err)
 	}
 
 	// Check connection
-	err = client.Ping(ctx, nil)
-	if err != nil {
-		log.Fatalf("Failed to ping MongoDB: %v", err)
+	if err := client.Ping(ctx, nil); err != nil {
+		_ = client.Disconnect(context.Background())
+		return nil, fmt.Errorf("failed to ping MongoDB: %w", err)
 	}
 
 	log.Println("Connected to MongoDB")
-	DB = client
+	return client.Database(cfg.Database), nil
 }
-
-// GetCollection returns a MongoDB collection
-func GetCollection(collectionName string) *mongo.Collection {
-	return DB.Database("go_restful_api").Collection(collectionName)
-}
\ No newline at end of file
@@ -0,0 +1,463 @@
+package controllers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go-restful-api/apperror"
+	"go-restful-api/metrics"
+	"go-restful-api/models"
+	"go-restful-api/services"
+	"go-restful-api/validation"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AuthController handles session and account endpoints under /auth
+type AuthController struct {
+	sessions *services.SessionService
+	accounts *services.AccountService
+	mfa      *services.MFAService
+}
+
+// NewAuthController creates an AuthController
+func NewAuthController(sessions *services.SessionService, accounts *services.AccountService, mfa *services.MFAService) *AuthController {
+	return &AuthController{sessions: sessions, accounts: accounts, mfa: mfa}
+}
+
+// RefreshToken godoc
+// @Summary Refresh access token
+// @Description Exchange a refresh token for a new access token and a new refresh token. Each refresh token can be used once; reusing one revokes every token issued from the same login.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param refresh body models.RefreshTokenDTO true "Refresh token"
+// @Success 200 {object} models.TokenPair
+// @Failure 400 {object} models.Problem
+// @Failure 401 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Router /auth/refresh [post]
+func (ac *AuthController) RefreshToken(c *gin.Context) {
+	var input models.RefreshTokenDTO
+	if !bindJSON(c, &input) {
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	tokens, err := ac.sessions.Refresh(ctx, input.RefreshToken)
+	if errors.Is(err, services.ErrRefreshTokenReused) {
+		c.Error(apperror.Unauthorized("refresh_token_reused", "Refresh token has already been used, please log in again"))
+		return
+	}
+	if errors.Is(err, services.ErrInvalidRefreshToken) {
+		c.Error(apperror.Unauthorized("invalid_refresh_token", "Invalid or expired refresh token"))
+		return
+	}
+	if err != nil {
+		c.Error(apperror.Internal("Failed to refresh token", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// Logout godoc
+// @Summary Logout
+// @Description Revoke the access token used for this request. If a refresh token is given, every token issued from the same login is revoked as well.
+// @Tags auth
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param logout body models.LogoutDTO false "Refresh token of the session"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} models.Problem
+// @Failure 401 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Router /auth/logout [post]
+func (ac *AuthController) Logout(c *gin.Context) {
+	claims, ok := currentClaims(c)
+	if !ok {
+		c.Error(apperror.Unauthorized("unauthorized", "Unauthorized"))
+		return
+	}
+
+	// The body is optional
+	var input models.LogoutDTO
+	if err := c.ShouldBindJSON(&input); err != nil && !errors.Is(err, io.EOF) {
+		c.Error(invalidBody(err))
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	if err := ac.sessions.Logout(ctx, claims, input.RefreshToken); err != nil {
+		c.Error(apperror.Internal("Failed to logout", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+}
+
+// LogoutAll godoc
+// @Summary Logout from all sessions
+// @Description Revoke every access and refresh token of the authenticated user
+// @Tags auth
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} map[string]string
+// @Failure 401 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Router /auth/logout-all [post]
+func (ac *AuthController) LogoutAll(c *gin.Context) {
+	claims, ok := currentClaims(c)
+	if !ok {
+		c.Error(apperror.Unauthorized("unauthorized", "Unauthorized"))
+		return
+	}
+
+	userID, err := primitive.ObjectIDFromHex(claims.UserID)
+	if err != nil {
+		c.Error(apperror.Unauthorized("invalid_token", "Invalid User ID"))
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	if err := ac.sessions.LogoutAll(ctx, userID); err != nil {
+		c.Error(apperror.Internal("Failed to logout", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out from all sessions"})
+}
+
+// VerifyEmail godoc
+// @Summary Verify email address
+// @Description Confirm the email address of an account with the token mailed after registration. Each token can be used once.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param token body models.VerifyEmailDTO true "Verification token"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Router /auth/verify-email [post]
+func (ac *AuthController) VerifyEmail(c *gin.Context) {
+	var input models.VerifyEmailDTO
+	if !bindJSON(c, &input) {
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	err := ac.accounts.VerifyEmail(ctx, input.Token)
+	if errors.Is(err, services.ErrInvalidAccountToken) {
+		c.Error(apperror.BadRequest("invalid_account_token", "Invalid or expired token"))
+		return
+	}
+	if err != nil {
+		c.Error(apperror.Internal("Failed to verify email", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified successfully"})
+}
+
+// ResendVerification godoc
+// @Summary Resend verification email
+// @Description Mail a new verification token to an unverified account. The response is the same whether or not the address belongs to an account.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param email body models.ResendVerificationDTO true "Email address"
+// @Success 202 {object} map[string]string
+// @Failure 400 {object} models.Problem
+// @Router /auth/resend-verification [post]
+func (ac *AuthController) ResendVerification(c *gin.Context) {
+	var input models.ResendVerificationDTO
+	if !bindJSON(c, &input) {
+		return
+	}
+
+	ac.accounts.ResendVerification(c.Request.Context(), input.Email)
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "If the address belongs to an unverified account, a verification email has been sent"})
+}
+
+// ForgotPassword godoc
+// @Summary Request a password reset
+// @Description Mail a password reset token to the account with the email address. The response is the same whether or not the address belongs to an account.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param email body models.ForgotPasswordDTO true "Email address"
+// @Success 202 {object} map[string]string
+// @Failure 400 {object} models.Problem
+// @Router /auth/forgot-password [post]
+func (ac *AuthController) ForgotPassword(c *gin.Context) {
+	var input models.ForgotPasswordDTO
+	if !bindJSON(c, &input) {
+		return
+	}
+
+	ac.accounts.ForgotPassword(c.Request.Context(), input.Email)
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "If the address belongs to an account, a password reset email has been sent"})
+}
+
+// ResetPassword godoc
+// @Summary Reset password
+// @Description Set a new password with the token mailed by forgot-password. Each token can be used once, and every session of the user is signed out.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param reset body models.ResetPasswordDTO true "Reset token and new password"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Router /auth/reset-password [post]
+func (ac *AuthController) ResetPassword(c *gin.Context) {
+	var input models.ResetPasswordDTO
+	if !bindJSON(c, &input) {
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	err := ac.accounts.ResetPassword(ctx, input.Token, input.Password)
+	if errors.Is(err, services.ErrInvalidAccountToken) {
+		c.Error(apperror.BadRequest("invalid_account_token", "Invalid or expired token"))
+		return
+	}
+	var invalid *validation.Error
+	if errors.As(err, &invalid) {
+		c.Error(invalidBody(invalid))
+		return
+	}
+	if err != nil {
+		c.Error(apperror.Internal("Failed to reset password", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset successfully, please log in with the new password"})
+}
+
+// EnrollMFA godoc
+// @Summary Start two-factor enrollment
+// @Description Generate a TOTP secret for the authenticated user. Requires the password. Scan the QR code or enter the secret in an authenticator app, then confirm with a code at /auth/mfa/confirm. Enrolling again before confirming replaces the secret. Wrong passwords count as failed logins.
+// @Tags auth
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param enroll body models.MFAEnrollDTO true "Password"
+// @Success 200 {object} models.MFAEnrollment
+// @Failure 400 {object} models.Problem
+// @Failure 401 {object} models.Problem
+// @Failure 403 {object} models.Problem
+// @Failure 409 {object} models.Problem
+// @Failure 429 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Router /auth/mfa/enroll [post]
+func (ac *AuthController) EnrollMFA(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var input models.MFAEnrollDTO
+	if !bindJSON(c, &input) {
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	enrollment, err := ac.mfa.Enroll(ctx, userID, input.Password, c.ClientIP())
+	if respondLocked(c, err) {
+		return
+	}
+	switch {
+	case errors.Is(err, services.ErrMFAAlreadyEnabled):
+		c.Error(apperror.Conflict("mfa_already_enabled", "Two-factor authentication is already enabled"))
+		return
+	case errors.Is(err, services.ErrIncorrectPassword):
+		c.Error(apperror.Forbidden("incorrect_password", "Password is incorrect"))
+		return
+	case err != nil:
+		c.Error(apperror.Internal("Failed to enroll two-factor authentication", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, enrollment)
+}
+
+// ConfirmMFA godoc
+// @Summary Confirm two-factor enrollment
+// @Description Enable two-factor authentication with the password and a code from the authenticator app. Returns ten single-use recovery codes, which are shown only once. Wrong passwords count as failed logins.
+// @Tags auth
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param confirm body models.MFAConfirmDTO true "Password and TOTP code"
+// @Success 200 {object} models.MFARecoveryCodes
+// @Failure 400 {object} models.Problem
+// @Failure 401 {object} models.Problem
+// @Failure 403 {object} models.Problem
+// @Failure 409 {object} models.Problem
+// @Failure 429 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Router /auth/mfa/confirm [post]
+func (ac *AuthController) ConfirmMFA(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var input models.MFAConfirmDTO
+	if !bindJSON(c, &input) {
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	codes, err := ac.mfa.Confirm(ctx, userID, input.Password, input.Code, c.ClientIP())
+	if respondLocked(c, err) {
+		return
+	}
+	switch {
+	case errors.Is(err, services.ErrMFAAlreadyEnabled):
+		c.Error(apperror.Conflict("mfa_already_enabled", "Two-factor authentication is already enabled"))
+		return
+	case errors.Is(err, services.ErrMFANotEnrolled):
+		c.Error(apperror.BadRequest("mfa_not_enrolled", "Start the enrollment at /auth/mfa/enroll first"))
+		return
+	case errors.Is(err, services.ErrIncorrectPassword):
+		c.Error(apperror.Forbidden("incorrect_password", "Password is incorrect"))
+		return
+	case errors.Is(err, services.ErrInvalidMFACode):
+		c.Error(apperror.BadRequest("invalid_mfa_code", "Invalid code"))
+		return
+	case err != nil:
+		c.Error(apperror.Internal("Failed to enable two-factor authentication", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.MFARecoveryCodes{RecoveryCodes: codes})
+}
+
+// DisableMFA godoc
+// @Summary Disable two-factor authentication
+// @Description Turn two-factor authentication off. Requires the password and a TOTP or recovery code.
+// @Tags auth
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param disable body models.MFADisableDTO true "Password and code"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} models.Problem
+// @Failure 401 {object} models.Problem
+// @Failure 403 {object} models.Problem
+// @Failure 429 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Router /auth/mfa/disable [post]
+func (ac *AuthController) DisableMFA(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var input models.MFADisableDTO
+	if !bindJSON(c, &input) {
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	err := ac.mfa.Disable(ctx, userID, input.Password, input.Code, c.ClientIP())
+	if respondLocked(c, err) {
+		return
+	}
+	switch {
+	case errors.Is(err, services.ErrMFANotEnrolled):
+		c.Error(apperror.BadRequest("mfa_not_enabled", "Two-factor authentication is not enabled"))
+		return
+	case errors.Is(err, services.ErrInvalidMFACode):
+		c.Error(apperror.Forbidden("invalid_credentials", "Invalid password or code"))
+		return
+	case err != nil:
+		c.Error(apperror.Internal("Failed to disable two-factor authentication", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// VerifyMFA godoc
+// @Summary Complete a two-factor login
+// @Description Exchange the MFA token returned by login and a TOTP or recovery code for an access token and a refresh token. Each MFA token can be used once. Wrong codes count as failed logins.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param verify body models.MFAVerifyDTO true "MFA token and code"
+// @Success 200 {object} models.TokenPair
+// @Failure 400 {object} models.Problem
+// @Failure 401 {object} models.Problem
+// @Failure 429 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Router /auth/mfa/verify [post]
+func (ac *AuthController) VerifyMFA(c *gin.Context) {
+	var input models.MFAVerifyDTO
+	if !bindJSON(c, &input) {
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	tokens, err := ac.mfa.Verify(ctx, input.MFAToken, input.Code, c.ClientIP())
+	if respondLocked(c, err) {
+		metrics.Logins.WithLabelValues(metrics.LoginStepMFA, metrics.LoginLocked).Inc()
+		return
+	}
+	switch {
+	case errors.Is(err, services.ErrInvalidMFAChallenge):
+		c.Error(apperror.Unauthorized("invalid_mfa_token", "Invalid or expired MFA token, please log in again"))
+		return
+	case errors.Is(err, services.ErrInvalidMFACode):
+		metrics.Logins.WithLabelValues(metrics.LoginStepMFA, metrics.LoginFailure).Inc()
+		c.Error(apperror.Unauthorized("invalid_mfa_code", "Invalid code"))
+		return
+	case err != nil:
+		c.Error(apperror.Internal("Failed to generate token", err))
+		return
+	}
+
+	metrics.Logins.WithLabelValues(metrics.LoginStepMFA, metrics.LoginSuccess).Inc()
+	c.JSON(http.StatusOK, tokens)
+}
+
+// currentUserID returns the ID of the authenticated user, responding with
+// 401 when it is missing
+func currentUserID(c *gin.Context) (primitive.ObjectID, bool) {
+	claims, ok := currentClaims(c)
+	if !ok {
+		c.Error(apperror.Unauthorized("unauthorized", "Unauthorized"))
+		return primitive.NilObjectID, false
+	}
+	userID, err := primitive.ObjectIDFromHex(claims.UserID)
+	if err != nil {
+		c.Error(apperror.Unauthorized("invalid_token", "Invalid User ID"))
+		return primitive.NilObjectID, false
+	}
+	return userID, true
+}
+
+// currentClaims returns the token claims stored by AuthMiddleware
+func currentClaims(c *gin.Context) (*models.Claims, bool) {
+	userData, exists := c.Get("user")
+	if !exists {
+		return nil, false
+	}
+	claims, ok := userData.(*models.Claims)
+	return claims, ok
+}
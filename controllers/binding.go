@@ -0,0 +1,149 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"go-restful-api/apperror"
+	"go-restful-api/models"
+	"go-restful-api/validation"
+)
+
+func init() {
+	// Report invalid fields by their JSON name
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(func(field reflect.StructField) string {
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" {
+				return ""
+			}
+			return name
+		})
+	}
+}
+
+// normalizer is implemented by request bodies that clean up their fields,
+// e.g. lowercase email addresses, before they are validated
+type normalizer interface {
+	Normalize()
+}
+
+// bindJSON decodes, normalizes and validates the JSON body into dst. On
+// failure it attaches a problem listing what is wrong and returns false.
+func bindJSON(c *gin.Context, dst any) bool {
+	if err := decodeJSON(c.Request.Body, dst); err != nil {
+		c.Error(invalidBody(err))
+		return false
+	}
+	return true
+}
+
+// decodeJSON works like gin's JSON binding, with normalization between
+// decoding and validation
+func decodeJSON(body io.Reader, dst any) error {
+	if body == nil {
+		return io.EOF
+	}
+	if err := json.NewDecoder(body).Decode(dst); err != nil {
+		return err
+	}
+	return validate(dst)
+}
+
+// validate normalizes dst and checks its binding rules
+func validate(dst any) error {
+	if n, ok := dst.(normalizer); ok {
+		n.Normalize()
+	}
+	return binding.Validator.ValidateStruct(dst)
+}
+
+// invalidBody describes a decoding or validation error of the request body
+// without echoing decoder internals
+func invalidBody(err error) *apperror.Error {
+	var (
+		validationErrs validator.ValidationErrors
+		typeErr        *json.UnmarshalTypeError
+		syntaxErr      *json.SyntaxError
+		ruleErr        *validation.Error
+	)
+	switch {
+	case errors.As(err, &ruleErr):
+		return apperror.Validation(ruleErr.Fields...)
+	case errors.As(err, &validationErrs):
+		fields := make([]models.FieldError, 0, len(validationErrs))
+		for _, fe := range validationErrs {
+			fields = append(fields, models.FieldError{Field: fe.Field(), Rule: fe.Tag(), Message: ruleMessage(fe)})
+		}
+		return apperror.Validation(fields...)
+	case errors.As(err, &typeErr) && typeErr.Field == "":
+		return apperror.BadRequest("invalid_body", "Request body must be a JSON object")
+	case errors.As(err, &typeErr):
+		return apperror.Validation(models.FieldError{Field: typeErr.Field, Rule: "type", Message: "must be " + jsonType(typeErr.Type)})
+	case errors.Is(err, io.EOF):
+		return apperror.BadRequest("invalid_body", "Request body is required")
+	case errors.As(err, &syntaxErr), errors.Is(err, io.ErrUnexpectedEOF):
+		return apperror.BadRequest("invalid_body", "Request body must be valid JSON")
+	}
+	// encoding/json has no type for unknown fields
+	if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		return apperror.Validation(models.FieldError{Field: strings.Trim(field, `"`), Rule: "unknown", Message: "is not a known field"})
+	}
+	return apperror.BadRequest("invalid_body", "Request body could not be read")
+}
+
+// ruleMessage explains a failed validation rule to the client
+func ruleMessage(fe validator.FieldError) string {
+	unit := ""
+	if fe.Kind() == reflect.String {
+		unit = " characters"
+	}
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "url":
+		return "must be a valid URL"
+	case "http_url":
+		return "must be an http or https URL"
+	case "min":
+		return fmt.Sprintf("must be at least %s%s", fe.Param(), unit)
+	case "max":
+		return fmt.Sprintf("must be at most %s%s", fe.Param(), unit)
+	case "len":
+		return fmt.Sprintf("must be exactly %s%s", fe.Param(), unit)
+	case "oneof":
+		return "must be one of " + strings.ReplaceAll(fe.Param(), " ", ", ")
+	default:
+		if msg := validation.Message(fe.Tag()); msg != "" {
+			return msg
+		}
+		return fmt.Sprintf("fails the %s rule", fe.Tag())
+	}
+}
+
+// jsonType names the JSON type expected for a Go type
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	default:
+		return "an object"
+	}
+}
@@ -0,0 +1,122 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"go-restful-api/apperror"
+	"go-restful-api/models"
+)
+
+func TestDecodeJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		// wantCode is the problem code, "" when the body is accepted
+		wantCode string
+		// wantFields are the reported fields as field:rule, in order
+		wantFields []string
+	}{
+		{
+			name:     "valid",
+			body:     `{"name": "Ann", "email": "ann@example.com", "password": "correct horse"}`,
+			wantCode: "",
+		},
+		{
+			name:       "every invalid field",
+			body:       `{"name": "Ann2", "email": "not-an-email", "password": "short"}`,
+			wantCode:   "validation_failed",
+			wantFields: []string{"name:person_name", "email:email", "password:password_length"},
+		},
+		{
+			name:       "missing fields",
+			body:       `{}`,
+			wantCode:   "validation_failed",
+			wantFields: []string{"name:required", "email:required", "password:required"},
+		},
+		{
+			name:       "password equal to the email",
+			body:       `{"name": "Ann", "email": "ann@example.com", "password": "ANN@example.com"}`,
+			wantCode:   "validation_failed",
+			wantFields: []string{"password:not_email"},
+		},
+		{
+			name:       "wrong type",
+			body:       `{"name": 42, "email": "ann@example.com", "password": "correct horse"}`,
+			wantCode:   "validation_failed",
+			wantFields: []string{"name:type"},
+		},
+		{
+			name:     "not an object",
+			body:     `["ann@example.com"]`,
+			wantCode: "invalid_body",
+		},
+		{
+			name:     "malformed",
+			body:     `{"name": "Ann",`,
+			wantCode: "invalid_body",
+		},
+		{
+			name:     "empty",
+			body:     ``,
+			wantCode: "invalid_body",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var user models.User
+			err := decodeJSON(strings.NewReader(tt.body), &user)
+			if tt.wantCode == "" {
+				if err != nil {
+					t.Fatalf("decodeJSON() error = %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("decodeJSON() accepted the body")
+			}
+
+			var problem *apperror.Error
+			if !errors.As(invalidBody(err), &problem) {
+				t.Fatal("invalidBody() did not return an *apperror.Error")
+			}
+			if problem.Status != http.StatusBadRequest || problem.Code != tt.wantCode {
+				t.Errorf("problem = %d %s, want 400 %s", problem.Status, problem.Code, tt.wantCode)
+			}
+			var fields []string
+			for _, field := range problem.Fields {
+				if field.Message == "" {
+					t.Errorf("field %s has no message", field.Field)
+				}
+				fields = append(fields, field.Field+":"+field.Rule)
+			}
+			if strings.Join(fields, ",") != strings.Join(tt.wantFields, ",") {
+				t.Errorf("fields = %v, want %v", fields, tt.wantFields)
+			}
+		})
+	}
+}
+
+func TestDecodeJSONNormalizes(t *testing.T) {
+	var user models.User
+	body := `{"name": "  Ann   Smith ", "email": " Ann.Smith@Example.COM ", "password": "correct horse"}`
+	if err := decodeJSON(strings.NewReader(body), &user); err != nil {
+		t.Fatalf("decodeJSON() error = %v", err)
+	}
+	if user.Name != "Ann Smith" {
+		t.Errorf("name = %q, want %q", user.Name, "Ann Smith")
+	}
+	if user.Email != "ann.smith@example.com" {
+		t.Errorf("email = %q, want %q", user.Email, "ann.smith@example.com")
+	}
+
+	var login models.LoginDTO
+	if err := decodeJSON(strings.NewReader(`{"email": "ANN.SMITH@example.com ", "password": "x"}`), &login); err != nil {
+		t.Fatalf("decodeJSON() error = %v", err)
+	}
+	if login.Email != user.Email {
+		t.Errorf("login email = %q, want it normalized like the stored %q", login.Email, user.Email)
+	}
+}
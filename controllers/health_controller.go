@@ -0,0 +1,107 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go-restful-api/models"
+)
+
+// HealthCheck reports whether a dependency is usable
+type HealthCheck func(ctx context.Context) error
+
+// HealthController serves the liveness and readiness probes
+type HealthController struct {
+	checks   map[string]HealthCheck
+	timeout  time.Duration
+	draining atomic.Bool
+}
+
+// NewHealthController creates a HealthController running the named checks
+// for readiness, each bounded by timeout
+func NewHealthController(checks map[string]HealthCheck, timeout time.Duration) *HealthController {
+	return &HealthController{checks: checks, timeout: timeout}
+}
+
+// Drain marks the server as shutting down. From then on /readyz answers 503
+// so load balancers stop sending traffic while in-flight requests finish.
+func (hc *HealthController) Drain() {
+	hc.draining.Store(true)
+}
+
+// Live answers GET /healthz. It only shows the process is serving requests
+// and never checks dependencies, so an outage of the database does not get
+// every instance restarted.
+func (hc *HealthController) Live(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, models.HealthStatus{Status: models.HealthOK})
+}
+
+// Ready answers GET /readyz with the status and latency of every
+// dependency: 200 when all are up, 503 when one is down or the server is
+// shutting down.
+func (hc *HealthController) Ready(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	if hc.draining.Load() {
+		c.JSON(http.StatusServiceUnavailable, models.HealthStatus{Status: models.HealthShuttingDown})
+		return
+	}
+
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		result = models.HealthStatus{Status: models.HealthReady, Checks: make(map[string]models.DependencyStatus, len(hc.checks))}
+	)
+	for name, check := range hc.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			status := hc.run(c.Request.Context(), name, check)
+
+			mu.Lock()
+			defer mu.Unlock()
+			result.Checks[name] = status
+			if status.Status != models.DependencyUp {
+				result.Status = models.HealthNotReady
+			}
+		}()
+	}
+	wg.Wait()
+
+	code := http.StatusOK
+	if result.Status != models.HealthReady {
+		code = http.StatusServiceUnavailable
+	}
+	c.JSON(code, result)
+}
+
+// run times one check. Errors are logged rather than returned, they may
+// name internal hosts.
+func (hc *HealthController) run(ctx context.Context, name string, check HealthCheck) models.DependencyStatus {
+	ctx, cancel := context.WithTimeout(ctx, hc.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check(ctx)
+	status := models.DependencyStatus{
+		Status:    models.DependencyUp,
+		LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	switch {
+	case err == nil:
+	case errors.Is(err, context.DeadlineExceeded):
+		status.Status, status.Error = models.DependencyDown, "timeout"
+	default:
+		status.Status, status.Error = models.DependencyDown, "unavailable"
+	}
+	if err != nil {
+		log.Printf("Readiness check %s failed: %v", name, err)
+	}
+	return status
+}
@@ -0,0 +1,26 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go-restful-api/utils"
+)
+
+// JWKSController publishes the public keys used to verify access tokens
+type JWKSController struct {
+	tokens *utils.TokenManager
+}
+
+// NewJWKSController creates a JWKSController
+func NewJWKSController(tokens *utils.TokenManager) *JWKSController {
+	return &JWKSController{tokens: tokens}
+}
+
+// GetJWKS serves the JSON Web Key Set at /.well-known/jwks.json, outside the
+// /api/v1 base path. With HS256 signing the set is empty because the shared
+// secret must never be published.
+func (jc *JWKSController) GetJWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, jc.tokens.JWKS())
+}
@@ -0,0 +1,21 @@
+package controllers
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"go-restful-api/apperror"
+	"go-restful-api/services"
+)
+
+// respondLocked answers 429 with a Retry-After header when err is a
+// *services.LockedError and reports whether it did
+func respondLocked(c *gin.Context, err error) bool {
+	var locked *services.LockedError
+	if !errors.As(err, &locked) {
+		return false
+	}
+
+	c.Error(apperror.TooManyRequests("login_locked", "Too many failed login attempts, please try again later", locked.RetryAfter))
+	return true
+}
@@ -0,0 +1,61 @@
+package controllers
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go-restful-api/models"
+)
+
+const (
+	defaultPageSize = 20
+	// maxPageSize caps per_page so a single request cannot load a whole collection
+	maxPageSize = 100
+)
+
+// parsePage reads the page and per_page query parameters. per_page is
+// clamped to maxPageSize.
+func parsePage(c *gin.Context) (page, perPage int, err error) {
+	page, perPage = 1, defaultPageSize
+
+	if v := c.Query("page"); v != "" {
+		page, err = strconv.Atoi(v)
+		if err != nil || page < 1 {
+			return 0, 0, fmt.Errorf("page must be a positive integer")
+		}
+	}
+	if v := c.Query("per_page"); v != "" {
+		perPage, err = strconv.Atoi(v)
+		if err != nil || perPage < 1 {
+			return 0, 0, fmt.Errorf("per_page must be a positive integer")
+		}
+	}
+
+	return page, min(perPage, maxPageSize), nil
+}
+
+// pageInfo builds the meta and links of a page, keeping every other query
+// parameter of the request so filters and sorting carry over
+func pageInfo(c *gin.Context, page, perPage int, total int64) (models.PageMeta, models.PageLinks) {
+	totalPages := int((total + int64(perPage) - 1) / int64(perPage))
+
+	link := func(p int) string {
+		query := c.Request.URL.Query()
+		query.Set("page", strconv.Itoa(p))
+		query.Set("per_page", strconv.Itoa(perPage))
+		return (&url.URL{Path: c.Request.URL.Path, RawQuery: query.Encode()}).String()
+	}
+
+	links := models.PageLinks{Self: link(page)}
+	if page < totalPages {
+		links.Next = link(page + 1)
+	}
+	if page > 1 {
+		links.Prev = link(min(page-1, max(totalPages, 1)))
+	}
+
+	meta := models.PageMeta{Page: page, PerPage: perPage, Total: total, TotalPages: totalPages}
+	return meta, links
+}
@@ -1,17 +1,36 @@
 package controllers
 
 import (
-	"context"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"slices"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"go-restful-api/apperror"
 	"go-restful-api/config"
 	"go-restful-api/models"
-	"go.mongodb.org/mongo-driver/bson"
+	"go-restful-api/repository"
+	"go-restful-api/services"
+	"go-restful-api/utils"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// ProfileController handles profile endpoints of the authenticated user
+type ProfileController struct {
+	profiles repository.ProfileRepository
+	avatars  *services.AvatarService
+	avatar   config.AvatarConfig
+}
+
+// NewProfileController creates a ProfileController
+func NewProfileController(profiles repository.ProfileRepository, avatars *services.AvatarService, avatar config.AvatarConfig) *ProfileController {
+	return &ProfileController{profiles: profiles, avatars: avatars, avatar: avatar}
+}
+
 // CreateProfileByUserID godoc
 // @Summary Create a new profile
 // @Description Add a new profile to the database. User ID is extracted from the token.
@@ -21,27 +40,26 @@ import (
 // @Produce json
 // @Param user body models.Profile true "Profile details"
 // @Success 201 {object} map[string]interface{}
-// @Failure 400 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Failure 400 {object} models.Problem
+// @Failure 409 {object} models.Problem
+// @Failure 500 {object} models.Problem
 // @Router /profiles [post]
-func CreateProfileByUserID(c *gin.Context) {
-	profileCollection := config.GetCollection("profiles")
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+func (pc *ProfileController) CreateProfileByUserID(c *gin.Context) {
+	ctx := c.Request.Context()
 
 	var profile models.Profile
 
 	// Ambil UserID dari Token
 	userData, exists := c.Get("user")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		c.Error(apperror.Unauthorized("unauthorized", "Unauthorized"))
 		return
 	}
 
 	// Konversi ke struct Claims
 	claims, ok := userData.(*models.Claims)
 	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token data"})
+		c.Error(apperror.Unauthorized("invalid_token", "Invalid token data"))
 		return
 	}
 
@@ -50,34 +68,39 @@ func CreateProfileByUserID(c *gin.Context) {
 	// Validasi User ID
 	userObjectID, err := primitive.ObjectIDFromHex(userIDStr)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid User ID"})
+		c.Error(apperror.Unauthorized("invalid_token", "Invalid User ID"))
 		return
 	}
 
 	// Cek apakah profil sudah ada untuk user ini
-	var existingProfile models.Profile
-	err = profileCollection.FindOne(ctx, bson.M{"user_id": userObjectID}).Decode(&existingProfile)
+	_, err = pc.profiles.FindByUserID(ctx, userObjectID)
 	if err == nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "User already has a profile"})
+		c.Error(apperror.Conflict("profile_exists", "User already has a profile"))
 		return
 	}
 
 	// Bind JSON input ke struct profile
-	if err := c.ShouldBindJSON(&profile); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &profile) {
 		return
 	}
 
 	// Isi data profil baru
 	profile.ID = primitive.NewObjectID()
 	profile.UserID = userObjectID
+	// The avatar only comes from an upload
+	profile.Avatar = ""
+	profile.AvatarVersion = ""
 	profile.CreatedAt = time.Now()
 	profile.UpdatedAt = time.Now()
 
 	// Simpan ke database
-	_, err = profileCollection.InsertOne(ctx, profile)
+	err = pc.profiles.Insert(ctx, &profile)
+	if errors.Is(err, repository.ErrDuplicate) {
+		c.Error(apperror.Conflict("profile_exists", "User already has a profile"))
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(apperror.Internal("Failed to create profile", err))
 		return
 	}
 
@@ -91,24 +114,22 @@ func CreateProfileByUserID(c *gin.Context) {
 // @Security BearerAuth
 // @Produce json
 // @Success 200 {object} models.Profile
-// @Failure 404 {object} map[string]string
+// @Failure 404 {object} models.Problem
 // @Router /profiles [get]
-func GetProfileByUserID(c *gin.Context) {
-	profileCollection := config.GetCollection("profiles")
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+func (pc *ProfileController) GetProfileByUserID(c *gin.Context) {
+	ctx := c.Request.Context()
 
 	// Ambil UserID dari Token
 	userData, exists := c.Get("user")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		c.Error(apperror.Unauthorized("unauthorized", "Unauthorized"))
 		return
 	}
 
 	// Konversi ke struct Claims
 	claims, ok := userData.(*models.Claims)
 	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token data"})
+		c.Error(apperror.Unauthorized("invalid_token", "Invalid token data"))
 		return
 	}
 
@@ -117,15 +138,18 @@ func GetProfileByUserID(c *gin.Context) {
 	// Validasi User ID
 	userObjectID, err := primitive.ObjectIDFromHex(userIDStr)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid User ID"})
+		c.Error(apperror.Unauthorized("invalid_token", "Invalid User ID"))
 		return
 	}
 
 	// Cari profil berdasarkan user_id
-	var profile models.Profile
-	err = profileCollection.FindOne(ctx, bson.M{"user_id": userObjectID}).Decode(&profile)
+	profile, err := pc.profiles.FindByUserID(ctx, userObjectID)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.Error(apperror.NotFound("profile_not_found", "Profile not found"))
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Profile not found"})
+		c.Error(apperror.Internal("Failed to fetch profile", err))
 		return
 	}
 
@@ -141,26 +165,24 @@ func GetProfileByUserID(c *gin.Context) {
 // @Produce json
 // @Param user body models.Profile true "Updated Profile details"
 // @Success 200 {object} map[string]interface{}
-// @Failure 400 {object} map[string]string
-// @Failure 404 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Failure 400 {object} models.Problem
+// @Failure 404 {object} models.Problem
+// @Failure 500 {object} models.Problem
 // @Router /profiles [put]
-func UpdateProfileByUserID(c *gin.Context) {
-	profileCollection := config.GetCollection("profiles")
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+func (pc *ProfileController) UpdateProfileByUserID(c *gin.Context) {
+	ctx := c.Request.Context()
 
 	// Ambil UserID dari Token
 	userData, exists := c.Get("user")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		c.Error(apperror.Unauthorized("unauthorized", "Unauthorized"))
 		return
 	}
 
 	// Konversi ke struct Claims
 	claims, ok := userData.(*models.Claims)
 	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token data"})
+		c.Error(apperror.Unauthorized("invalid_token", "Invalid token data"))
 		return
 	}
 
@@ -169,41 +191,43 @@ func UpdateProfileByUserID(c *gin.Context) {
 	// Validasi User ID
 	userObjectID, err := primitive.ObjectIDFromHex(userIDStr)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid User ID"})
+		c.Error(apperror.Unauthorized("invalid_token", "Invalid User ID"))
 		return
 	}
 
 	// Cek apakah profil ada
-	var existingProfile models.Profile
-	err = profileCollection.FindOne(ctx, bson.M{"user_id": userObjectID}).Decode(&existingProfile)
+	existingProfile, err := pc.profiles.FindByUserID(ctx, userObjectID)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.Error(apperror.NotFound("profile_not_found", "Profile not found"))
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Profile not found"})
+		c.Error(apperror.Internal("Failed to fetch profile", err))
 		return
 	}
 
 	// Bind JSON input ke struct sementara
 	var updatedProfile models.Profile
-	if err := c.ShouldBindJSON(&updatedProfile); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &updatedProfile) {
 		return
 	}
 
-	// Buat update object hanya untuk field yang diisi
-	updateFields := bson.M{
-		"updated_at": time.Now(),
-	}
+	// Update hanya field yang diisi
+	existingProfile.UpdatedAt = time.Now()
 
+	// The avatar is left alone, it points at the uploaded images
 	if updatedProfile.Bio != "" {
-		updateFields["bio"] = updatedProfile.Bio
-	}
-	if updatedProfile.Avatar != "" {
-		updateFields["avatar"] = updatedProfile.Avatar
+		existingProfile.Bio = updatedProfile.Bio
 	}
 
 	// Lakukan update di database
-	_, err = profileCollection.UpdateOne(ctx, bson.M{"user_id": userObjectID}, bson.M{"$set": updateFields})
+	err = pc.profiles.Update(ctx, existingProfile)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.Error(apperror.NotFound("profile_not_found", "Profile not found"))
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(apperror.Internal("Failed to update profile", err))
 		return
 	}
 
@@ -216,25 +240,23 @@ func UpdateProfileByUserID(c *gin.Context) {
 // @Tags profiles
 // @Security BearerAuth
 // @Success 200 {object} map[string]string
-// @Failure 404 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Failure 404 {object} models.Problem
+// @Failure 500 {object} models.Problem
 // @Router /profiles [delete]
-func DeleteProfileByUserID(c *gin.Context) {
-	profileCollection := config.GetCollection("profiles")
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+func (pc *ProfileController) DeleteProfileByUserID(c *gin.Context) {
+	ctx := c.Request.Context()
 
 	// Ambil UserID dari Token
 	userData, exists := c.Get("user")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		c.Error(apperror.Unauthorized("unauthorized", "Unauthorized"))
 		return
 	}
 
 	// Konversi ke struct Claims
 	claims, ok := userData.(*models.Claims)
 	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token data"})
+		c.Error(apperror.Unauthorized("invalid_token", "Invalid token data"))
 		return
 	}
 
@@ -243,24 +265,170 @@ func DeleteProfileByUserID(c *gin.Context) {
 	// Validasi User ID
 	userObjectID, err := primitive.ObjectIDFromHex(userIDStr)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid User ID"})
+		c.Error(apperror.Unauthorized("invalid_token", "Invalid User ID"))
 		return
 	}
 
-	// Cek apakah profil ada
-	var existingProfile models.Profile
-	err = profileCollection.FindOne(ctx, bson.M{"user_id": userObjectID}).Decode(&existingProfile)
+	profile, err := pc.profiles.FindByUserID(ctx, userObjectID)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.Error(apperror.NotFound("profile_not_found", "Profile not found"))
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Profile not found"})
+		c.Error(apperror.Internal("Failed to delete profile", err))
 		return
 	}
 
 	// Hapus profil dari database
-	_, err = profileCollection.DeleteOne(ctx, bson.M{"user_id": userObjectID})
+	err = pc.profiles.DeleteByUserID(ctx, userObjectID)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.Error(apperror.NotFound("profile_not_found", "Profile not found"))
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(apperror.Internal("Failed to delete profile", err))
 		return
 	}
+	pc.avatars.Delete(ctx, profile)
 
 	c.JSON(http.StatusOK, gin.H{"message": "Profile deleted successfully"})
-}
\ No newline at end of file
+}
+
+// multipartOverhead is allowed on top of the avatar size for the form framing
+const multipartOverhead = 64 << 10
+
+// UploadAvatar godoc
+// @Summary Upload avatar
+// @Description Replace the avatar of the authenticated user's profile with a JPEG, PNG, GIF or WebP image. The image is cropped to a square, resized to 512, 256, 128 and 64 pixels and re-encoded without metadata. The profile's avatar URL points at the new image afterwards.
+// @Tags profiles
+// @Security BearerAuth
+// @Accept multipart/form-data
+// @Produce json
+// @Param avatar formData file true "Image file"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} models.Problem
+// @Failure 401 {object} models.Problem
+// @Failure 404 {object} models.Problem
+// @Failure 413 {object} models.Problem
+// @Failure 415 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Router /profiles/avatar [put]
+func (pc *ProfileController) UploadAvatar(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	maxSize := int64(pc.avatar.MaxUploadSize)
+	tooLarge := apperror.New(http.StatusRequestEntityTooLarge, "avatar_too_large",
+		fmt.Sprintf("Avatar must not be larger than %d bytes", maxSize))
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSize+multipartOverhead)
+	header, err := c.FormFile("avatar")
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		c.Error(tooLarge)
+		return
+	}
+	if err != nil {
+		c.Error(apperror.BadRequest("invalid_body", `Request body must be multipart/form-data with an "avatar" file`))
+		return
+	}
+	if header.Size > maxSize {
+		c.Error(tooLarge)
+		return
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		c.Error(apperror.Internal("Failed to read avatar", err))
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		c.Error(apperror.Internal("Failed to read avatar", err))
+		return
+	}
+
+	profile, err := pc.avatars.Upload(ctx, userID, data)
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		c.Error(apperror.NotFound("profile_not_found", "Create a profile before uploading an avatar"))
+	case errors.Is(err, utils.ErrUnsupportedImage):
+		c.Error(apperror.New(http.StatusUnsupportedMediaType, "unsupported_image_type", "Avatar must be a JPEG, PNG, GIF or WebP image"))
+	case errors.Is(err, utils.ErrImageTooLarge):
+		c.Error(apperror.BadRequest("image_too_large", "Avatar has too many pixels"))
+	case errors.Is(err, utils.ErrInvalidImage):
+		c.Error(apperror.BadRequest("invalid_image", "Avatar could not be decoded"))
+	case err != nil:
+		c.Error(apperror.Internal("Failed to update avatar", err))
+	default:
+		c.JSON(http.StatusOK, gin.H{"message": "Avatar updated successfully", "profile": profile})
+	}
+}
+
+// GetAvatar godoc
+// @Summary Get avatar
+// @Description Serve the avatar of a user as a square image. Responses carry an ETag and may be cached for the configured max-age; the avatar URL of the profile changes with every upload.
+// @Tags profiles
+// @Produce image/jpeg,image/png
+// @Param userId path string true "User ID"
+// @Param size query int false "Edge length in pixels: 64, 128, 256 or 512" default(256)
+// @Success 200 {file} file
+// @Success 304
+// @Failure 400 {object} models.Problem
+// @Failure 404 {object} models.Problem
+// @Router /profiles/{userId}/avatar [get]
+func (pc *ProfileController) GetAvatar(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userID, err := primitive.ObjectIDFromHex(c.Param("userId"))
+	if err != nil {
+		c.Error(apperror.BadRequest("invalid_id", "Invalid ID format"))
+		return
+	}
+
+	size := services.DefaultAvatarSize
+	if raw := c.Query("size"); raw != "" {
+		size, err = strconv.Atoi(raw)
+		if err != nil || !slices.Contains(services.AvatarSizes, size) {
+			c.Error(apperror.BadRequest("invalid_query", "size must be one of 64, 128, 256 or 512"))
+			return
+		}
+	}
+
+	version, err := pc.avatars.Version(ctx, userID)
+	if errors.Is(err, services.ErrNoAvatar) {
+		c.Error(apperror.NotFound("avatar_not_found", "User has no avatar"))
+		return
+	}
+	if err != nil {
+		c.Error(apperror.Internal("Failed to fetch avatar", err))
+		return
+	}
+
+	etag := fmt.Sprintf(`"%s-%d"`, version, size)
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int(pc.avatar.CacheMaxAge.Seconds())))
+	if match := c.GetHeader("If-None-Match"); match == etag || match == "*" {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	avatar, err := pc.avatars.Open(ctx, userID, version, size)
+	if errors.Is(err, services.ErrNoAvatar) {
+		c.Error(apperror.NotFound("avatar_not_found", "User has no avatar"))
+		return
+	}
+	if err != nil {
+		c.Error(apperror.Internal("Failed to fetch avatar", err))
+		return
+	}
+	defer avatar.Body.Close()
+
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.DataFromReader(http.StatusOK, avatar.Size, avatar.ContentType, avatar.Body, nil)
+}
@@ -1,268 +1,697 @@
 package controllers
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"go-restful-api/config"
+	"go-restful-api/apperror"
+	"go-restful-api/metrics"
 	"go-restful-api/models"
+	"go-restful-api/repository"
+	"go-restful-api/services"
 	"go-restful-api/utils"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/bson"
+	"go-restful-api/validation"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// UserController handles user and authentication endpoints
+type UserController struct {
+	users    repository.UserRepository
+	profiles repository.ProfileRepository
+	avatars  *services.AvatarService
+	sessions *services.SessionService
+	accounts *services.AccountService
+	mfa      *services.MFAService
+	guard    *services.LoginGuard
+}
+
+// NewUserController creates a UserController
+func NewUserController(users repository.UserRepository, profiles repository.ProfileRepository, avatars *services.AvatarService, sessions *services.SessionService, accounts *services.AccountService, mfa *services.MFAService, guard *services.LoginGuard) *UserController {
+	return &UserController{
+		users:    users,
+		profiles: profiles,
+		avatars:  avatars,
+		sessions: sessions,
+		accounts: accounts,
+		mfa:      mfa,
+		guard:    guard,
+	}
+}
+
 // GetUsers godoc
 // @Summary Get all users
-// @Description Retrieve a list of all users from the database
+// @Description Retrieve a page of users, optionally filtered and sorted. Requires the admin role.
 // @Tags users
 // @Security BearerAuth
 // @Produce json
-// @Success 200 {object} []models.UserDTO
-// @Failure 500 {object} map[string]string
+// @Param page query int false "Page number, starting at 1" default(1)
+// @Param per_page query int false "Users per page, at most 100" default(20)
+// @Param name query string false "Case-insensitive substring of the name"
+// @Param email query string false "Case-insensitive substring of the email"
+// @Param created_after query string false "Only users created after this RFC 3339 time or date"
+// @Param created_before query string false "Only users created before this RFC 3339 time or date"
+// @Param sort query string false "Sort field: created_at, name or email, prefixed with - for descending" default(created_at)
+// @Success 200 {object} models.UserListResponse
+// @Failure 400 {object} models.Problem
+// @Failure 403 {object} models.Problem
+// @Failure 500 {object} models.Problem
 // @Router /users [get]
-func GetUsers(c *gin.Context) {
-	collection := config.GetCollection("users")
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+func (uc *UserController) GetUsers(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	page, perPage, err := parsePage(c)
+	if err != nil {
+		c.Error(apperror.BadRequest("invalid_query", err.Error()))
+		return
+	}
+
+	opts := repository.UserListOptions{
+		Name:   c.Query("name"),
+		Email:  c.Query("email"),
+		Offset: (page - 1) * perPage,
+		Limit:  perPage,
+	}
+	if opts.CreatedAfter, err = parseTimeQuery(c, "created_after"); err != nil {
+		c.Error(apperror.BadRequest("invalid_query", err.Error()))
+		return
+	}
+	if opts.CreatedBefore, err = parseTimeQuery(c, "created_before"); err != nil {
+		c.Error(apperror.BadRequest("invalid_query", err.Error()))
+		return
+	}
 
-	var users []models.UserDTO
-	cursor, err := collection.Find(ctx, bson.M{})
+	// sort=-name sorts by name in descending order
+	if sort := c.DefaultQuery("sort", repository.UserSortCreatedAt); sort != "" {
+		opts.Descending = strings.HasPrefix(sort, "-")
+		opts.SortBy = strings.TrimPrefix(sort, "-")
+		if !repository.IsValidUserSort(opts.SortBy) {
+			c.Error(apperror.BadRequest("invalid_query", "sort must be one of created_at, name or email"))
+			return
+		}
+	}
+
+	result, total, err := uc.users.List(ctx, opts)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(apperror.Internal("Failed to list users", err))
 		return
 	}
 
-	defer cursor.Close(ctx)
-	for cursor.Next(ctx) {
-		var user models.UserDTO
-		cursor.Decode(&user)
-		users = append(users, user)
+	users := make([]models.UserDTO, 0, len(result))
+	for i := range result {
+		users = append(users, result[i].ToDTO())
 	}
 
-	c.JSON(http.StatusOK, gin.H{"data": users})
+	meta, links := pageInfo(c, page, perPage, total)
+	c.JSON(http.StatusOK, models.UserListResponse{Data: users, Meta: meta, Links: links})
+}
+
+// parseTimeQuery reads an optional RFC 3339 timestamp or YYYY-MM-DD date
+// (midnight UTC) from the query string
+func parseTimeQuery(c *gin.Context, name string) (time.Time, error) {
+	v := c.Query(name)
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.DateOnly, v); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("%s must be an RFC 3339 time or a YYYY-MM-DD date", name)
 }
 
 // GetUserByID godoc
 // @Summary Get a user by ID
-// @Description Retrieve details of a specific user using their ID
+// @Description Retrieve details of a specific user using their ID. Non-admins can only read their own account.
 // @Tags users
 // @Security BearerAuth
 // @Param id path string true "User ID"
 // @Produce json
 // @Success 200 {object} models.UserDTO
-// @Failure 400 {object} map[string]string
-// @Failure 404 {object} map[string]string
+// @Failure 400 {object} models.Problem
+// @Failure 403 {object} models.Problem
+// @Failure 404 {object} models.Problem
 // @Router /users/{id} [get]
-func GetUserByID(c *gin.Context) {
-	collection := config.GetCollection("users")
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+func (uc *UserController) GetUserByID(c *gin.Context) {
+	ctx := c.Request.Context()
 
 	id := c.Param("id")
 	objID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		c.Error(apperror.BadRequest("invalid_id", "Invalid ID format"))
 		return
 	}
 
-	var user models.UserDTO
-	err = collection.FindOne(ctx, bson.M{"_id": objID}).Decode(&user)
+	user, err := uc.users.FindByID(ctx, objID)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.Error(apperror.NotFound("user_not_found", "User not found"))
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		c.Error(apperror.Internal("Failed to fetch user", err))
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"data": user})
+	c.JSON(http.StatusOK, gin.H{"data": user.ToDTO()})
 }
 
 // CreateUser godoc
 // @Summary Create a new user
-// @Description Add a new user to the database
+// @Description Add a new user to the database and mail a verification token to the address
 // @Tags users
 // @Accept json
 // @Produce json
 // @Param user body models.User true "User details"
 // @Success 200 {object} models.User
-// @Failure 400 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Failure 400 {object} models.Problem
+// @Failure 409 {object} models.Problem
+// @Failure 500 {object} models.Problem
 // @Router /users [post]
-func CreateUser(c *gin.Context) {
-	collection := config.GetCollection("users")
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+func (uc *UserController) CreateUser(c *gin.Context) {
+	ctx := c.Request.Context()
 
 	var user models.User
-	if err := c.ShouldBindJSON(&user); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &user) {
 		return
 	}
 
 	// Check if the email already exists in the database
-	var existingUser models.User
-	err := collection.FindOne(ctx, bson.M{"email": user.Email}).Decode(&existingUser)
+	_, err := uc.users.FindByEmail(ctx, user.Email)
 	if err == nil {
 		// Email already exists
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Email is already in use"})
+		c.Error(apperror.Conflict("email_in_use", "Email is already in use"))
 		return
-	} else if err != mongo.ErrNoDocuments {
+	} else if !errors.Is(err, repository.ErrNotFound) {
 		// Error occurred while checking email
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(apperror.Internal("Failed to check email", err))
 		return
 	}
 
 	// Hash the password
 	hashedPassword, err := utils.HashPassword(user.Password)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		c.Error(apperror.Internal("Failed to hash password", err))
 		return
 	}
 
 	user.ID = primitive.NewObjectID()
 	user.Password = hashedPassword
+	user.Roles = []string{models.RoleUser}
+	user.CreatedAt = time.Time{}
+	user.EmailVerified = false
 
 	// Insert the new user into the database
-	_, err = collection.InsertOne(ctx, user)
+	err = uc.users.Insert(ctx, &user)
+	if errors.Is(err, repository.ErrDuplicate) {
+		c.Error(apperror.Conflict("email_in_use", "Email is already in use"))
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(apperror.Internal("Failed to create user", err))
 		return
 	}
 
+	metrics.Registrations.Inc()
+
+	// The account exists either way, the user can ask for a new email
+	if err := uc.accounts.SendVerification(ctx, &user); err != nil {
+		log.Printf("Failed to send verification email to %s: %v", user.Email, err)
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"id":    user.ID,
-		"name":  user.Name,
-		"email": user.Email,
+		"id":             user.ID,
+		"name":           user.Name,
+		"email":          user.Email,
+		"email_verified": user.EmailVerified,
 	})
 }
 
-
 // UpdateUser godoc
 // @Summary Update a user by ID
-// @Description Update an existing user's details
+// @Description Replace the name and email of a user. Non-admins can only update their own account. Passwords are changed through PUT /users/me/password.
 // @Tags users
 // @Security BearerAuth
 // @Accept json
 // @Produce json
 // @Param id path string true "User ID"
-// @Param user body models.User true "Update User"
-// @Success 200 {object} map[string]string "message"
-// @Failure 400 {object} map[string]string "error"
-// @Failure 404 {object} map[string]string "error"
+// @Param user body models.UserUpdateDTO true "Update User"
+// @Success 200 {object} models.UserDTO
+// @Failure 400 {object} models.Problem
+// @Failure 403 {object} models.Problem
+// @Failure 404 {object} models.Problem
+// @Failure 409 {object} models.Problem
 // @Router /users/{id} [put]
-func UpdateUser(c *gin.Context) {
-	collection := config.GetCollection("users")
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+func (uc *UserController) UpdateUser(c *gin.Context) {
+	ctx := c.Request.Context()
 
-	id := c.Param("id")
-	objID, err := primitive.ObjectIDFromHex(id)
+	objID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.Error(apperror.BadRequest("invalid_id", "Invalid ID format"))
+		return
+	}
+
+	var updateData struct {
+		models.UserUpdateDTO
+		Password *string `json:"password"`
+	}
+	if !bindJSON(c, &updateData) {
+		return
+	}
+	if updateData.Password != nil {
+		c.Error(apperror.BadRequest("password_not_updatable", errPasswordNotUpdatable))
+		return
+	}
+
+	user, err := uc.users.FindByID(ctx, objID)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.Error(apperror.NotFound("user_not_found", "User not found"))
+		return
+	}
+	if err != nil {
+		c.Error(apperror.Internal("Failed to update user", err))
+		return
+	}
+
+	uc.saveUser(ctx, c, user, updateData.UserUpdateDTO)
+}
+
+// PatchUser godoc
+// @Summary Partially update a user by ID
+// @Description Apply a JSON Merge Patch (RFC 7396) to the name and email of a user. Members left out are unchanged. Non-admins can only update their own account.
+// @Tags users
+// @Security BearerAuth
+// @Accept application/merge-patch+json
+// @Accept json
+// @Produce json
+// @Param id path string true "User ID"
+// @Param patch body models.UserUpdateDTO true "Fields to change"
+// @Success 200 {object} models.UserDTO
+// @Failure 400 {object} models.Problem
+// @Failure 403 {object} models.Problem
+// @Failure 404 {object} models.Problem
+// @Failure 409 {object} models.Problem
+// @Failure 415 {object} models.Problem
+// @Router /users/{id} [patch]
+func (uc *UserController) PatchUser(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	objID, err := primitive.ObjectIDFromHex(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		c.Error(apperror.BadRequest("invalid_id", "Invalid ID format"))
+		return
+	}
+
+	if ct := c.ContentType(); ct != "application/merge-patch+json" && ct != gin.MIMEJSON {
+		c.Error(apperror.New(http.StatusUnsupportedMediaType, "unsupported_media_type", "Content-Type must be application/merge-patch+json"))
 		return
 	}
 
-	var updateData models.User
-	if err := c.ShouldBindJSON(&updateData); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	patch, err := c.GetRawData()
+	if err != nil {
+		c.Error(apperror.BadRequest("invalid_body", "Request body could not be read"))
+		return
+	}
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(patch, &members); err != nil || members == nil {
+		c.Error(apperror.BadRequest("invalid_body", "Request body must be a JSON object"))
+		return
+	}
+	if _, ok := members["password"]; ok {
+		c.Error(apperror.BadRequest("password_not_updatable", errPasswordNotUpdatable))
 		return
 	}
 
-	update := bson.M{
-		"$set": bson.M{
-			"name":     updateData.Name,
-			"email":    updateData.Email,
-			"password": updateData.Password,
-		},
+	user, err := uc.users.FindByID(ctx, objID)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.Error(apperror.NotFound("user_not_found", "User not found"))
+		return
+	}
+	if err != nil {
+		c.Error(apperror.Internal("Failed to update user", err))
+		return
 	}
 
-	_, err = collection.UpdateOne(ctx, bson.M{"_id": objID}, update)
+	// Apply the patch to the updatable fields and validate the result
+	current, _ := json.Marshal(models.UserUpdateDTO{Name: user.Name, Email: user.Email})
+	merged, err := utils.ApplyMergePatch(current, patch)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+		c.Error(invalidBody(err))
+		return
+	}
+
+	var updateData models.UserUpdateDTO
+	decoder := json.NewDecoder(bytes.NewReader(merged))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&updateData); err != nil {
+		c.Error(invalidBody(err))
+		return
+	}
+	if err := validate(&updateData); err != nil {
+		c.Error(invalidBody(err))
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "User updated successfully"})
+	uc.saveUser(ctx, c, user, updateData)
+}
+
+// ChangePassword godoc
+// @Summary Change own password
+// @Description Replace the password of the authenticated user. The current password is required, and every session of the user is signed out afterwards.
+// @Tags users
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param password body models.UpdatePasswordTO true "Current and new password"
+// @Success 200 {object} map[string]string "message"
+// @Failure 400 {object} models.Problem
+// @Failure 401 {object} models.Problem
+// @Failure 403 {object} models.Problem
+// @Router /users/me/password [put]
+func (uc *UserController) ChangePassword(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	claims, ok := currentClaims(c)
+	if !ok {
+		c.Error(apperror.Unauthorized("unauthorized", "Unauthorized"))
+		return
+	}
+	userID, err := primitive.ObjectIDFromHex(claims.UserID)
+	if err != nil {
+		c.Error(apperror.Unauthorized("invalid_token", "Invalid User ID"))
+		return
+	}
+
+	var input models.UpdatePasswordTO
+	if !bindJSON(c, &input) {
+		return
+	}
+
+	user, err := uc.users.FindByID(ctx, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.Error(apperror.Unauthorized("unauthorized", "Unauthorized"))
+		return
+	}
+	if err != nil {
+		c.Error(apperror.Internal("Failed to change password", err))
+		return
+	}
+
+	if err := utils.CheckPassword(input.CurrentPassword, user.Password); err != nil {
+		c.Error(apperror.Forbidden("incorrect_password", "Current password is incorrect"))
+		return
+	}
+	if err := validation.CheckPassword(input.Password, user.Email); err != nil {
+		c.Error(invalidBody(err))
+		return
+	}
+
+	hashedPassword, err := utils.HashPassword(input.Password)
+	if err != nil {
+		c.Error(apperror.Internal("Failed to hash password", err))
+		return
+	}
+	user.Password = hashedPassword
+
+	if err := uc.users.Update(ctx, user); err != nil {
+		c.Error(apperror.Internal("Failed to change password", err))
+		return
+	}
+
+	// Sessions opened with the old password must not outlive it
+	if err := uc.sessions.LogoutAll(ctx, user.ID); err != nil {
+		c.Error(apperror.Internal("Failed to revoke sessions", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password changed successfully, please log in again"})
+}
+
+const errPasswordNotUpdatable = "Password cannot be changed here, use PUT /users/me/password"
+
+// saveUser applies the changes to the user, stores it and writes the
+// response. A new email address has to be verified again.
+func (uc *UserController) saveUser(ctx context.Context, c *gin.Context, user *models.User, changes models.UserUpdateDTO) {
+	emailChanged := user.Email != changes.Email
+	user.Name = changes.Name
+	user.Email = changes.Email
+	if emailChanged {
+		user.EmailVerified = false
+	}
+
+	err := uc.users.Update(ctx, user)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.Error(apperror.NotFound("user_not_found", "User not found"))
+		return
+	}
+	if errors.Is(err, repository.ErrDuplicate) {
+		c.Error(apperror.Conflict("email_in_use", "Email is already in use"))
+		return
+	}
+	if err != nil {
+		c.Error(apperror.Internal("Failed to update user", err))
+		return
+	}
+
+	if emailChanged {
+		if err := uc.accounts.SendVerification(ctx, user); err != nil {
+			log.Printf("Failed to send verification email to %s: %v", user.Email, err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": user.ToDTO()})
 }
 
 // DeleteUser godoc
 // @Summary Delete a user
-// @Description Remove a user from the database
+// @Description Remove a user from the database together with their profile and avatar, and sign out every session. Non-admins can only delete their own account.
 // @Tags users
 // @Security BearerAuth
 // @Param id path string true "User ID"
 // @Success 200 {object} map[string]string
-// @Failure 400 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Failure 400 {object} models.Problem
+// @Failure 403 {object} models.Problem
+// @Failure 404 {object} models.Problem
+// @Failure 500 {object} models.Problem
 // @Router /users/{id} [delete]
-func DeleteUser(c *gin.Context) {
-	collection := config.GetCollection("users")
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+func (uc *UserController) DeleteUser(c *gin.Context) {
+	ctx := c.Request.Context()
 
 	id := c.Param("id")
 	objID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		c.Error(apperror.BadRequest("invalid_id", "Invalid ID format"))
+		return
+	}
+
+	_, err = uc.users.FindByID(ctx, objID)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.Error(apperror.NotFound("user_not_found", "User not found"))
+		return
+	}
+	if err != nil {
+		c.Error(apperror.Internal("Failed to delete user", err))
+		return
+	}
+
+	// Sessions and the profile go first, so a failed request can be retried
+	// while the user still exists. Only the SQL schema cascades.
+	if err := uc.sessions.LogoutAll(ctx, objID); err != nil {
+		c.Error(apperror.Internal("Failed to delete user", err))
+		return
+	}
+	if err := uc.deleteProfile(ctx, objID); err != nil {
+		c.Error(apperror.Internal("Failed to delete user", err))
 		return
 	}
 
-	_, err = collection.DeleteOne(ctx, bson.M{"_id": objID})
+	err = uc.users.Delete(ctx, objID)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.Error(apperror.NotFound("user_not_found", "User not found"))
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user"})
+		c.Error(apperror.Internal("Failed to delete user", err))
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
 }
 
+// deleteProfile removes the profile of the user and its avatar images, if
+// there is one
+func (uc *UserController) deleteProfile(ctx context.Context, userID primitive.ObjectID) error {
+	profile, err := uc.profiles.FindByUserID(ctx, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := uc.profiles.DeleteByUserID(ctx, userID); err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return err
+	}
+	uc.avatars.Delete(ctx, profile)
+	return nil
+}
+
 // LoginUser godoc
 // @Summary Login user
-// @Description Authenticate user with email and password
+// @Description Authenticate user with email and password. Returns a short-lived access token and a refresh token. For accounts with two-factor authentication, returns an MFA challenge token to exchange at /auth/mfa/verify instead. Repeated failures lock the account and the client address for a growing period.
 // @Tags auth
 // @Accept json
 // @Produce json
 // @Param login body models.LoginDTO true "Login details"
-// @Success 200 {object} map[string]string
-// @Failure 400 {object} map[string]string
-// @Failure 401 {object} map[string]string
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} models.Problem
+// @Failure 401 {object} models.Problem
+// @Failure 403 {object} models.Problem
+// @Failure 429 {object} models.Problem
 // @Router /users/login [post]
-func LoginUser(c *gin.Context) {
+func (uc *UserController) LoginUser(c *gin.Context) {
 	var loginData models.LoginDTO
-	if err := c.ShouldBindJSON(&loginData); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &loginData) {
 		return
 	}
 
-	collection := config.GetCollection("users")
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+	ctx := c.Request.Context()
 
-	var user models.User
-	err := collection.FindOne(ctx, bson.M{"email": loginData.Email}).Decode(&user)
+	// Locked accounts and addresses are turned away before the password is checked
+	if err := uc.guard.Check(ctx, loginData.Email, c.ClientIP()); err != nil {
+		if respondLocked(c, err) {
+			metrics.Logins.WithLabelValues(metrics.LoginStepPassword, metrics.LoginLocked).Inc()
+		} else {
+			c.Error(apperror.Internal("Failed to login", err))
+		}
+		return
+	}
+
+	user, err := uc.users.FindByEmail(ctx, loginData.Email)
+	if errors.Is(err, repository.ErrNotFound) {
+		// Take as long as a wrong password so the response time does not
+		// tell which emails are registered
+		utils.CheckPassword(loginData.Password, dummyPasswordHash)
+		uc.loginFailed(ctx, c, loginData.Email)
+		return
+	}
+	// An unavailable database is not a wrong password
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+		c.Error(apperror.Internal("Failed to login", err))
 		return
 	}
 
 	// Verifikasi password
 	if err := utils.CheckPassword(loginData.Password, user.Password); err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+		uc.loginFailed(ctx, c, loginData.Email)
+		return
+	}
+
+	if err := uc.accounts.CheckLogin(user); err != nil {
+		c.Error(apperror.Forbidden("email_not_verified", "Email address is not verified"))
+		return
+	}
+
+	// The session is only started once the second factor is verified
+	if user.MFAEnabled {
+		challenge, err := uc.mfa.Challenge(user)
+		if err != nil {
+			c.Error(apperror.Internal("Failed to generate token", err))
+			return
+		}
+		metrics.Logins.WithLabelValues(metrics.LoginStepPassword, metrics.LoginMFARequired).Inc()
+		c.JSON(http.StatusOK, challenge)
 		return
 	}
 
-	// Generate token with user ID and email
-	token, err := utils.GenerateToken(user.ID.Hex(), user.Email)
+	// Generate access and refresh tokens
+	tokens, err := uc.sessions.Start(ctx, user)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		c.Error(apperror.Internal("Failed to generate token", err))
 		return
 	}
 
+	// Failures are only cleared once a session is issued; with two-factor
+	// authentication the MFA service does so after a valid code
+	if err := uc.guard.Succeed(ctx, loginData.Email); err != nil {
+		log.Printf("Failed to clear login failures of %s: %v", loginData.Email, err)
+	}
+
+	metrics.Logins.WithLabelValues(metrics.LoginStepPassword, metrics.LoginSuccess).Inc()
 	c.JSON(http.StatusOK, gin.H{
-		"message": "Login successful",
-		"id": user.ID.Hex(),
-		"email": user.Email,
-		"token":   token,
+		"message":       "Login successful",
+		"id":            user.ID.Hex(),
+		"email":         user.Email,
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"token_type":    tokens.TokenType,
+		"expires_in":    tokens.ExpiresIn,
 	})
-}
\ No newline at end of file
+}
+
+// dummyPasswordHash is checked on logins with unknown emails. It has the
+// cost of utils.HashPassword; its password is not used anywhere.
+const dummyPasswordHash = "$2a$10$.a2645uPQnmxMsKTNLOjF.n5cK/r9kNyayJtG1nCNxR6.gcBw1Ktq"
+
+// loginFailed counts a failed login and responds 401, or 429 when the
+// failure locked the account or the client address
+func (uc *UserController) loginFailed(ctx context.Context, c *gin.Context, email string) {
+	err := uc.guard.Fail(ctx, email, c.ClientIP())
+	if respondLocked(c, err) {
+		metrics.Logins.WithLabelValues(metrics.LoginStepPassword, metrics.LoginLocked).Inc()
+		return
+	}
+	metrics.Logins.WithLabelValues(metrics.LoginStepPassword, metrics.LoginFailure).Inc()
+	if err != nil {
+		log.Printf("Failed to record failed login of %s: %v", email, err)
+	}
+	c.Error(apperror.Unauthorized("invalid_credentials", "Invalid email or password"))
+}
+
+// UnlockUser godoc
+// @Summary Unlock user
+// @Description Lift the lockout of an account after too many failed logins and clear its failed attempts (admin only)
+// @Tags users
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} models.Problem
+// @Failure 401 {object} models.Problem
+// @Failure 403 {object} models.Problem
+// @Failure 404 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Router /users/{id}/unlock [post]
+func (uc *UserController) UnlockUser(c *gin.Context) {
+	objID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.Error(apperror.BadRequest("invalid_id", "Invalid ID format"))
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	user, err := uc.users.FindByID(ctx, objID)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.Error(apperror.NotFound("user_not_found", "User not found"))
+		return
+	}
+	if err != nil {
+		c.Error(apperror.Internal("Failed to fetch user", err))
+		return
+	}
+
+	if err := uc.guard.Unlock(ctx, user.Email); err != nil {
+		c.Error(apperror.Internal("Failed to unlock user", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User unlocked successfully"})
+}
@@ -0,0 +1,28 @@
+package controllers
+
+import (
+	"testing"
+
+	"go-restful-api/utils"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestDummyPasswordHash(t *testing.T) {
+	hash, err := utils.HashPassword("correct horse battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := bcrypt.Cost([]byte(hash))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Unknown emails only take as long as wrong passwords with the same cost
+	got, err := bcrypt.Cost([]byte(dummyPasswordHash))
+	if err != nil {
+		t.Fatalf("dummyPasswordHash is not a bcrypt hash: %v", err)
+	}
+	if got != want {
+		t.Errorf("dummyPasswordHash cost = %d, want %d like utils.HashPassword", got, want)
+	}
+}
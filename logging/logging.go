@@ -0,0 +1,111 @@
+// Package logging sets up the structured JSON logger of the server and
+// keeps credentials out of it
+package logging
+
+import (
+	"io"
+	"log/slog"
+	"maps"
+	"net/url"
+	"slices"
+	"strings"
+
+	"go-restful-api/config"
+)
+
+// Redacted replaces the values of sensitive fields
+const Redacted = "[REDACTED]"
+
+// defaultRedactFields are never logged, whatever the configuration says
+var defaultRedactFields = []string{
+	"authorization", "proxy-authorization", "cookie", "set-cookie",
+	"password", "current_password", "new_password",
+	"token", "refresh_token", "mfa_token", "code", "recovery_codes",
+	"secret", "totp_secret",
+}
+
+// New creates a JSON logger with the configured level that redacts
+// sensitive attributes. The level was checked by config.Validate.
+func New(cfg config.LogConfig, w io.Writer) *slog.Logger {
+	var level slog.Level
+	_ = level.UnmarshalText([]byte(cfg.Level))
+
+	redactor := NewRedactor(cfg.RedactFields)
+	return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: redactor.ReplaceAttr,
+	}))
+}
+
+// Redactor blanks the values of sensitive fields. Field names are matched
+// case-insensitively.
+type Redactor struct {
+	fields map[string]bool
+}
+
+// NewRedactor creates a Redactor for the default fields and the extra ones
+func NewRedactor(extra []string) *Redactor {
+	r := &Redactor{fields: make(map[string]bool)}
+	for _, field := range slices.Concat(defaultRedactFields, extra) {
+		r.fields[strings.ToLower(field)] = true
+	}
+	return r
+}
+
+// Sensitive reports whether values of the field must not be logged
+func (r *Redactor) Sensitive(field string) bool {
+	return r.fields[strings.ToLower(field)]
+}
+
+// ReplaceAttr is a slog.HandlerOptions.ReplaceAttr that redacts sensitive attributes
+func (r *Redactor) ReplaceAttr(groups []string, a slog.Attr) slog.Attr {
+	if a.Value.Kind() != slog.KindGroup && r.Sensitive(a.Key) {
+		return slog.String(a.Key, Redacted)
+	}
+	return a
+}
+
+// Value returns a copy of a decoded JSON value with sensitive object members redacted
+func (r *Redactor) Value(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for key, value := range v {
+			if r.Sensitive(key) {
+				out[key] = Redacted
+			} else {
+				out[key] = r.Value(value)
+			}
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, value := range v {
+			out[i] = r.Value(value)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// Query returns the query string with the values of sensitive parameters redacted
+func (r *Redactor) Query(values url.Values) string {
+	keys := slices.Sorted(maps.Keys(values))
+	var b strings.Builder
+	for _, key := range keys {
+		for _, value := range values[key] {
+			if b.Len() > 0 {
+				b.WriteByte('&')
+			}
+			b.WriteString(url.QueryEscape(key))
+			b.WriteByte('=')
+			if r.Sensitive(key) {
+				b.WriteString(Redacted)
+			} else {
+				b.WriteString(url.QueryEscape(value))
+			}
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,22 @@
+package mail
+
+import (
+	"context"
+	"log"
+)
+
+// LogMailer prints messages to the log instead of sending them. It is meant
+// for local development.
+type LogMailer struct {
+	from string
+}
+
+// NewLogMailer creates a LogMailer
+func NewLogMailer(from string) *LogMailer {
+	return &LogMailer{from: from}
+}
+
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	log.Printf("Mail from %s to %s: %s\n%s", m.from, msg.To, msg.Subject, msg.Body)
+	return nil
+}
@@ -0,0 +1,60 @@
+// Package mail delivers the emails sent by the account workflows
+package mail
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"strings"
+	"time"
+
+	"go-restful-api/config"
+)
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends email messages
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// New creates the Mailer selected by the configuration
+func New(cfg config.MailConfig) (Mailer, error) {
+	switch cfg.Driver {
+	case config.MailLog:
+		return NewLogMailer(cfg.From), nil
+	case config.MailFile:
+		return NewFileMailer(cfg.Dir, cfg.From)
+	case config.MailSMTP:
+		return NewSMTPMailer(cfg.SMTP, cfg.From), nil
+	default:
+		return nil, fmt.Errorf("unknown mail driver %q", cfg.Driver)
+	}
+}
+
+// format renders the message in RFC 5322 format with CRLF line endings
+func format(from string, msg Message) []byte {
+	var b strings.Builder
+	header := func(name, value string) {
+		// Header values never span lines, so user data cannot inject headers
+		value = strings.NewReplacer("\r", "", "\n", "").Replace(value)
+		b.WriteString(name + ": " + value + "\r\n")
+	}
+
+	header("From", from)
+	header("To", msg.To)
+	header("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=utf-8")
+	b.WriteString("\r\n")
+
+	body := strings.ReplaceAll(msg.Body, "\r\n", "\n")
+	b.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	return []byte(b.String())
+}
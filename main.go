@@ -1,13 +1,11 @@
 package main
 
 import (
-	"github.com/gin-gonic/gin"
-	_ "go-restful-api/docs" // Import generated Swagger docs
-	"go-restful-api/config"
-	"go-restful-api/routes"
+	"log"
+	"os"
 
-	swaggerFiles "github.com/swaggo/files"
-	ginSwagger "github.com/swaggo/gin-swagger"
+	"go-restful-api/cli"
+	_ "go-restful-api/docs" // Import generated Swagger docs
 )
 
 // @title Go RESTful API Example
@@ -29,24 +27,7 @@ import (
 // @host localhost:8080
 // @BasePath /api/v1
 func main() {
-	// Connect to MongoDB
-	config.ConnectDatabase()
-
-	// Set up Gin router
-	router := gin.Default()
-
-	// Add Swagger UI at /api/v1/swagger/*
-	swaggerURL := ginSwagger.URL("http://localhost:8080/api/v1/swagger/doc.json") // Adjust Swagger base path
-	router.GET("/api/v1/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler, swaggerURL))
-
-	// Group routes under /api/v1
-	api := router.Group("/api/v1")
-	{
-		// Register user routes within the /api/v1 group
-		routes.RegisterUserRoutes(api)
-		routes.RegiterProfileRoutes(api)
+	if err := cli.Run(os.Args[1:]); err != nil {
+		log.Fatal(err)
 	}
-
-	// Start the server
-	router.Run(":8080")
 }
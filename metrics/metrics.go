@@ -0,0 +1,105 @@
+// Package metrics defines the Prometheus metrics of the server
+package metrics
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Login steps and results counted by Logins
+const (
+	LoginStepPassword = "password"
+	LoginStepMFA      = "mfa"
+
+	LoginSuccess     = "success"
+	LoginFailure     = "failure"
+	LoginLocked      = "locked"
+	LoginMFARequired = "mfa_required"
+)
+
+// Token validation failure reasons counted by TokenValidationFailures
+const (
+	TokenMissing   = "missing"
+	TokenMalformed = "malformed"
+	TokenInvalid   = "invalid"
+	TokenRevoked   = "revoked"
+)
+
+// Registry holds every metric of the server, including the Go runtime and
+// process collectors
+var Registry = prometheus.NewRegistry()
+
+var factory = promauto.With(Registry)
+
+var (
+	// HTTPRequestDuration observes request latency by method, route template and status
+	HTTPRequestDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Latency of HTTP requests by method, route template and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	// Logins counts logins by step, password or mfa, and result: success,
+	// failure, locked or mfa_required for passwords accepted pending the
+	// second factor
+	Logins = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_logins_total",
+		Help: "Logins and second factor verifications by result.",
+	}, []string{"step", "result"})
+
+	// TokenValidationFailures counts requests AuthMiddleware turned away, by reason
+	TokenValidationFailures = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_token_validation_failures_total",
+		Help: "Requests rejected for a missing, malformed, invalid or revoked access token.",
+	}, []string{"reason"})
+
+	// Registrations counts created accounts
+	Registrations = factory.NewCounter(prometheus.CounterOpts{
+		Name: "user_registrations_total",
+		Help: "Accounts created through registration.",
+	})
+
+	// DBOperationDuration observes database operation latency by system and operation
+	DBOperationDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "db_operation_duration_seconds",
+		Help:    "Latency of MongoDB commands and SQL statements by database system and operation.",
+		Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"system", "operation"})
+
+	// DBOperationErrors counts failed database operations by system and operation
+	DBOperationErrors = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "db_operation_errors_total",
+		Help: "Failed MongoDB commands and SQL statements by database system and operation.",
+	}, []string{"system", "operation"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Handler serves the metrics in the Prometheus exposition format. With a
+// token, scrapers have to send it as a bearer token.
+func Handler(token string) http.Handler {
+	handler := promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+	if token == "" {
+		return handler
+	}
+
+	expected := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
@@ -1,37 +1,57 @@
 package middleware
 
 import (
-	"net/http"
+	"context"
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"go-restful-api/apperror"
+	"go-restful-api/metrics"
+	"go-restful-api/models"
 	"go-restful-api/utils"
 )
 
-// AuthMiddleware checks the Authorization header for a valid token
-func AuthMiddleware() gin.HandlerFunc {
+// RevocationChecker reports whether a validated token has been revoked
+type RevocationChecker interface {
+	IsRevoked(ctx context.Context, claims *models.Claims) (bool, error)
+}
+
+// AuthMiddleware checks the Authorization header for a valid, unrevoked token
+func AuthMiddleware(tokens *utils.TokenManager, revocations RevocationChecker) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Get the token from the Authorization header
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
-			c.Abort()
+			metrics.TokenValidationFailures.WithLabelValues(metrics.TokenMissing).Inc()
+			abortWithError(c, apperror.Unauthorized("authorization_required", "Authorization header required"))
 			return
 		}
 
 		// Check if the token starts with "Bearer "
 		token := strings.TrimPrefix(authHeader, "Bearer ")
 		if token == authHeader { // If Bearer is missing
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Bearer token required"})
-			c.Abort()
+			metrics.TokenValidationFailures.WithLabelValues(metrics.TokenMalformed).Inc()
+			abortWithError(c, apperror.Unauthorized("bearer_token_required", "Bearer token required"))
 			return
 		}
 
 		// Validate the token
-		claims, err := utils.ValidateToken(token)
+		claims, err := tokens.ValidateToken(token)
+		if err != nil {
+			metrics.TokenValidationFailures.WithLabelValues(metrics.TokenInvalid).Inc()
+			abortWithError(c, apperror.Unauthorized("invalid_token", "Invalid or expired token"))
+			return
+		}
+
+		// Reject tokens revoked by logout
+		revoked, err := revocations.IsRevoked(c.Request.Context(), claims)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
-			c.Abort()
+			abortWithError(c, apperror.Internal("Failed to verify token", err))
+			return
+		}
+		if revoked {
+			metrics.TokenValidationFailures.WithLabelValues(metrics.TokenRevoked).Inc()
+			abortWithError(c, apperror.Unauthorized("token_revoked", "Token has been revoked"))
 			return
 		}
 
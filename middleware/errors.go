@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go-restful-api/apperror"
+	"go-restful-api/models"
+)
+
+// problemContentType is the media type of RFC 7807 problem details
+const problemContentType = "application/problem+json"
+
+// Errors renders the last error attached with c.Error as problem+json.
+// *apperror.Error values are rendered as they are; any other error becomes
+// a 500 that does not reveal it, or a 504/499 when the request ran out of
+// time or lost its client. It must run after Timeout so the deadline is
+// still in force when it checks.
+func Errors() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		if c.Writer.Written() {
+			return
+		}
+
+		var err error
+		if last := c.Errors.Last(); last != nil {
+			err = last.Err
+		} else if ctxErr := c.Request.Context().Err(); ctxErr != nil {
+			// The handler gave up without answering
+			err = ctxErr
+		} else {
+			return
+		}
+		writeProblem(c, problemError(c, err))
+	}
+}
+
+// Recovery answers a panicking request with a 500 problem. It must run after
+// Errors, which renders the response.
+func Recovery() gin.HandlerFunc {
+	return gin.CustomRecovery(func(c *gin.Context, recovered any) {
+		c.Error(fmt.Errorf("panic: %v", recovered))
+		c.Abort()
+	})
+}
+
+// abortWithError attaches err for Errors to render and stops the chain
+func abortWithError(c *gin.Context, err error) {
+	c.Error(err)
+	c.Abort()
+}
+
+func problemError(c *gin.Context, err error) *apperror.Error {
+	var appErr *apperror.Error
+	if errors.As(err, &appErr) && appErr.Status < http.StatusInternalServerError {
+		return appErr
+	}
+
+	// Operations fail when their context is done; that is not a server error
+	switch ctxErr := c.Request.Context().Err(); {
+	case errors.Is(ctxErr, context.DeadlineExceeded):
+		return apperror.Timeout(err)
+	case ctxErr != nil:
+		return apperror.ClientClosed(err)
+	}
+
+	if appErr != nil {
+		return appErr
+	}
+	return apperror.Internal("Internal server error", err)
+}
+
+func writeProblem(c *gin.Context, e *apperror.Error) {
+	problem := models.Problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(e.Status),
+		Status:    e.Status,
+		Detail:    e.Detail,
+		Instance:  c.Request.URL.Path,
+		Code:      e.Code,
+		RequestID: c.GetString(requestIDKey),
+		Errors:    e.Fields,
+	}
+	if e.Status == apperror.StatusClientClosedRequest {
+		problem.Title = "Client Closed Request"
+	}
+	if e.RetryAfter > 0 {
+		problem.RetryAfter = ceilSeconds(e.RetryAfter)
+		c.Header("Retry-After", strconv.Itoa(problem.RetryAfter))
+	}
+
+	c.Header("Content-Type", problemContentType)
+	c.JSON(e.Status, problem)
+}
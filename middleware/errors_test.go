@@ -0,0 +1,206 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go-restful-api/apperror"
+	"go-restful-api/models"
+)
+
+// withContext replaces the request context, as Timeout does, and returns
+// the new one
+func withContext(c *gin.Context, wrap func(context.Context) context.Context) context.Context {
+	ctx := wrap(c.Request.Context())
+	c.Request = c.Request.WithContext(ctx)
+	return ctx
+}
+
+// expired gives the request a deadline that has already passed
+func expired(ctx context.Context) context.Context {
+	ctx, cancel := context.WithDeadline(ctx, time.Now().Add(-time.Second))
+	// The context is already done, canceling keeps its DeadlineExceeded
+	cancel()
+	return ctx
+}
+
+// canceled stands for a client that went away
+func canceled(ctx context.Context) context.Context {
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	return ctx
+}
+
+func TestErrors(t *testing.T) {
+	// Keep the stack trace of the recovered panic out of the test output
+	errorWriter := gin.DefaultErrorWriter
+	gin.DefaultErrorWriter = io.Discard
+	t.Cleanup(func() { gin.DefaultErrorWriter = errorWriter })
+
+	tests := []struct {
+		name           string
+		handler        gin.HandlerFunc
+		wantStatus     int
+		wantCode       string
+		wantDetail     string
+		wantRetryAfter string
+		wantFields     int
+	}{
+		{
+			name: "application error",
+			handler: func(c *gin.Context) {
+				c.Error(apperror.NotFound("user_not_found", "User not found"))
+			},
+			wantStatus: http.StatusNotFound,
+			wantCode:   "user_not_found",
+			wantDetail: "User not found",
+		},
+		{
+			name: "other errors are hidden",
+			handler: func(c *gin.Context) {
+				c.Error(errors.New("connection refused"))
+			},
+			wantStatus: http.StatusInternalServerError,
+			wantCode:   "internal_error",
+			wantDetail: "Internal server error",
+		},
+		{
+			name: "internal error keeps its detail",
+			handler: func(c *gin.Context) {
+				c.Error(apperror.Internal("Failed to delete user", errors.New("connection refused")))
+			},
+			wantStatus: http.StatusInternalServerError,
+			wantCode:   "internal_error",
+			wantDetail: "Failed to delete user",
+		},
+		{
+			name: "validation fields",
+			handler: func(c *gin.Context) {
+				c.Error(apperror.Validation(
+					models.FieldError{Field: "email", Rule: "email", Message: "must be a valid email address"},
+					models.FieldError{Field: "name", Rule: "required", Message: "is required"},
+				))
+			},
+			wantStatus: http.StatusBadRequest,
+			wantCode:   "validation_failed",
+			wantDetail: "The request has invalid fields",
+			wantFields: 2,
+		},
+		{
+			name: "retry after is rounded up",
+			handler: func(c *gin.Context) {
+				c.Error(apperror.TooManyRequests("rate_limited", "Too many requests", 1500*time.Millisecond))
+			},
+			wantStatus:     http.StatusTooManyRequests,
+			wantCode:       "rate_limited",
+			wantDetail:     "Too many requests",
+			wantRetryAfter: "2",
+		},
+		{
+			name: "deadline exceeded",
+			handler: func(c *gin.Context) {
+				ctx := withContext(c, expired)
+				c.Error(apperror.Internal("Failed to fetch users", ctx.Err()))
+			},
+			wantStatus: http.StatusGatewayTimeout,
+			wantCode:   "timeout",
+			wantDetail: "Request timed out",
+		},
+		{
+			name: "no answer after the deadline",
+			handler: func(c *gin.Context) {
+				withContext(c, expired)
+			},
+			wantStatus: http.StatusGatewayTimeout,
+			wantCode:   "timeout",
+			wantDetail: "Request timed out",
+		},
+		{
+			name: "client closed the request",
+			handler: func(c *gin.Context) {
+				ctx := withContext(c, canceled)
+				c.Error(ctx.Err())
+			},
+			wantStatus: apperror.StatusClientClosedRequest,
+			wantCode:   "client_closed_request",
+			wantDetail: "Client closed the request",
+		},
+		{
+			name: "client errors win over the deadline",
+			handler: func(c *gin.Context) {
+				withContext(c, expired)
+				c.Error(apperror.Forbidden("forbidden", "Insufficient permissions"))
+			},
+			wantStatus: http.StatusForbidden,
+			wantCode:   "forbidden",
+			wantDetail: "Insufficient permissions",
+		},
+		{
+			name: "panic",
+			handler: func(c *gin.Context) {
+				panic("boom")
+			},
+			wantStatus: http.StatusInternalServerError,
+			wantCode:   "internal_error",
+			wantDetail: "Internal server error",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.Use(Errors(), Recovery())
+			router.GET("/users/:id", tt.handler)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users/1", nil))
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := w.Header().Get("Content-Type"); got != problemContentType {
+				t.Errorf("Content-Type = %q, want %q", got, problemContentType)
+			}
+			if got := w.Header().Get("Retry-After"); got != tt.wantRetryAfter {
+				t.Errorf("Retry-After = %q, want %q", got, tt.wantRetryAfter)
+			}
+
+			var problem models.Problem
+			if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+				t.Fatalf("body %s: %v", w.Body, err)
+			}
+			if problem.Status != tt.wantStatus || problem.Code != tt.wantCode || problem.Detail != tt.wantDetail {
+				t.Errorf("problem = %+v, want status %d, code %q and detail %q", problem, tt.wantStatus, tt.wantCode, tt.wantDetail)
+			}
+			if problem.Type != "about:blank" || problem.Title == "" || problem.Instance != "/users/1" {
+				t.Errorf("problem = %+v, want type about:blank, a title and instance /users/1", problem)
+			}
+			if len(problem.Errors) != tt.wantFields {
+				t.Errorf("%d field errors, want %d", len(problem.Errors), tt.wantFields)
+			}
+		})
+	}
+}
+
+func TestErrorsKeepsWrittenResponses(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Errors())
+	router.GET("/", func(c *gin.Context) {
+		c.JSON(http.StatusAccepted, gin.H{"message": "queued"})
+		c.Error(errors.New("logged only"))
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusAccepted || w.Header().Get("Content-Type") == problemContentType {
+		t.Errorf("response = %d %s, want the handler's 202", w.Code, w.Body)
+	}
+}
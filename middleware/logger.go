@@ -1,23 +1,143 @@
 package middleware
 
 import (
-    "time"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"strings"
+	"time"
 
-    "github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin"
+	"go-restful-api/config"
+	"go-restful-api/logging"
+	"go-restful-api/models"
+	"go.opentelemetry.io/otel/trace"
 )
 
-func LoggerMiddleware() gin.HandlerFunc {
-    return func(c *gin.Context) {
-        start := time.Now()
-        c.Next()
-        duration := time.Since(start)
+// maxLoggedBody caps the request bodies logged at debug level
+const maxLoggedBody = 4 << 10
 
-        // Log request details
-        method := c.Request.Method
-        path := c.Request.URL.Path
-        status := c.Writer.Status()
+// LoggerMiddleware writes one structured log line per request after it was
+// handled. It only reads the response, so it never changes what the client
+// receives. Successful requests are sampled with cfg.SampleRate; 4xx and 5xx
+// responses are always logged, as warnings and errors. At debug level the
+// request headers and JSON body are logged too, with credentials redacted.
+// Register it after RequestID and Tracing, so the line carries the request
+// and trace IDs, and before gin.Recovery so recovered panics are logged as 500s.
+func LoggerMiddleware(logger *slog.Logger, cfg config.LogConfig) gin.HandlerFunc {
+	redactor := logging.NewRedactor(cfg.RedactFields)
 
-        c.Writer.Header().Set("X-Response-Time", duration.String())
-        c.JSON(status, gin.H{"method": method, "path": path, "duration": duration.String()})
-    }
+	return func(c *gin.Context) {
+		start := time.Now()
+		ctx := c.Request.Context()
+		debug := logger.Enabled(ctx, slog.LevelDebug)
+
+		var body []byte
+		if debug {
+			body = peekBody(c)
+		}
+
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= 500:
+			level = slog.LevelError
+		case status >= 400:
+			level = slog.LevelWarn
+		case cfg.SampleRate < 1 && rand.Float64() >= cfg.SampleRate:
+			return
+		}
+		if !logger.Enabled(ctx, level) {
+			return
+		}
+
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("path", c.Request.URL.Path),
+			slog.String("route", c.FullPath()),
+			slog.Int("status", status),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.Int("bytes", max(c.Writer.Size(), 0)),
+			slog.String("client_ip", c.ClientIP()),
+			slog.String("user_agent", c.Request.UserAgent()),
+		}
+		if query := redactor.Query(c.Request.URL.Query()); query != "" {
+			attrs = append(attrs, slog.String("query", query))
+		}
+		if userID := loggedUserID(c); userID != "" {
+			attrs = append(attrs, slog.String("user_id", userID))
+		}
+		if requestID := c.GetString(requestIDKey); requestID != "" {
+			attrs = append(attrs, slog.String("request_id", requestID))
+		}
+		if span := trace.SpanContextFromContext(c.Request.Context()); span.IsValid() {
+			attrs = append(attrs, slog.String("trace_id", span.TraceID().String()), slog.String("span_id", span.SpanID().String()))
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String("errors", c.Errors.String()))
+		}
+		if debug {
+			attrs = append(attrs, headerAttr(c), bodyAttr(body, redactor))
+		}
+
+		logger.LogAttrs(context.WithoutCancel(ctx), level, "request", attrs...)
+	}
+}
+
+func loggedUserID(c *gin.Context) string {
+	userData, ok := c.Get("user")
+	if !ok {
+		return ""
+	}
+	claims, ok := userData.(*models.Claims)
+	if !ok {
+		return ""
+	}
+	return claims.UserID
+}
+
+// peekBody reads the start of a JSON request body and puts it back for the handler
+func peekBody(c *gin.Context) []byte {
+	if c.Request.Body == nil || !strings.Contains(c.ContentType(), "json") {
+		return nil
+	}
+	head, err := io.ReadAll(io.LimitReader(c.Request.Body, maxLoggedBody))
+	if err != nil {
+		return nil
+	}
+	c.Request.Body = readCloser{io.MultiReader(bytes.NewReader(head), c.Request.Body), c.Request.Body}
+	return head
+}
+
+// headerAttr logs the request headers; the ReplaceAttr of the logger redacts credentials
+func headerAttr(c *gin.Context) slog.Attr {
+	attrs := make([]any, 0, len(c.Request.Header))
+	for name, values := range c.Request.Header {
+		attrs = append(attrs, slog.String(strings.ToLower(name), strings.Join(values, ", ")))
+	}
+	return slog.Group("headers", attrs...)
+}
+
+// bodyAttr logs a JSON body with sensitive members redacted. Bodies that are
+// cut off or not valid JSON are left out, as they could not be redacted.
+func bodyAttr(body []byte, redactor *logging.Redactor) slog.Attr {
+	if len(body) == 0 {
+		return slog.Attr{}
+	}
+	var decoded any
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		return slog.String("body", "[unparsed]")
+	}
+	return slog.Any("body", redactor.Value(decoded))
+}
+
+// readCloser reads from r and closes the original body
+type readCloser struct {
+	io.Reader
+	io.Closer
 }
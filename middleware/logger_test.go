@@ -0,0 +1,126 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go-restful-api/config"
+	"go-restful-api/logging"
+)
+
+// serveLogged sends one request through LoggerMiddleware to a handler that
+// echoes the request body, and returns the response and the log output
+func serveLogged(t *testing.T, cfg config.LogConfig, status int, req *http.Request) (*httptest.ResponseRecorder, string) {
+	t.Helper()
+	var logs bytes.Buffer
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(LoggerMiddleware(logging.New(cfg, &logs), cfg))
+	router.POST("/users/login", func(c *gin.Context) {
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Data(status, "application/json", body)
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w, logs.String()
+}
+
+func newLoginRequest(body string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/users/login?token=query-secret&page=2", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer header-secret")
+	return req
+}
+
+func TestLoggerMiddlewareLeavesResponseAlone(t *testing.T) {
+	const body = `{"email":"ann@example.com","password":"body-secret"}`
+
+	tests := []struct {
+		name   string
+		level  string
+		status int
+	}{
+		{"info", "info", http.StatusOK},
+		{"debug", "debug", http.StatusOK},
+		{"debug error", "debug", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, _ := serveLogged(t, config.LogConfig{Level: tt.level, SampleRate: 1}, tt.status, newLoginRequest(body))
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			// The handler got the whole body, and the client got it once
+			if got := w.Body.String(); got != body {
+				t.Errorf("response body = %q, want %q", got, body)
+			}
+		})
+	}
+}
+
+func TestLoggerMiddlewareRedacts(t *testing.T) {
+	body := `{"email":"ann@example.com","password":"body-secret","mfa":{"code":"nested-secret"},"employee_id":"custom-secret"}`
+	cfg := config.LogConfig{Level: "debug", SampleRate: 1, RedactFields: []string{"employee_id"}}
+	_, logs := serveLogged(t, cfg, http.StatusOK, newLoginRequest(body))
+
+	for _, secret := range []string{"header-secret", "query-secret", "body-secret", "nested-secret", "custom-secret"} {
+		if strings.Contains(logs, secret) {
+			t.Errorf("log contains %q: %s", secret, logs)
+		}
+	}
+
+	var line struct {
+		Query   string            `json:"query"`
+		Headers map[string]string `json:"headers"`
+		Body    map[string]any    `json:"body"`
+	}
+	if err := json.Unmarshal([]byte(logs), &line); err != nil {
+		t.Fatalf("log %q: %v", logs, err)
+	}
+	if got := line.Headers["authorization"]; got != logging.Redacted {
+		t.Errorf("authorization header = %q, want %q", got, logging.Redacted)
+	}
+	if got := line.Body["password"]; got != logging.Redacted {
+		t.Errorf("password = %v, want %q", got, logging.Redacted)
+	}
+	// Other values stay readable
+	if got := line.Body["email"]; got != "ann@example.com" {
+		t.Errorf("email = %v, want it logged", got)
+	}
+	if !strings.Contains(line.Query, "page=2") {
+		t.Errorf("query = %q, want page=2 kept", line.Query)
+	}
+}
+
+func TestLoggerMiddlewareSampling(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		wantLog string
+	}{
+		{"success sampled out", http.StatusOK, ""},
+		{"client error always logged", http.StatusNotFound, `"level":"WARN"`},
+		{"server error always logged", http.StatusInternalServerError, `"level":"ERROR"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, logs := serveLogged(t, config.LogConfig{Level: "info", SampleRate: 0}, tt.status, newLoginRequest(`{}`))
+			if tt.wantLog == "" && logs != "" {
+				t.Errorf("logged %s, want nothing", logs)
+			}
+			if !strings.Contains(logs, tt.wantLog) {
+				t.Errorf("log = %s, want %s", logs, tt.wantLog)
+			}
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go-restful-api/apperror"
+	"go-restful-api/config"
+	"go-restful-api/models"
+	"go-restful-api/repository"
+)
+
+// rateLimitRetries bounds the optimistic concurrency retries of one request
+const rateLimitRetries = 5
+
+// rateLimitDecision is the outcome of counting one request against a policy
+type rateLimitDecision struct {
+	allowed   bool
+	remaining int
+	// reset is the time until the quota is fully available again
+	reset time.Duration
+	// retryAfter is the time until the next request is allowed, when denied
+	retryAfter time.Duration
+}
+
+// RateLimit throttles requests with the policy. Counters are kept per key,
+// the client IP or the authenticated user, under the policy name, so
+// policies of nested groups are counted independently. Responses carry
+// RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset and RateLimit-Policy
+// headers; rejected requests get 429 with Retry-After. Policies keyed by
+// user must run after AuthMiddleware. When the store fails, requests are let
+// through rather than taking the API down with it.
+func RateLimit(name string, policy config.RateLimitPolicy, store repository.RateLimitRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := name + ":" + rateLimitKey(c, policy.Key)
+
+		decision, err := takeRateLimit(c.Request.Context(), store, policy, key, time.Now())
+		if err != nil {
+			log.Printf("Rate limit %s unavailable: %v", name, err)
+			c.Next()
+			return
+		}
+
+		c.Header("RateLimit-Limit", strconv.Itoa(policy.Limit))
+		c.Header("RateLimit-Remaining", strconv.Itoa(decision.remaining))
+		c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(decision.reset)))
+		c.Header("RateLimit-Policy", fmt.Sprintf("%d;w=%d", policy.Limit, ceilSeconds(policy.Period)))
+
+		if !decision.allowed {
+			abortWithError(c, apperror.TooManyRequests("rate_limited", "Too many requests, please try again later", decision.retryAfter))
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// rateLimitKey identifies the client: the user ID for user policies on
+// authenticated requests, the client IP otherwise
+func rateLimitKey(c *gin.Context, kind string) string {
+	if kind == config.RateLimitKeyUser {
+		if userData, ok := c.Get("user"); ok {
+			if claims, ok := userData.(*models.Claims); ok && claims.UserID != "" {
+				return "user:" + claims.UserID
+			}
+		}
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// takeRateLimit counts one request, retrying when another request updated
+// the bucket in between
+func takeRateLimit(ctx context.Context, store repository.RateLimitRepository, policy config.RateLimitPolicy, key string, now time.Time) (rateLimitDecision, error) {
+	for attempt := 0; attempt < rateLimitRetries; attempt++ {
+		bucket, err := store.Get(ctx, key)
+		if errors.Is(err, repository.ErrNotFound) {
+			bucket = &models.RateLimitBucket{Key: key}
+		} else if err != nil {
+			return rateLimitDecision{}, err
+		}
+
+		var decision rateLimitDecision
+		switch policy.Algorithm {
+		case config.RateLimitSlidingWindow:
+			decision = slidingWindow(bucket, policy, now)
+		default:
+			decision = tokenBucket(bucket, policy, now)
+		}
+
+		err = store.Save(ctx, bucket)
+		if errors.Is(err, repository.ErrConflict) {
+			continue
+		}
+		if err != nil {
+			return rateLimitDecision{}, err
+		}
+		return decision, nil
+	}
+	return rateLimitDecision{}, fmt.Errorf("bucket %s is too contended", key)
+}
+
+// tokenBucket holds up to Limit tokens, refilled evenly over Period. Each
+// request takes one token, so clients can burst up to Limit requests.
+func tokenBucket(bucket *models.RateLimitBucket, policy config.RateLimitPolicy, now time.Time) rateLimitDecision {
+	capacity := float64(policy.Limit)
+	perSecond := capacity / policy.Period.Seconds()
+
+	tokens := capacity
+	if bucket.Version != 0 {
+		elapsed := max(now.Sub(bucket.Start).Seconds(), 0)
+		tokens = min(capacity, bucket.Value+elapsed*perSecond)
+	}
+
+	decision := rateLimitDecision{allowed: tokens >= 1}
+	if decision.allowed {
+		tokens--
+	} else {
+		decision.retryAfter = secondsDuration((1 - tokens) / perSecond)
+	}
+	decision.remaining = int(math.Floor(tokens))
+	decision.reset = secondsDuration((capacity - tokens) / perSecond)
+
+	bucket.Value = tokens
+	bucket.Start = now
+	bucket.ExpiresAt = now.Add(policy.Period)
+	return decision
+}
+
+// slidingWindow approximates a sliding window from fixed windows of Period:
+// the requests of the previous window count with the share of it that still
+// overlaps the sliding window
+func slidingWindow(bucket *models.RateLimitBucket, policy config.RateLimitPolicy, now time.Time) rateLimitDecision {
+	limit := float64(policy.Limit)
+	start := now.Truncate(policy.Period)
+
+	var current, previous float64
+	switch {
+	case bucket.Start.Equal(start):
+		current, previous = bucket.Value, bucket.Previous
+	case bucket.Start.Equal(start.Add(-policy.Period)):
+		previous = bucket.Value
+	}
+
+	elapsed := now.Sub(start)
+	weight := 1 - elapsed.Seconds()/policy.Period.Seconds()
+
+	decision := rateLimitDecision{allowed: previous*weight+current+1 <= limit}
+	if decision.allowed {
+		current++
+	} else if current+1 <= limit && previous > 0 {
+		// Wait until enough of the previous window has slid out
+		needed := (limit - current - 1) / previous
+		decision.retryAfter = secondsDuration((1-needed)*policy.Period.Seconds()) - elapsed
+	} else {
+		decision.retryAfter = policy.Period - elapsed
+	}
+	decision.remaining = max(int(math.Floor(limit-previous*weight-current)), 0)
+	decision.reset = policy.Period - elapsed
+
+	bucket.Value = current
+	bucket.Previous = previous
+	bucket.Start = start
+	bucket.ExpiresAt = start.Add(2 * policy.Period)
+	return decision
+}
+
+func secondsDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// ceilSeconds rounds up so clients never retry too early
+func ceilSeconds(d time.Duration) int {
+	return max(int(math.Ceil(d.Seconds())), 0)
+}
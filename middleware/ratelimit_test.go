@@ -0,0 +1,162 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go-restful-api/config"
+	"go-restful-api/models"
+	"go-restful-api/repository"
+)
+
+// rateLimitStep counts one request at offset from the start of a window
+type rateLimitStep struct {
+	offset         time.Duration
+	wantAllowed    bool
+	wantRemaining  int
+	wantRetryAfter time.Duration
+}
+
+func runRateLimitSteps(t *testing.T, policy config.RateLimitPolicy, steps []rateLimitStep) {
+	t.Helper()
+	ctx := context.Background()
+	store := repository.NewMemoryRateLimitRepository()
+	start := time.Now().Truncate(policy.Period).Add(policy.Period)
+
+	for i, s := range steps {
+		decision, err := takeRateLimit(ctx, store, policy, "test", start.Add(s.offset))
+		if err != nil {
+			t.Fatalf("step %d: takeRateLimit() error = %v", i, err)
+		}
+		if decision.allowed != s.wantAllowed {
+			t.Errorf("step %d: allowed = %v, want %v", i, decision.allowed, s.wantAllowed)
+		}
+		if decision.remaining != s.wantRemaining {
+			t.Errorf("step %d: remaining = %d, want %d", i, decision.remaining, s.wantRemaining)
+		}
+		if decision.retryAfter != s.wantRetryAfter {
+			t.Errorf("step %d: retryAfter = %s, want %s", i, decision.retryAfter, s.wantRetryAfter)
+		}
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	// One token per second, bursts of up to three
+	policy := config.RateLimitPolicy{Algorithm: config.RateLimitTokenBucket, Limit: 3, Period: 3 * time.Second}
+
+	tests := []struct {
+		name  string
+		steps []rateLimitStep
+	}{
+		{"burst up to the limit", []rateLimitStep{
+			{0, true, 2, 0},
+			{0, true, 1, 0},
+			{0, true, 0, 0},
+			{0, false, 0, time.Second},
+		}},
+		{"refill between requests", []rateLimitStep{
+			{0, true, 2, 0},
+			{0, true, 1, 0},
+			{0, true, 0, 0},
+			{500 * time.Millisecond, false, 0, 500 * time.Millisecond},
+			{time.Second, true, 0, 0},
+			{3 * time.Second, true, 1, 0},
+		}},
+		{"refill is capped at the limit", []rateLimitStep{
+			{0, true, 2, 0},
+			{time.Hour, true, 2, 0},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runRateLimitSteps(t, policy, tt.steps)
+		})
+	}
+}
+
+func TestSlidingWindow(t *testing.T) {
+	policy := config.RateLimitPolicy{Algorithm: config.RateLimitSlidingWindow, Limit: 4, Period: time.Minute}
+	burst := func(offset time.Duration) []rateLimitStep {
+		return []rateLimitStep{
+			{offset, true, 3, 0},
+			{offset, true, 2, 0},
+			{offset, true, 1, 0},
+			{offset, true, 0, 0},
+		}
+	}
+
+	tests := []struct {
+		name  string
+		steps []rateLimitStep
+	}{
+		{"denied until the window ends", append(burst(30*time.Second),
+			rateLimitStep{30 * time.Second, false, 0, 30 * time.Second},
+		)},
+		{"previous window counts by its overlap", append(burst(0),
+			// At 45s into the next window a quarter of the previous one
+			// overlaps, counting as one request
+			rateLimitStep{105 * time.Second, true, 2, 0},
+			rateLimitStep{105 * time.Second, true, 1, 0},
+			rateLimitStep{105 * time.Second, true, 0, 0},
+			rateLimitStep{105 * time.Second, false, 0, 15 * time.Second},
+			rateLimitStep{120 * time.Second, true, 0, 0},
+		)},
+		{"retry once the previous window slides out", append(burst(0),
+			// Half of the previous window overlaps, counting as two
+			rateLimitStep{90 * time.Second, true, 1, 0},
+			rateLimitStep{90 * time.Second, true, 0, 0},
+			rateLimitStep{90 * time.Second, false, 0, 15 * time.Second},
+			rateLimitStep{105 * time.Second, true, 0, 0},
+		)},
+		{"windows further back are forgotten", append(burst(0),
+			rateLimitStep{150 * time.Second, true, 3, 0},
+		)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runRateLimitSteps(t, policy, tt.steps)
+		})
+	}
+}
+
+// conflictingStore fails the first conflicts saves as if another request
+// had updated the bucket in between
+type conflictingStore struct {
+	repository.RateLimitRepository
+	conflicts int
+}
+
+func (s *conflictingStore) Save(ctx context.Context, bucket *models.RateLimitBucket) error {
+	if s.conflicts > 0 {
+		s.conflicts--
+		return repository.ErrConflict
+	}
+	return s.RateLimitRepository.Save(ctx, bucket)
+}
+
+func TestTakeRateLimitRetriesConflicts(t *testing.T) {
+	policy := config.RateLimitPolicy{Algorithm: config.RateLimitTokenBucket, Limit: 3, Period: time.Minute}
+
+	tests := []struct {
+		name      string
+		conflicts int
+		wantErr   bool
+	}{
+		{"no conflict", 0, false},
+		{"retried", rateLimitRetries - 1, false},
+		{"too contended", rateLimitRetries, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &conflictingStore{RateLimitRepository: repository.NewMemoryRateLimitRepository(), conflicts: tt.conflicts}
+			decision, err := takeRateLimit(context.Background(), store, policy, "test", time.Now())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("takeRateLimit() error = %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && (!decision.allowed || decision.remaining != 2) {
+				t.Errorf("decision = %+v, want allowed with 2 remaining", decision)
+			}
+		})
+	}
+}
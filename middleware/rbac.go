@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"go-restful-api/apperror"
+	"go-restful-api/models"
+)
+
+// RequireRole allows the request when the authenticated user has any of the roles.
+// It must run after AuthMiddleware.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := authClaims(c)
+		if !ok {
+			return
+		}
+
+		for _, role := range roles {
+			if claims.HasRole(role) {
+				c.Next()
+				return
+			}
+		}
+
+		abortWithError(c, apperror.Forbidden("insufficient_role", "Insufficient role"))
+	}
+}
+
+// RequirePermission allows the request when the authenticated user has all of the permissions.
+// It must run after AuthMiddleware.
+func RequirePermission(permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := authClaims(c)
+		if !ok {
+			return
+		}
+
+		for _, permission := range permissions {
+			if !claims.HasPermission(permission) {
+				abortWithError(c, apperror.Forbidden("insufficient_permissions", "Insufficient permissions"))
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// RequireSelfOrPermission allows the request when the path parameter names
+// the authenticated user, or when the user has the permission. It must run
+// after AuthMiddleware.
+func RequireSelfOrPermission(param, permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := authClaims(c)
+		if !ok {
+			return
+		}
+
+		if c.Param(param) == claims.UserID || claims.HasPermission(permission) {
+			c.Next()
+			return
+		}
+
+		abortWithError(c, apperror.Forbidden("not_own_account", "You can only access your own account"))
+	}
+}
+
+// authClaims returns the claims set by AuthMiddleware, aborting with 401 when missing
+func authClaims(c *gin.Context) (*models.Claims, bool) {
+	userData, exists := c.Get("user")
+	if claims, ok := userData.(*models.Claims); exists && ok {
+		return claims, true
+	}
+
+	abortWithError(c, apperror.Unauthorized("unauthorized", "Unauthorized"))
+	return nil, false
+}
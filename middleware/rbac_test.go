@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go-restful-api/models"
+)
+
+// serveWithClaims runs the handler on /users/:id for a request of the user
+// with the given roles, as if AuthMiddleware had accepted their token. Nil
+// claims stand for a request that was never authenticated.
+func serveWithClaims(claims *models.Claims, handler gin.HandlerFunc, path string) int {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Errors())
+	router.GET("/users/:id", func(c *gin.Context) {
+		if claims != nil {
+			c.Set("user", claims)
+		}
+	}, handler, func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	return w.Code
+}
+
+func TestRequirePermissionsAndRoles(t *testing.T) {
+	const (
+		annID = "64b7f0c2a1b2c3d4e5f60001"
+		bobID = "64b7f0c2a1b2c3d4e5f60002"
+	)
+	user := &models.Claims{UserID: annID, Roles: []string{models.RoleUser}}
+	admin := &models.Claims{UserID: bobID, Roles: []string{models.RoleAdmin}}
+	noRoles := &models.Claims{UserID: annID}
+
+	tests := []struct {
+		name    string
+		claims  *models.Claims
+		handler gin.HandlerFunc
+		path    string
+		want    int
+	}{
+		{"self with own id", user, RequireSelfOrPermission("id", models.PermissionManageUsers), "/users/" + annID, http.StatusOK},
+		{"self with another id", user, RequireSelfOrPermission("id", models.PermissionManageUsers), "/users/" + bobID, http.StatusForbidden},
+		{"self as admin", admin, RequireSelfOrPermission("id", models.PermissionManageUsers), "/users/" + annID, http.StatusOK},
+		{"self without roles", noRoles, RequireSelfOrPermission("id", models.PermissionManageUsers), "/users/" + annID, http.StatusOK},
+		{"self unauthenticated", nil, RequireSelfOrPermission("id", models.PermissionManageUsers), "/users/" + annID, http.StatusUnauthorized},
+		{"permission as user", user, RequirePermission(models.PermissionListUsers), "/users/" + annID, http.StatusForbidden},
+		{"permission as admin", admin, RequirePermission(models.PermissionListUsers), "/users/" + annID, http.StatusOK},
+		{"all permissions needed", admin, RequirePermission(models.PermissionListUsers, "users:unknown"), "/users/" + annID, http.StatusForbidden},
+		{"permission unauthenticated", nil, RequirePermission(models.PermissionListUsers), "/users/" + annID, http.StatusUnauthorized},
+		{"any role", user, RequireRole(models.RoleAdmin, models.RoleUser), "/users/" + annID, http.StatusOK},
+		{"missing role", user, RequireRole(models.RoleAdmin), "/users/" + annID, http.StatusForbidden},
+		{"unknown role grants nothing", &models.Claims{UserID: annID, Roles: []string{"superuser"}}, RequirePermission(models.PermissionManageUsers), "/users/" + bobID, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := serveWithClaims(tt.claims, tt.handler, tt.path); got != tt.want {
+				t.Errorf("status = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
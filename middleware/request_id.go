@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"go-restful-api/utils"
+)
+
+// RequestIDHeader carries the request ID in requests and responses
+const RequestIDHeader = "X-Request-ID"
+
+// requestIDKey is the gin context key of the request ID
+const requestIDKey = "request_id"
+
+// maxRequestIDLength bounds inbound request IDs, which end up in every log line
+const maxRequestIDLength = 128
+
+// RequestID gives every request an ID, reusing the X-Request-ID of the client
+// or an upstream proxy when it is well-formed. The ID is echoed in the
+// response header and stored in the context for the logger and tracing.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID(id) {
+			var err error
+			if id, err = utils.GenerateRandomToken(16); err != nil {
+				c.Next()
+				return
+			}
+		}
+
+		c.Set(requestIDKey, id)
+		c.Header(RequestIDHeader, id)
+		c.Next()
+	}
+}
+
+// validRequestID accepts IDs made of letters, digits and -_.: only, so they
+// are safe to log and echo
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-', r == '_', r == '.', r == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
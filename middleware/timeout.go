@@ -0,0 +1,23 @@
+package middleware
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+	"go-restful-api/config"
+)
+
+// Timeout gives every request the time budget configured for its route.
+// Handlers honour it, and notice clients going away, by passing
+// c.Request.Context() to everything they call; Errors turns the failures
+// into 504 or 499. Routes must be registered with it already in place so
+// the route template is known.
+func Timeout(cfg config.RequestTimeoutConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), cfg.For(c.Request.Method, c.FullPath()))
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+	}
+}
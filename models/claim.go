@@ -2,9 +2,33 @@ package models
 
 import "github.com/golang-jwt/jwt/v4"
 
-// Claims structure for JWT
+// Claims structure for JWT. The embedded RegisteredClaims carry the token
+// ID (jti) used for revocation, the issue time and the expiry.
 type Claims struct {
-	UserID string `json:"user_id"`
-	Email  string `json:"email"`
+	UserID string   `json:"user_id"`
+	Email  string   `json:"email"`
+	Roles  []string `json:"roles,omitempty"`
 	jwt.RegisteredClaims
 }
+
+// HasRole reports whether the token holder has the role
+func (c *Claims) HasRole(role string) bool {
+	for _, r := range c.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// HasPermission reports whether any role of the token holder grants the permission
+func (c *Claims) HasPermission(permission string) bool {
+	for _, role := range c.Roles {
+		for _, p := range RolePermissions[role] {
+			if p == permission {
+				return true
+			}
+		}
+	}
+	return false
+}
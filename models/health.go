@@ -0,0 +1,26 @@
+package models
+
+// Health states reported by /healthz and /readyz
+const (
+	HealthOK           = "ok"
+	HealthReady        = "ready"
+	HealthNotReady     = "not_ready"
+	HealthShuttingDown = "shutting_down"
+
+	DependencyUp   = "up"
+	DependencyDown = "down"
+)
+
+// HealthStatus is the body of the health endpoints
+type HealthStatus struct {
+	Status string                      `json:"status"`
+	Checks map[string]DependencyStatus `json:"checks,omitempty"`
+}
+
+// DependencyStatus is the result of checking one dependency. Error is kept
+// generic because the endpoints are public.
+type DependencyStatus struct {
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// LoginAttempt counts the failed logins of one key, an account or a client
+// address. The entry is forgotten once ExpiresAt has passed.
+type LoginAttempt struct {
+	Key           string     `bson:"_id"`
+	Failures      int        `bson:"failures"`
+	LastFailureAt time.Time  `bson:"last_failure_at"`
+	LockedUntil   *time.Time `bson:"locked_until,omitempty"`
+	ExpiresAt     time.Time  `bson:"expires_at"`
+}
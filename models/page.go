@@ -0,0 +1,16 @@
+package models
+
+// PageMeta describes the position of a page within a listing
+type PageMeta struct {
+	Page       int   `json:"page"`
+	PerPage    int   `json:"per_page"`
+	Total      int64 `json:"total"`
+	TotalPages int   `json:"total_pages"`
+}
+
+// PageLinks holds the URLs of neighbouring pages, empty at either end
+type PageLinks struct {
+	Self string `json:"self"`
+	Next string `json:"next,omitempty"`
+	Prev string `json:"prev,omitempty"`
+}
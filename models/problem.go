@@ -0,0 +1,29 @@
+package models
+
+// Problem is an RFC 7807 problem details body, sent as application/problem+json
+// for every error response
+type Problem struct {
+	// Type is about:blank, clients tell problems apart by Code
+	Type   string `json:"type" example:"about:blank"`
+	Title  string `json:"title" example:"Not Found"`
+	Status int    `json:"status" example:"404"`
+	Detail string `json:"detail,omitempty" example:"User not found"`
+	// Instance is the path of the request
+	Instance string `json:"instance,omitempty" example:"/api/v1/users/6ad4a3868d621cdf013af0fa"`
+	// Code is a stable, machine-readable error code
+	Code      string `json:"code" example:"user_not_found"`
+	RequestID string `json:"request_id,omitempty" example:"wOHNhu_55IUIQmlCTd-GqA"`
+	// Errors lists every invalid field of a validation_failed problem
+	Errors []FieldError `json:"errors,omitempty"`
+	// RetryAfter is the number of seconds to wait, also sent as Retry-After
+	RetryAfter int `json:"retry_after,omitempty"`
+}
+
+// FieldError describes one invalid field of a request
+type FieldError struct {
+	// Field is the JSON name of the field
+	Field string `json:"field" example:"email"`
+	// Rule is the name of the failed rule, e.g. required, email or min
+	Rule    string `json:"rule" example:"email"`
+	Message string `json:"message" example:"must be a valid email address"`
+}
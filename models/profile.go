@@ -1,15 +1,26 @@
 package models
 
 import (
-    "go.mongodb.org/mongo-driver/bson/primitive"
-    "time"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type Profile struct {
-    ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-    UserID    primitive.ObjectID `bson:"user_id" json:"user_id"`
-    Bio       string             `json:"bio,omitempty"`
-    Avatar    string             `json:"avatar,omitempty"`
-    CreatedAt time.Time          `bson:"created_at" json:"created_at"`
-    UpdatedAt time.Time          `bson:"updated_at" json:"updated_at"`
-}
\ No newline at end of file
+	ID     primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Bio    string             `json:"bio,omitempty" binding:"max=500"`
+	// Avatar is the URL of the image uploaded with PUT /profiles/avatar.
+	// It is managed by the server, values sent by clients are ignored.
+	Avatar string `json:"avatar,omitempty"`
+	// AvatarVersion identifies the uploaded avatar images, empty without an upload
+	AvatarVersion string    `json:"-" bson:"avatar_version,omitempty"`
+	CreatedAt     time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt     time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// Normalize trims the fields before validation
+func (p *Profile) Normalize() {
+	p.Bio = strings.TrimSpace(p.Bio)
+}
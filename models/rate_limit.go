@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// RateLimitBucket is the stored state of one rate limiter key. A token
+// bucket keeps its tokens in Value and the time of the last refill in Start.
+// A sliding window keeps the requests of the window beginning at Start in
+// Value and those of the window before it in Previous.
+type RateLimitBucket struct {
+	Key       string    `bson:"_id"`
+	Value     float64   `bson:"value"`
+	Previous  float64   `bson:"previous"`
+	Start     time.Time `bson:"start"`
+	ExpiresAt time.Time `bson:"expires_at"`
+	Version   int64     `bson:"version"`
+}
@@ -0,0 +1,28 @@
+package models
+
+// Roles that can be assigned to users
+const (
+	RoleAdmin = "admin"
+	RoleUser  = "user"
+)
+
+// Permissions checked by route middleware
+const (
+	// PermissionListUsers allows listing every user account
+	PermissionListUsers = "users:list"
+	// PermissionManageUsers allows reading, updating and deleting any user account
+	PermissionManageUsers = "users:manage"
+)
+
+// RolePermissions maps each role to the permissions it grants. Users can
+// always read and modify their own account without any permission.
+var RolePermissions = map[string][]string{
+	RoleAdmin: {PermissionListUsers, PermissionManageUsers},
+	RoleUser:  {},
+}
+
+// IsValidRole reports whether role is a known role
+func IsValidRole(role string) bool {
+	_, ok := RolePermissions[role]
+	return ok
+}
@@ -0,0 +1,128 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RefreshToken is the server-side record of an opaque refresh token. Only the
+// SHA-256 hash of the token is stored. Tokens rotated from the same login
+// share a FamilyID so that the whole chain can be revoked at once.
+type RefreshToken struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	UserID    primitive.ObjectID `bson:"user_id"`
+	FamilyID  primitive.ObjectID `bson:"family_id"`
+	TokenHash string             `bson:"token_hash"`
+	CreatedAt time.Time          `bson:"created_at"`
+	ExpiresAt time.Time          `bson:"expires_at"`
+	UsedAt    *time.Time         `bson:"used_at,omitempty"`
+	RevokedAt *time.Time         `bson:"revoked_at,omitempty"`
+}
+
+// Purposes of account tokens
+const (
+	TokenPurposeVerifyEmail   = "verify_email"
+	TokenPurposeResetPassword = "reset_password"
+)
+
+// AccountToken is a single-use token mailed to a user to confirm an action
+// on their account. Only the SHA-256 hash of the token is stored.
+type AccountToken struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	UserID    primitive.ObjectID `bson:"user_id"`
+	Purpose   string             `bson:"purpose"`
+	TokenHash string             `bson:"token_hash"`
+	CreatedAt time.Time          `bson:"created_at"`
+	ExpiresAt time.Time          `bson:"expires_at"`
+	UsedAt    *time.Time         `bson:"used_at,omitempty"`
+}
+
+// TokenPair is returned whenever a session is started or refreshed
+type TokenPair struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+type RefreshTokenDTO struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+type LogoutDTO struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type VerifyEmailDTO struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type ResendVerificationDTO struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ForgotPasswordDTO struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// Normalize normalizes the email address before validation
+func (d *ResendVerificationDTO) Normalize() {
+	d.Email = NormalizeEmail(d.Email)
+}
+
+// Normalize normalizes the email address before validation
+func (d *ForgotPasswordDTO) Normalize() {
+	d.Email = NormalizeEmail(d.Email)
+}
+
+type ResetPasswordDTO struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,password_length,breached_password"`
+}
+
+// MFAEnrollment is returned when a user starts TOTP enrollment. The secret is
+// shown once and has to be confirmed with a code before it is enforced.
+type MFAEnrollment struct {
+	Secret string `json:"secret"`
+	// URI is the otpauth:// provisioning URI encoded in the QR code
+	URI string `json:"uri"`
+	// QRCode is a PNG image of the URI as a data URI
+	QRCode string `json:"qr_code"`
+}
+
+// MFARecoveryCodes are shown once when MFA is enabled
+type MFARecoveryCodes struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// MFAChallenge is returned by login when the account requires a second factor
+type MFAChallenge struct {
+	Message     string `json:"message"`
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// MFAEnrollDTO starts TOTP enrollment, confirming the password
+type MFAEnrollDTO struct {
+	Password string `json:"password" binding:"required"`
+}
+
+// MFAConfirmDTO enables MFA with the password and a code from the authenticator
+type MFAConfirmDTO struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// MFAVerifyDTO exchanges the challenge token of a login for a session. Code
+// is a TOTP code or an unused recovery code.
+type MFAVerifyDTO struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+type MFADisableDTO struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
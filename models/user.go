@@ -1,25 +1,95 @@
 package models
 
-import "go.mongodb.org/mongo-driver/bson/primitive"
+import (
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
 
 type User struct {
 	ID       primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
-	Name     string `json:"name" binding:"required"`
-	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required"`
+	Name     string             `json:"name" binding:"required,max=100,person_name"`
+	Email    string             `json:"email" binding:"required,max=254,email"`
+	Password string             `json:"password" binding:"required,password_length,breached_password"`
+	// Roles are assigned by the server, values sent by clients are ignored
+	Roles []string `json:"roles,omitempty" bson:"roles"`
+	// CreatedAt is set by the server when the user registers
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	// EmailVerified is set once the user confirms their address
+	EmailVerified bool `json:"email_verified" bson:"email_verified"`
+	// TOTPSecret is the base32 secret of the authenticator app, set on enrollment
+	TOTPSecret string `json:"-" bson:"totp_secret,omitempty"`
+	// MFAEnabled is set once the enrollment is confirmed with a valid code
+	MFAEnabled bool `json:"-" bson:"mfa_enabled"`
+	// RecoveryCodes are the SHA-256 hashes of the unused recovery codes
+	RecoveryCodes []string `json:"-" bson:"recovery_codes,omitempty"`
+	// TOTPLastStep is the last accepted TOTP time step, codes cannot be replayed
+	TOTPLastStep int64 `json:"-" bson:"totp_last_step,omitempty"`
 }
 
 type UserDTO struct {
-	ID		 primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
-	Name     string             `json:"name" bson:"name"`
-	Email    string             `json:"email" bson:"email"`
+	ID            primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	Name          string             `json:"name" bson:"name"`
+	Email         string             `json:"email" bson:"email"`
+	Roles         []string           `json:"roles" bson:"roles"`
+	CreatedAt     time.Time          `json:"created_at" bson:"created_at"`
+	EmailVerified bool               `json:"email_verified" bson:"email_verified"`
+	MFAEnabled    bool               `json:"mfa_enabled" bson:"mfa_enabled"`
+}
+
+// UserListResponse is one page of GET /users
+type UserListResponse struct {
+	Data  []UserDTO `json:"data"`
+	Meta  PageMeta  `json:"meta"`
+	Links PageLinks `json:"links"`
+}
+
+// UserUpdateDTO holds the fields a user can change on their account
+type UserUpdateDTO struct {
+	Name  string `json:"name" binding:"required,max=100,person_name"`
+	Email string `json:"email" binding:"required,max=254,email"`
 }
 
 type UpdatePasswordTO struct {
-	Password string             `json:"password" bson:"password"`
+	CurrentPassword string `json:"current_password" binding:"required"`
+	Password        string `json:"password" bson:"password" binding:"required,password_length,breached_password"`
 }
 
 type LoginDTO struct {
 	Email    string `json:"email" binding:"required,email"`
 	Password string `json:"password" binding:"required"`
-}
\ No newline at end of file
+}
+
+// ToDTO returns the public representation of the user
+func (u *User) ToDTO() UserDTO {
+	return UserDTO{ID: u.ID, Name: u.Name, Email: u.Email, Roles: u.Roles, CreatedAt: u.CreatedAt, EmailVerified: u.EmailVerified, MFAEnabled: u.MFAEnabled}
+}
+
+// Normalize trims the name and normalizes the email address before validation
+func (u *User) Normalize() {
+	u.Name = NormalizeName(u.Name)
+	u.Email = NormalizeEmail(u.Email)
+}
+
+// Normalize trims the name and normalizes the email address before validation
+func (d *UserUpdateDTO) Normalize() {
+	d.Name = NormalizeName(d.Name)
+	d.Email = NormalizeEmail(d.Email)
+}
+
+// Normalize normalizes the email address before validation
+func (d *LoginDTO) Normalize() {
+	d.Email = NormalizeEmail(d.Email)
+}
+
+// NormalizeEmail trims and lowercases an email address, the form it is
+// stored and looked up in
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// NormalizeName trims a name and collapses runs of whitespace
+func NormalizeName(name string) string {
+	return strings.Join(strings.Fields(name), " ")
+}
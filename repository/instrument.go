@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"go-restful-api/metrics"
+	"go.mongodb.org/mongo-driver/event"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("go-restful-api/repository")
+
+// newMongoMonitor returns a command monitor that wraps every MongoDB command
+// in a client span, a child of the span in the context of the operation, and
+// records its latency and failures
+func newMongoMonitor(database string) *event.CommandMonitor {
+	var spans sync.Map // request ID -> trace.Span
+
+	end := func(requestID int64, command string, duration time.Duration, err error) {
+		metrics.DBOperationDuration.WithLabelValues("mongodb", command).Observe(duration.Seconds())
+		if err != nil {
+			metrics.DBOperationErrors.WithLabelValues("mongodb", command).Inc()
+		}
+
+		value, ok := spans.LoadAndDelete(requestID)
+		if !ok {
+			return
+		}
+		endSpan(value.(trace.Span), err)
+	}
+
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, evt *event.CommandStartedEvent) {
+			attrs := []attribute.KeyValue{
+				attribute.String("db.system.name", "mongodb"),
+				attribute.String("db.namespace", database),
+				attribute.String("db.operation.name", evt.CommandName),
+			}
+			name := evt.CommandName
+			// Most commands name their collection in their first field
+			if collection, ok := evt.Command.Lookup(evt.CommandName).StringValueOK(); ok {
+				attrs = append(attrs, attribute.String("db.collection.name", collection))
+				name += " " + collection
+			}
+
+			_, span := tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+			spans.Store(evt.RequestID, span)
+		},
+		Succeeded: func(ctx context.Context, evt *event.CommandSucceededEvent) {
+			end(evt.RequestID, evt.CommandName, evt.Duration, nil)
+		},
+		Failed: func(ctx context.Context, evt *event.CommandFailedEvent) {
+			end(evt.RequestID, evt.CommandName, evt.Duration, errors.New(evt.Failure))
+		},
+	}
+}
+
+// sqlOperation is one SQL statement being traced and timed
+type sqlOperation struct {
+	system    string
+	operation string
+	start     time.Time
+	span      trace.Span
+}
+
+// startSQL starts a client span for a SQL statement. The span is named
+// after the statement's first keyword, the full text is kept as an attribute.
+func (db *sqlDB) startSQL(ctx context.Context, query string) (context.Context, *sqlOperation) {
+	operation, _, _ := strings.Cut(strings.TrimSpace(query), " ")
+	operation = strings.ToUpper(operation)
+
+	ctx, span := tracer.Start(ctx, operation, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("db.system.name", db.dialect.name),
+		attribute.String("db.operation.name", operation),
+		attribute.String("db.query.text", query),
+	))
+	return ctx, &sqlOperation{system: db.dialect.name, operation: operation, start: time.Now(), span: span}
+}
+
+// end records the outcome of the statement. Missing rows and duplicates are
+// expected outcomes, not failures.
+func (op *sqlOperation) end(err error) {
+	if errors.Is(err, ErrNotFound) || errors.Is(err, ErrDuplicate) {
+		err = nil
+	}
+
+	metrics.DBOperationDuration.WithLabelValues(op.system, op.operation).Observe(time.Since(op.start).Seconds())
+	if err != nil {
+		metrics.DBOperationErrors.WithLabelValues(op.system, op.operation).Inc()
+	}
+	endSpan(op.span, err)
+}
+
+// endSpan records err on the span and ends it
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go-restful-api/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var _ AccountTokenRepository = (*MemoryAccountTokenRepository)(nil)
+
+// MemoryAccountTokenRepository keeps account tokens in process memory.
+// Expired tokens are dropped whenever a new token is inserted.
+type MemoryAccountTokenRepository struct {
+	mu     sync.Mutex
+	tokens map[primitive.ObjectID]*models.AccountToken
+	byHash map[string]primitive.ObjectID
+}
+
+// NewMemoryAccountTokenRepository creates an empty in-memory AccountTokenRepository
+func NewMemoryAccountTokenRepository() *MemoryAccountTokenRepository {
+	return &MemoryAccountTokenRepository{
+		tokens: make(map[primitive.ObjectID]*models.AccountToken),
+		byHash: make(map[string]primitive.ObjectID),
+	}
+}
+
+func (r *MemoryAccountTokenRepository) Insert(ctx context.Context, token *models.AccountToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for id, t := range r.tokens {
+		if now.After(t.ExpiresAt) {
+			r.delete(id)
+		}
+	}
+
+	if token.ID.IsZero() {
+		token.ID = primitive.NewObjectID()
+	}
+	if _, ok := r.byHash[token.TokenHash]; ok {
+		return ErrDuplicate
+	}
+
+	stored := *token
+	r.tokens[token.ID] = &stored
+	r.byHash[token.TokenHash] = token.ID
+	return nil
+}
+
+func (r *MemoryAccountTokenRepository) FindByHash(ctx context.Context, purpose, tokenHash string) (*models.AccountToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	id, ok := r.byHash[tokenHash]
+	if !ok || r.tokens[id].Purpose != purpose {
+		return nil, ErrNotFound
+	}
+	token := *r.tokens[id]
+	return &token, nil
+}
+
+func (r *MemoryAccountTokenRepository) MarkUsed(ctx context.Context, id primitive.ObjectID, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	token, ok := r.tokens[id]
+	if !ok || token.UsedAt != nil {
+		return ErrNotFound
+	}
+	token.UsedAt = &at
+	return nil
+}
+
+func (r *MemoryAccountTokenRepository) DeleteByUser(ctx context.Context, userID primitive.ObjectID, purpose string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, token := range r.tokens {
+		if token.UserID == userID && token.Purpose == purpose {
+			r.delete(id)
+		}
+	}
+	return nil
+}
+
+// delete removes a token, the caller must hold the lock
+func (r *MemoryAccountTokenRepository) delete(id primitive.ObjectID) {
+	delete(r.byHash, r.tokens[id].TokenHash)
+	delete(r.tokens, id)
+}
@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go-restful-api/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMemoryAccountTokenRepository(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	userID := primitive.NewObjectID()
+
+	tests := []struct {
+		name string
+		run  func(r *MemoryAccountTokenRepository, token *models.AccountToken) error
+		want error
+	}{
+		{"find", func(r *MemoryAccountTokenRepository, token *models.AccountToken) error {
+			_, err := r.FindByHash(ctx, models.TokenPurposeVerifyEmail, "hash")
+			return err
+		}, nil},
+		{"find for another purpose", func(r *MemoryAccountTokenRepository, token *models.AccountToken) error {
+			_, err := r.FindByHash(ctx, models.TokenPurposeResetPassword, "hash")
+			return err
+		}, ErrNotFound},
+		{"duplicate hash", func(r *MemoryAccountTokenRepository, token *models.AccountToken) error {
+			return r.Insert(ctx, &models.AccountToken{TokenHash: "hash", ExpiresAt: now.Add(time.Hour)})
+		}, ErrDuplicate},
+		{"mark used", func(r *MemoryAccountTokenRepository, token *models.AccountToken) error {
+			return r.MarkUsed(ctx, token.ID, now)
+		}, nil},
+		{"mark used twice", func(r *MemoryAccountTokenRepository, token *models.AccountToken) error {
+			if err := r.MarkUsed(ctx, token.ID, now); err != nil {
+				return err
+			}
+			return r.MarkUsed(ctx, token.ID, now)
+		}, ErrNotFound},
+		{"deleted by user and purpose", func(r *MemoryAccountTokenRepository, token *models.AccountToken) error {
+			if err := r.DeleteByUser(ctx, userID, models.TokenPurposeVerifyEmail); err != nil {
+				return err
+			}
+			_, err := r.FindByHash(ctx, models.TokenPurposeVerifyEmail, "hash")
+			return err
+		}, ErrNotFound},
+		{"kept when deleting another purpose", func(r *MemoryAccountTokenRepository, token *models.AccountToken) error {
+			if err := r.DeleteByUser(ctx, userID, models.TokenPurposeResetPassword); err != nil {
+				return err
+			}
+			_, err := r.FindByHash(ctx, models.TokenPurposeVerifyEmail, "hash")
+			return err
+		}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewMemoryAccountTokenRepository()
+			token := &models.AccountToken{
+				UserID:    userID,
+				Purpose:   models.TokenPurposeVerifyEmail,
+				TokenHash: "hash",
+				CreatedAt: now,
+				ExpiresAt: now.Add(time.Hour),
+			}
+			if err := r.Insert(ctx, token); err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.run(r, token); !errors.Is(err, tt.want) {
+				t.Errorf("error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
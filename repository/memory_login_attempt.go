@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go-restful-api/models"
+)
+
+var _ LoginAttemptRepository = (*MemoryLoginAttemptRepository)(nil)
+
+// MemoryLoginAttemptRepository keeps login attempts in process memory.
+// Expired entries are dropped whenever a failure is recorded.
+type MemoryLoginAttemptRepository struct {
+	mu      sync.Mutex
+	entries map[string]models.LoginAttempt
+}
+
+// NewMemoryLoginAttemptRepository creates an empty in-memory LoginAttemptRepository
+func NewMemoryLoginAttemptRepository() *MemoryLoginAttemptRepository {
+	return &MemoryLoginAttemptRepository{entries: make(map[string]models.LoginAttempt)}
+}
+
+func (r *MemoryLoginAttemptRepository) Get(ctx context.Context, key string) (*models.LoginAttempt, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry, ok := r.entries[key]
+	if !ok || !entry.ExpiresAt.After(time.Now()) {
+		return nil, ErrNotFound
+	}
+	return cloneLoginAttempt(entry), nil
+}
+
+func (r *MemoryLoginAttemptRepository) RecordFailure(ctx context.Context, key string, at time.Time, window time.Duration) (*models.LoginAttempt, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for k, e := range r.entries {
+		if !e.ExpiresAt.After(at) {
+			delete(r.entries, k)
+		}
+	}
+
+	entry, ok := r.entries[key]
+	if !ok {
+		entry = models.LoginAttempt{Key: key}
+	}
+	entry.Failures++
+	entry.LastFailureAt = at
+	if expiresAt := at.Add(window); expiresAt.After(entry.ExpiresAt) {
+		entry.ExpiresAt = expiresAt
+	}
+	r.entries[key] = entry
+	return cloneLoginAttempt(entry), nil
+}
+
+func (r *MemoryLoginAttemptRepository) Lock(ctx context.Context, key string, until time.Time, window time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry, ok := r.entries[key]
+	if !ok {
+		entry = models.LoginAttempt{Key: key}
+	}
+	entry.LockedUntil = &until
+	if expiresAt := until.Add(window); expiresAt.After(entry.ExpiresAt) {
+		entry.ExpiresAt = expiresAt
+	}
+	r.entries[key] = entry
+	return nil
+}
+
+func (r *MemoryLoginAttemptRepository) Reset(ctx context.Context, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.entries, key)
+	return nil
+}
+
+// cloneLoginAttempt copies the entry so callers never share the stored lock time
+func cloneLoginAttempt(entry models.LoginAttempt) *models.LoginAttempt {
+	if entry.LockedUntil != nil {
+		until := *entry.LockedUntil
+		entry.LockedUntil = &until
+	}
+	return &entry
+}
@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMemoryLoginAttemptRepository(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	const window = 15 * time.Minute
+
+	tests := []struct {
+		name string
+		// prepare records failures and locks before the entry is read
+		prepare      func(r *MemoryLoginAttemptRepository) error
+		wantFailures int
+		wantLocked   bool
+		wantErr      error
+	}{
+		{
+			name:    "no failures",
+			prepare: func(r *MemoryLoginAttemptRepository) error { return nil },
+			wantErr: ErrNotFound,
+		},
+		{
+			name: "failures add up",
+			prepare: func(r *MemoryLoginAttemptRepository) error {
+				for range 3 {
+					if _, err := r.RecordFailure(ctx, "k", now, window); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			wantFailures: 3,
+		},
+		{
+			name: "expired entry starts again",
+			prepare: func(r *MemoryLoginAttemptRepository) error {
+				if _, err := r.RecordFailure(ctx, "k", now.Add(-2*window), window); err != nil {
+					return err
+				}
+				_, err := r.RecordFailure(ctx, "k", now, window)
+				return err
+			},
+			wantFailures: 1,
+		},
+		{
+			name: "entry outside the window is gone",
+			prepare: func(r *MemoryLoginAttemptRepository) error {
+				_, err := r.RecordFailure(ctx, "k", now.Add(-2*window), window)
+				return err
+			},
+			wantErr: ErrNotFound,
+		},
+		{
+			name: "lock keeps the entry beyond the window",
+			prepare: func(r *MemoryLoginAttemptRepository) error {
+				if _, err := r.RecordFailure(ctx, "k", now.Add(-2*window), window); err != nil {
+					return err
+				}
+				return r.Lock(ctx, "k", now.Add(time.Minute), window)
+			},
+			wantFailures: 1,
+			wantLocked:   true,
+		},
+		{
+			name: "reset",
+			prepare: func(r *MemoryLoginAttemptRepository) error {
+				if _, err := r.RecordFailure(ctx, "k", now, window); err != nil {
+					return err
+				}
+				return r.Reset(ctx, "k")
+			},
+			wantErr: ErrNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewMemoryLoginAttemptRepository()
+			if err := tt.prepare(r); err != nil {
+				t.Fatal(err)
+			}
+
+			entry, err := r.Get(ctx, "k")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Get() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if entry.Failures != tt.wantFailures {
+				t.Errorf("Failures = %d, want %d", entry.Failures, tt.wantFailures)
+			}
+			if locked := entry.LockedUntil != nil; locked != tt.wantLocked {
+				t.Errorf("locked = %v, want %v", locked, tt.wantLocked)
+			}
+		})
+	}
+}
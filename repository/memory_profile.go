@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"context"
+	"sync"
+
+	"go-restful-api/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var _ ProfileRepository = (*MemoryProfileRepository)(nil)
+
+// MemoryProfileRepository keeps profiles in process memory, keyed by user ID
+// so that each user has at most one profile. It is safe for concurrent use.
+type MemoryProfileRepository struct {
+	mu       sync.RWMutex
+	profiles map[primitive.ObjectID]models.Profile
+}
+
+// NewMemoryProfileRepository creates an empty in-memory ProfileRepository
+func NewMemoryProfileRepository() *MemoryProfileRepository {
+	return &MemoryProfileRepository{profiles: make(map[primitive.ObjectID]models.Profile)}
+}
+
+func (r *MemoryProfileRepository) FindByUserID(ctx context.Context, userID primitive.ObjectID) (*models.Profile, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	profile, ok := r.profiles[userID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &profile, nil
+}
+
+func (r *MemoryProfileRepository) Insert(ctx context.Context, profile *models.Profile) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.profiles[profile.UserID]; ok {
+		return ErrDuplicate
+	}
+	if profile.ID.IsZero() {
+		profile.ID = primitive.NewObjectID()
+	}
+
+	r.profiles[profile.UserID] = *profile
+	return nil
+}
+
+func (r *MemoryProfileRepository) Update(ctx context.Context, profile *models.Profile) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.profiles[profile.UserID]; !ok {
+		return ErrNotFound
+	}
+
+	r.profiles[profile.UserID] = *profile
+	return nil
+}
+
+func (r *MemoryProfileRepository) DeleteByUserID(ctx context.Context, userID primitive.ObjectID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.profiles[userID]; !ok {
+		return ErrNotFound
+	}
+
+	delete(r.profiles, userID)
+	return nil
+}
@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go-restful-api/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMemoryProfileRepository(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryProfileRepository()
+	userID := primitive.NewObjectID()
+	other := primitive.NewObjectID()
+
+	profile := &models.Profile{UserID: userID, Bio: "hello"}
+	if err := repo.Insert(ctx, profile); err != nil {
+		t.Fatalf("Insert() error = %v", err)
+	}
+	if profile.ID.IsZero() {
+		t.Error("Insert() did not assign an ID")
+	}
+
+	tests := []struct {
+		name string
+		run  func() error
+		want error
+	}{
+		{"second profile of a user", func() error {
+			return repo.Insert(ctx, &models.Profile{UserID: userID})
+		}, ErrDuplicate},
+		{"find unknown user", func() error {
+			_, err := repo.FindByUserID(ctx, other)
+			return err
+		}, ErrNotFound},
+		{"update unknown user", func() error {
+			return repo.Update(ctx, &models.Profile{UserID: other})
+		}, ErrNotFound},
+		{"delete unknown user", func() error {
+			return repo.DeleteByUserID(ctx, other)
+		}, ErrNotFound},
+		{"update", func() error {
+			return repo.Update(ctx, &models.Profile{ID: profile.ID, UserID: userID, Bio: "changed"})
+		}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.run(); !errors.Is(err, tt.want) {
+				t.Errorf("error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	found, err := repo.FindByUserID(ctx, userID)
+	if err != nil || found.Bio != "changed" {
+		t.Fatalf("FindByUserID() = %+v, %v", found, err)
+	}
+
+	if err := repo.DeleteByUserID(ctx, userID); err != nil {
+		t.Fatalf("DeleteByUserID() error = %v", err)
+	}
+	if _, err := repo.FindByUserID(ctx, userID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("FindByUserID() after delete error = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go-restful-api/models"
+)
+
+var _ RateLimitRepository = (*MemoryRateLimitRepository)(nil)
+
+// MemoryRateLimitRepository keeps rate limiter buckets in process memory.
+// Expired buckets are dropped whenever a new one is created.
+type MemoryRateLimitRepository struct {
+	mu      sync.Mutex
+	buckets map[string]models.RateLimitBucket
+}
+
+// NewMemoryRateLimitRepository creates an empty in-memory RateLimitRepository
+func NewMemoryRateLimitRepository() *MemoryRateLimitRepository {
+	return &MemoryRateLimitRepository{buckets: make(map[string]models.RateLimitBucket)}
+}
+
+func (r *MemoryRateLimitRepository) Get(ctx context.Context, key string) (*models.RateLimitBucket, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	bucket, ok := r.buckets[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &bucket, nil
+}
+
+func (r *MemoryRateLimitRepository) Save(ctx context.Context, bucket *models.RateLimitBucket) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.buckets[bucket.Key]
+	if bucket.Version == 0 {
+		if ok {
+			return ErrConflict
+		}
+		now := time.Now()
+		for k, b := range r.buckets {
+			if now.After(b.ExpiresAt) {
+				delete(r.buckets, k)
+			}
+		}
+	} else if !ok || stored.Version != bucket.Version {
+		return ErrConflict
+	}
+
+	bucket.Version++
+	r.buckets[bucket.Key] = *bucket
+	return nil
+}
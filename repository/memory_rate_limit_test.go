@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go-restful-api/models"
+)
+
+func TestMemoryRateLimitRepository(t *testing.T) {
+	ctx := context.Background()
+	expires := time.Now().Add(time.Minute)
+
+	tests := []struct {
+		name string
+		// run saves bucket, which is already stored with version 1
+		run         func(r *MemoryRateLimitRepository, bucket *models.RateLimitBucket) error
+		want        error
+		wantVersion int64
+	}{
+		{"save current version", func(r *MemoryRateLimitRepository, bucket *models.RateLimitBucket) error {
+			return r.Save(ctx, bucket)
+		}, nil, 2},
+		{"create again", func(r *MemoryRateLimitRepository, bucket *models.RateLimitBucket) error {
+			return r.Save(ctx, &models.RateLimitBucket{Key: "k", Value: 9, ExpiresAt: expires})
+		}, ErrConflict, 1},
+		{"stale copy", func(r *MemoryRateLimitRepository, bucket *models.RateLimitBucket) error {
+			stale := *bucket
+			if err := r.Save(ctx, bucket); err != nil {
+				return err
+			}
+			return r.Save(ctx, &stale)
+		}, ErrConflict, 2},
+		{"unknown version", func(r *MemoryRateLimitRepository, bucket *models.RateLimitBucket) error {
+			bucket.Version = 7
+			return r.Save(ctx, bucket)
+		}, ErrConflict, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewMemoryRateLimitRepository()
+			bucket := &models.RateLimitBucket{Key: "k", Value: 1, ExpiresAt: expires}
+			if err := r.Save(ctx, bucket); err != nil {
+				t.Fatal(err)
+			}
+			if bucket.Version != 1 {
+				t.Fatalf("Version after create = %d, want 1", bucket.Version)
+			}
+
+			if err := tt.run(r, bucket); !errors.Is(err, tt.want) {
+				t.Fatalf("Save() error = %v, want %v", err, tt.want)
+			}
+			stored, err := r.Get(ctx, "k")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.Version != tt.wantVersion {
+				t.Errorf("stored Version = %d, want %d", stored.Version, tt.wantVersion)
+			}
+		})
+	}
+}
+
+func TestMemoryRateLimitRepositoryDropsExpired(t *testing.T) {
+	ctx := context.Background()
+	r := NewMemoryRateLimitRepository()
+
+	if err := r.Save(ctx, &models.RateLimitBucket{Key: "old", ExpiresAt: time.Now().Add(-time.Second)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Get(ctx, "old"); err != nil {
+		t.Fatalf("Get() before another bucket is created error = %v", err)
+	}
+	if err := r.Save(ctx, &models.RateLimitBucket{Key: "new", ExpiresAt: time.Now().Add(time.Minute)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Get(ctx, "old"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() of the expired bucket error = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go-restful-api/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var _ RefreshTokenRepository = (*MemoryRefreshTokenRepository)(nil)
+
+// MemoryRefreshTokenRepository keeps refresh tokens in process memory.
+// Expired tokens are dropped whenever a new token is inserted.
+type MemoryRefreshTokenRepository struct {
+	mu     sync.Mutex
+	tokens map[primitive.ObjectID]*models.RefreshToken
+	byHash map[string]primitive.ObjectID
+}
+
+// NewMemoryRefreshTokenRepository creates an empty in-memory RefreshTokenRepository
+func NewMemoryRefreshTokenRepository() *MemoryRefreshTokenRepository {
+	return &MemoryRefreshTokenRepository{
+		tokens: make(map[primitive.ObjectID]*models.RefreshToken),
+		byHash: make(map[string]primitive.ObjectID),
+	}
+}
+
+func (r *MemoryRefreshTokenRepository) Insert(ctx context.Context, token *models.RefreshToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for id, t := range r.tokens {
+		if now.After(t.ExpiresAt) {
+			delete(r.byHash, t.TokenHash)
+			delete(r.tokens, id)
+		}
+	}
+
+	if token.ID.IsZero() {
+		token.ID = primitive.NewObjectID()
+	}
+	if _, ok := r.byHash[token.TokenHash]; ok {
+		return ErrDuplicate
+	}
+
+	stored := *token
+	r.tokens[token.ID] = &stored
+	r.byHash[token.TokenHash] = token.ID
+	return nil
+}
+
+func (r *MemoryRefreshTokenRepository) FindByHash(ctx context.Context, tokenHash string) (*models.RefreshToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	id, ok := r.byHash[tokenHash]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	token := *r.tokens[id]
+	return &token, nil
+}
+
+func (r *MemoryRefreshTokenRepository) MarkUsed(ctx context.Context, id primitive.ObjectID, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	token, ok := r.tokens[id]
+	if !ok || token.UsedAt != nil || token.RevokedAt != nil {
+		return ErrNotFound
+	}
+	token.UsedAt = &at
+	return nil
+}
+
+func (r *MemoryRefreshTokenRepository) RevokeFamily(ctx context.Context, familyID primitive.ObjectID, at time.Time) error {
+	r.revoke(func(t *models.RefreshToken) bool { return t.FamilyID == familyID }, at)
+	return nil
+}
+
+func (r *MemoryRefreshTokenRepository) RevokeUser(ctx context.Context, userID primitive.ObjectID, at time.Time) error {
+	r.revoke(func(t *models.RefreshToken) bool { return t.UserID == userID }, at)
+	return nil
+}
+
+func (r *MemoryRefreshTokenRepository) revoke(match func(*models.RefreshToken) bool, at time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, token := range r.tokens {
+		if token.RevokedAt == nil && match(token) {
+			token.RevokedAt = &at
+		}
+	}
+}
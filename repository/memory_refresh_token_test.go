@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go-restful-api/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMemoryRefreshTokenRepository(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	userID, familyID := primitive.NewObjectID(), primitive.NewObjectID()
+
+	newToken := func(hash string, family primitive.ObjectID) *models.RefreshToken {
+		return &models.RefreshToken{UserID: userID, FamilyID: family, TokenHash: hash, CreatedAt: now, ExpiresAt: now.Add(time.Hour)}
+	}
+
+	tests := []struct {
+		name string
+		run  func(r *MemoryRefreshTokenRepository, token *models.RefreshToken) error
+		want error
+	}{
+		{"find", func(r *MemoryRefreshTokenRepository, token *models.RefreshToken) error {
+			_, err := r.FindByHash(ctx, "a")
+			return err
+		}, nil},
+		{"find unknown", func(r *MemoryRefreshTokenRepository, token *models.RefreshToken) error {
+			_, err := r.FindByHash(ctx, "b")
+			return err
+		}, ErrNotFound},
+		{"duplicate hash", func(r *MemoryRefreshTokenRepository, token *models.RefreshToken) error {
+			return r.Insert(ctx, newToken("a", familyID))
+		}, ErrDuplicate},
+		{"mark used", func(r *MemoryRefreshTokenRepository, token *models.RefreshToken) error {
+			return r.MarkUsed(ctx, token.ID, now)
+		}, nil},
+		{"mark used twice", func(r *MemoryRefreshTokenRepository, token *models.RefreshToken) error {
+			if err := r.MarkUsed(ctx, token.ID, now); err != nil {
+				return err
+			}
+			return r.MarkUsed(ctx, token.ID, now)
+		}, ErrNotFound},
+		{"mark revoked family used", func(r *MemoryRefreshTokenRepository, token *models.RefreshToken) error {
+			if err := r.RevokeFamily(ctx, familyID, now); err != nil {
+				return err
+			}
+			return r.MarkUsed(ctx, token.ID, now)
+		}, ErrNotFound},
+		{"mark token of revoked user used", func(r *MemoryRefreshTokenRepository, token *models.RefreshToken) error {
+			if err := r.RevokeUser(ctx, userID, now); err != nil {
+				return err
+			}
+			return r.MarkUsed(ctx, token.ID, now)
+		}, ErrNotFound},
+		{"other family stays usable", func(r *MemoryRefreshTokenRepository, token *models.RefreshToken) error {
+			other := newToken("c", primitive.NewObjectID())
+			if err := r.Insert(ctx, other); err != nil {
+				return err
+			}
+			if err := r.RevokeFamily(ctx, familyID, now); err != nil {
+				return err
+			}
+			return r.MarkUsed(ctx, other.ID, now)
+		}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewMemoryRefreshTokenRepository()
+			token := newToken("a", familyID)
+			if err := r.Insert(ctx, token); err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.run(r, token); !errors.Is(err, tt.want) {
+				t.Errorf("error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryRefreshTokenRepositoryDropsExpired(t *testing.T) {
+	ctx := context.Background()
+	r := NewMemoryRefreshTokenRepository()
+
+	expired := &models.RefreshToken{TokenHash: "old", ExpiresAt: time.Now().Add(-time.Minute)}
+	if err := r.Insert(ctx, expired); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Insert(ctx, &models.RefreshToken{TokenHash: "new", ExpiresAt: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.FindByHash(ctx, "old"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("FindByHash(expired) error = %v, want ErrNotFound", err)
+	}
+}
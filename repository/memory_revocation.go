@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var _ RevocationRepository = (*MemoryRevocationRepository)(nil)
+
+type memoryRevocation struct {
+	notBefore time.Time
+	expiresAt time.Time
+}
+
+// MemoryRevocationRepository keeps revocations in process memory and
+// forgets them once the revoked tokens would have expired anyway
+type MemoryRevocationRepository struct {
+	mu      sync.RWMutex
+	entries map[string]memoryRevocation
+}
+
+// NewMemoryRevocationRepository creates an empty in-memory RevocationRepository
+func NewMemoryRevocationRepository() *MemoryRevocationRepository {
+	return &MemoryRevocationRepository{entries: make(map[string]memoryRevocation)}
+}
+
+func (r *MemoryRevocationRepository) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	r.put(revokedTokenKey(jti), memoryRevocation{expiresAt: expiresAt})
+	return nil
+}
+
+func (r *MemoryRevocationRepository) ClaimToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if e, ok := r.entries[revokedTokenKey(jti)]; ok && time.Now().Before(e.expiresAt) {
+		return ErrDuplicate
+	}
+	r.entries[revokedTokenKey(jti)] = memoryRevocation{expiresAt: expiresAt}
+	return nil
+}
+
+func (r *MemoryRevocationRepository) RevokeUserTokens(ctx context.Context, userID primitive.ObjectID, issuedBefore, expiresAt time.Time) error {
+	r.put(revokedUserKey(userID), memoryRevocation{notBefore: issuedBefore, expiresAt: expiresAt})
+	return nil
+}
+
+func (r *MemoryRevocationRepository) put(key string, entry memoryRevocation) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for k, e := range r.entries {
+		if now.After(e.expiresAt) {
+			delete(r.entries, k)
+		}
+	}
+	r.entries[key] = entry
+}
+
+func (r *MemoryRevocationRepository) IsRevoked(ctx context.Context, jti string, userID primitive.ObjectID, issuedAt time.Time) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := time.Now()
+	if e, ok := r.entries[revokedTokenKey(jti)]; ok && now.Before(e.expiresAt) {
+		return true, nil
+	}
+	if e, ok := r.entries[revokedUserKey(userID)]; ok && now.Before(e.expiresAt) && !issuedAt.After(e.notBefore) {
+		return true, nil
+	}
+	return false, nil
+}
@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMemoryRevocationRepository(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	user, other := primitive.NewObjectID(), primitive.NewObjectID()
+
+	r := NewMemoryRevocationRepository()
+	if err := r.RevokeToken(ctx, "revoked", now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.RevokeToken(ctx, "expired", now.Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.RevokeUserTokens(ctx, user, now, now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		jti      string
+		userID   primitive.ObjectID
+		issuedAt time.Time
+		want     bool
+	}{
+		{"revoked token", "revoked", other, now, true},
+		{"unknown token", "fresh", other, now, false},
+		// Tokens only need to be rejected until they expire on their own
+		{"revocation past the token expiry", "expired", other, now, false},
+		{"user token issued before the revocation", "fresh", user, now.Add(-time.Minute), true},
+		{"user token issued in the same instant", "fresh", user, now, true},
+		{"user token issued after the revocation", "fresh", user, now.Add(time.Second), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := r.IsRevoked(ctx, tt.jti, tt.userID, tt.issuedAt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("IsRevoked() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryRevocationRepositoryClaimToken(t *testing.T) {
+	testClaimToken(t, NewMemoryRevocationRepository())
+}
+
+// testClaimToken checks that a RevocationRepository lets a token be claimed once
+func testClaimToken(t *testing.T, r RevocationRepository) {
+	t.Helper()
+	ctx := context.Background()
+	now := time.Now()
+
+	if err := r.ClaimToken(ctx, "challenge", now.Add(time.Hour)); err != nil {
+		t.Fatalf("ClaimToken() error = %v", err)
+	}
+	if err := r.ClaimToken(ctx, "challenge", now.Add(time.Hour)); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("second ClaimToken() error = %v, want ErrDuplicate", err)
+	}
+	if err := r.RevokeToken(ctx, "revoked", now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.ClaimToken(ctx, "revoked", now.Add(time.Hour)); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("ClaimToken() of a revoked token error = %v, want ErrDuplicate", err)
+	}
+	if revoked, err := r.IsRevoked(ctx, "challenge", primitive.NewObjectID(), now); err != nil || !revoked {
+		t.Errorf("IsRevoked() of a claimed token = %v, %v, want true", revoked, err)
+	}
+}
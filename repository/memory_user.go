@@ -0,0 +1,223 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go-restful-api/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var _ UserRepository = (*MemoryUserRepository)(nil)
+
+// MemoryUserRepository keeps users in process memory. It is safe for
+// concurrent use and enforces the same unique email rule as MongoDB.
+type MemoryUserRepository struct {
+	mu      sync.RWMutex
+	users   map[primitive.ObjectID]models.User
+	byEmail map[string]primitive.ObjectID
+}
+
+// NewMemoryUserRepository creates an empty in-memory UserRepository
+func NewMemoryUserRepository() *MemoryUserRepository {
+	return &MemoryUserRepository{
+		users:   make(map[primitive.ObjectID]models.User),
+		byEmail: make(map[string]primitive.ObjectID),
+	}
+}
+
+func (r *MemoryUserRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	user, ok := r.users[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	user = cloneUser(user)
+	return &user, nil
+}
+
+func (r *MemoryUserRepository) FindByEmail(ctx context.Context, email string) (*models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	id, ok := r.byEmail[email]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	user := cloneUser(r.users[id])
+	return &user, nil
+}
+
+func (r *MemoryUserRepository) List(ctx context.Context, opts UserListOptions) ([]models.User, int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	users := make([]models.User, 0, len(r.users))
+	for _, user := range r.users {
+		if matchUser(user, opts) {
+			users = append(users, cloneUser(user))
+		}
+	}
+
+	field := opts.sortField()
+	sort.Slice(users, func(i, j int) bool {
+		a, b := users[i], users[j]
+		if opts.Descending {
+			a, b = b, a
+		}
+
+		var cmp int
+		switch field {
+		case UserSortName:
+			cmp = strings.Compare(a.Name, b.Name)
+		case UserSortEmail:
+			cmp = strings.Compare(a.Email, b.Email)
+		default:
+			cmp = a.CreatedAt.Compare(b.CreatedAt)
+		}
+		if cmp == 0 {
+			cmp = bytes.Compare(a.ID[:], b.ID[:])
+		}
+		return cmp < 0
+	})
+
+	total := int64(len(users))
+	users = users[min(opts.Offset, len(users)):]
+	if opts.Limit > 0 && opts.Limit < len(users) {
+		users = users[:opts.Limit]
+	}
+	return users, total, nil
+}
+
+func matchUser(user models.User, opts UserListOptions) bool {
+	if opts.Name != "" && !containsFold(user.Name, opts.Name) {
+		return false
+	}
+	if opts.Email != "" && !containsFold(user.Email, opts.Email) {
+		return false
+	}
+	if !opts.CreatedAfter.IsZero() && !user.CreatedAt.After(opts.CreatedAfter) {
+		return false
+	}
+	if !opts.CreatedBefore.IsZero() && !user.CreatedAt.Before(opts.CreatedBefore) {
+		return false
+	}
+	return true
+}
+
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+func (r *MemoryUserRepository) Insert(ctx context.Context, user *models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if user.ID.IsZero() {
+		user.ID = primitive.NewObjectID()
+	}
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = time.Now().UTC()
+	}
+	if _, ok := r.users[user.ID]; ok {
+		return ErrDuplicate
+	}
+	if _, ok := r.byEmail[user.Email]; ok {
+		return ErrDuplicate
+	}
+
+	r.users[user.ID] = cloneUser(*user)
+	r.byEmail[user.Email] = user.ID
+	return nil
+}
+
+func (r *MemoryUserRepository) Update(ctx context.Context, user *models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, ok := r.users[user.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	if id, ok := r.byEmail[user.Email]; ok && id != user.ID {
+		return ErrDuplicate
+	}
+
+	delete(r.byEmail, existing.Email)
+	r.users[user.ID] = cloneUser(*user)
+	r.byEmail[user.Email] = user.ID
+	return nil
+}
+
+func (r *MemoryUserRepository) SetMFA(ctx context.Context, user *models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, ok := r.users[user.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	existing.TOTPSecret = user.TOTPSecret
+	existing.MFAEnabled = user.MFAEnabled
+	existing.RecoveryCodes = slices.Clone(user.RecoveryCodes)
+	r.users[user.ID] = existing
+	return nil
+}
+
+func (r *MemoryUserRepository) SaveTOTPStep(ctx context.Context, id primitive.ObjectID, step int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok || user.TOTPLastStep >= step {
+		return ErrConflict
+	}
+	user.TOTPLastStep = step
+	r.users[id] = user
+	return nil
+}
+
+func (r *MemoryUserRepository) UseRecoveryCode(ctx context.Context, id primitive.ObjectID, hash string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	i := slices.Index(user.RecoveryCodes, hash)
+	if i < 0 {
+		return ErrNotFound
+	}
+	user.RecoveryCodes = slices.Delete(user.RecoveryCodes, i, i+1)
+	r.users[id] = user
+	return nil
+}
+
+func (r *MemoryUserRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+
+	delete(r.byEmail, user.Email)
+	delete(r.users, id)
+	return nil
+}
+
+// cloneUser copies the user so callers never share the stored slices
+func cloneUser(user models.User) models.User {
+	user.Roles = slices.Clone(user.Roles)
+	user.RecoveryCodes = slices.Clone(user.RecoveryCodes)
+	return user
+}
@@ -0,0 +1,236 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go-restful-api/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMemoryUserRepositoryInsert(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryUserRepository()
+
+	user := &models.User{Name: "Ann", Email: "ann@example.com"}
+	if err := repo.Insert(ctx, user); err != nil {
+		t.Fatalf("Insert() error = %v", err)
+	}
+	if user.ID.IsZero() || user.CreatedAt.IsZero() {
+		t.Fatalf("Insert() did not assign ID and creation time: %+v", user)
+	}
+
+	tests := []struct {
+		name string
+		user *models.User
+		want error
+	}{
+		{"same email", &models.User{Email: "ann@example.com"}, ErrDuplicate},
+		{"same id", &models.User{ID: user.ID, Email: "other@example.com"}, ErrDuplicate},
+		{"new user", &models.User{Email: "bob@example.com"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := repo.Insert(ctx, tt.user); !errors.Is(err, tt.want) {
+				t.Errorf("Insert() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryUserRepositoryFind(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryUserRepository()
+	user := &models.User{Email: "ann@example.com", Roles: []string{models.RoleUser}}
+	if err := repo.Insert(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := repo.FindByID(ctx, user.ID)
+	if err != nil || found.Email != user.Email {
+		t.Fatalf("FindByID() = %+v, %v", found, err)
+	}
+	// Callers must not be able to change the stored user through slices
+	found.Roles[0] = models.RoleAdmin
+	again, _ := repo.FindByEmail(ctx, user.Email)
+	if again.Roles[0] != models.RoleUser {
+		t.Errorf("stored roles changed through a returned user: %v", again.Roles)
+	}
+
+	if _, err := repo.FindByID(ctx, primitive.NewObjectID()); !errors.Is(err, ErrNotFound) {
+		t.Errorf("FindByID(unknown) error = %v, want ErrNotFound", err)
+	}
+	if _, err := repo.FindByEmail(ctx, "nobody@example.com"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("FindByEmail(unknown) error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestMemoryUserRepositoryUpdate(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryUserRepository()
+	ann := &models.User{Email: "ann@example.com"}
+	bob := &models.User{Email: "bob@example.com"}
+	for _, u := range []*models.User{ann, bob} {
+		if err := repo.Insert(ctx, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		user models.User
+		want error
+	}{
+		{"unknown user", models.User{ID: primitive.NewObjectID(), Email: "new@example.com"}, ErrNotFound},
+		{"email of another user", models.User{ID: ann.ID, Email: "bob@example.com"}, ErrDuplicate},
+		{"same email", models.User{ID: ann.ID, Email: "ann@example.com", Name: "Ann"}, nil},
+		{"new email", models.User{ID: ann.ID, Email: "anna@example.com"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := repo.Update(ctx, &tt.user); !errors.Is(err, tt.want) {
+				t.Errorf("Update() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	// The old address is free again after the change
+	if _, err := repo.FindByEmail(ctx, "ann@example.com"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("FindByEmail(old email) error = %v, want ErrNotFound", err)
+	}
+	if found, err := repo.FindByEmail(ctx, "anna@example.com"); err != nil || found.ID != ann.ID {
+		t.Errorf("FindByEmail(new email) = %+v, %v", found, err)
+	}
+}
+
+func TestMemoryUserRepositoryMFAWrites(t *testing.T) {
+	testUserMFAWrites(t, NewMemoryUserRepository())
+}
+
+// testUserMFAWrites checks the conditional MFA writes of a UserRepository
+func testUserMFAWrites(t *testing.T, repo UserRepository) {
+	t.Helper()
+	ctx := context.Background()
+	user := &models.User{Name: "Ann", Email: "ann@example.com", Password: "hash"}
+	if err := repo.Insert(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+
+	user.TOTPSecret = "SECRET"
+	user.MFAEnabled = true
+	user.RecoveryCodes = []string{"a", "b"}
+	user.Name = "Not saved"
+	if err := repo.SetMFA(ctx, user); err != nil {
+		t.Fatalf("SetMFA() error = %v", err)
+	}
+
+	steps := []struct {
+		name string
+		run  func() error
+		want error
+	}{
+		{"first step", func() error { return repo.SaveTOTPStep(ctx, user.ID, 10) }, nil},
+		{"same step", func() error { return repo.SaveTOTPStep(ctx, user.ID, 10) }, ErrConflict},
+		{"older step", func() error { return repo.SaveTOTPStep(ctx, user.ID, 9) }, ErrConflict},
+		{"newer step", func() error { return repo.SaveTOTPStep(ctx, user.ID, 11) }, nil},
+		{"recovery code", func() error { return repo.UseRecoveryCode(ctx, user.ID, "a") }, nil},
+		{"used recovery code", func() error { return repo.UseRecoveryCode(ctx, user.ID, "a") }, ErrNotFound},
+		{"unknown recovery code", func() error { return repo.UseRecoveryCode(ctx, user.ID, "c") }, ErrNotFound},
+		{"unknown user", func() error { return repo.UseRecoveryCode(ctx, primitive.NewObjectID(), "b") }, ErrNotFound},
+	}
+	for _, tt := range steps {
+		if err := tt.run(); !errors.Is(err, tt.want) {
+			t.Errorf("%s: error = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	found, err := repo.FindByID(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.Name != "Ann" || found.TOTPSecret != "SECRET" || !found.MFAEnabled || found.TOTPLastStep != 11 {
+		t.Errorf("user = %+v, want only the MFA fields changed and step 11", found)
+	}
+	if len(found.RecoveryCodes) != 1 || found.RecoveryCodes[0] != "b" {
+		t.Errorf("recovery codes = %v, want [b]", found.RecoveryCodes)
+	}
+}
+
+func TestMemoryUserRepositoryDelete(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryUserRepository()
+	user := &models.User{Email: "ann@example.com"}
+	if err := repo.Insert(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := repo.Delete(ctx, user.ID); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if err := repo.Delete(ctx, user.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("second Delete() error = %v, want ErrNotFound", err)
+	}
+	// The email can be registered again
+	if err := repo.Insert(ctx, &models.User{Email: "ann@example.com"}); err != nil {
+		t.Errorf("Insert() after Delete() error = %v", err)
+	}
+}
+
+func TestMemoryUserRepositoryList(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryUserRepository()
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, u := range []models.User{
+		{Name: "Carol", Email: "carol@example.com"},
+		{Name: "alice", Email: "alice@test.org"},
+		{Name: "Bob", Email: "bob@example.com"},
+	} {
+		u.CreatedAt = base.Add(time.Duration(i) * time.Hour)
+		if err := repo.Insert(ctx, &u); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		opts      UserListOptions
+		wantNames []string
+		wantTotal int64
+	}{
+		{"creation time by default", UserListOptions{}, []string{"Carol", "alice", "Bob"}, 3},
+		{"descending", UserListOptions{Descending: true}, []string{"Bob", "alice", "Carol"}, 3},
+		{"by email", UserListOptions{SortBy: UserSortEmail}, []string{"alice", "Bob", "Carol"}, 3},
+		{"unknown sort field", UserListOptions{SortBy: "password"}, []string{"Carol", "alice", "Bob"}, 3},
+		{"name ignores case", UserListOptions{Name: "ALI"}, []string{"alice"}, 1},
+		{"email substring", UserListOptions{Email: "example"}, []string{"Carol", "Bob"}, 2},
+		{"created after is exclusive", UserListOptions{CreatedAfter: base}, []string{"alice", "Bob"}, 2},
+		{"created before is exclusive", UserListOptions{CreatedBefore: base.Add(2 * time.Hour)}, []string{"Carol", "alice"}, 2},
+		{"page", UserListOptions{Offset: 1, Limit: 1}, []string{"alice"}, 3},
+		{"offset past the end", UserListOptions{Offset: 5}, nil, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users, total, err := repo.List(ctx, tt.opts)
+			if err != nil {
+				t.Fatalf("List() error = %v", err)
+			}
+			if total != tt.wantTotal {
+				t.Errorf("List() total = %d, want %d", total, tt.wantTotal)
+			}
+			var names []string
+			for _, u := range users {
+				names = append(names, u.Name)
+			}
+			if len(names) != len(tt.wantNames) {
+				t.Fatalf("List() = %v, want %v", names, tt.wantNames)
+			}
+			for i := range names {
+				if names[i] != tt.wantNames[i] {
+					t.Fatalf("List() = %v, want %v", names, tt.wantNames)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go-restful-api/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var _ AccountTokenRepository = (*MongoAccountTokenRepository)(nil)
+
+// MongoAccountTokenRepository stores account tokens in the "account_tokens" collection
+type MongoAccountTokenRepository struct {
+	collection *mongo.Collection
+}
+
+// NewMongoAccountTokenRepository creates an AccountTokenRepository backed by MongoDB
+func NewMongoAccountTokenRepository(db *mongo.Database) *MongoAccountTokenRepository {
+	return &MongoAccountTokenRepository{collection: db.Collection("account_tokens")}
+}
+
+// EnsureIndexes creates the token hash, user and expiry (TTL) indexes
+func (r *MongoAccountTokenRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "token_hash", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "purpose", Value: 1}}},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+	return err
+}
+
+func (r *MongoAccountTokenRepository) Insert(ctx context.Context, token *models.AccountToken) error {
+	if token.ID.IsZero() {
+		token.ID = primitive.NewObjectID()
+	}
+
+	_, err := r.collection.InsertOne(ctx, token)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+func (r *MongoAccountTokenRepository) FindByHash(ctx context.Context, purpose, tokenHash string) (*models.AccountToken, error) {
+	var token models.AccountToken
+	err := r.collection.FindOne(ctx, bson.M{"token_hash": tokenHash, "purpose": purpose}).Decode(&token)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (r *MongoAccountTokenRepository) MarkUsed(ctx context.Context, id primitive.ObjectID, at time.Time) error {
+	filter := bson.M{"_id": id, "used_at": bson.M{"$exists": false}}
+	result, err := r.collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"used_at": at}})
+	if err != nil {
+		return err
+	}
+	if result.ModifiedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *MongoAccountTokenRepository) DeleteByUser(ctx context.Context, userID primitive.ObjectID, purpose string) error {
+	_, err := r.collection.DeleteMany(ctx, bson.M{"user_id": userID, "purpose": purpose})
+	return err
+}
@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go-restful-api/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var _ LoginAttemptRepository = (*MongoLoginAttemptRepository)(nil)
+
+// MongoLoginAttemptRepository stores login attempts in the "login_attempts"
+// collection, where a TTL index removes them after expiry
+type MongoLoginAttemptRepository struct {
+	collection *mongo.Collection
+}
+
+// NewMongoLoginAttemptRepository creates a LoginAttemptRepository backed by MongoDB
+func NewMongoLoginAttemptRepository(db *mongo.Database) *MongoLoginAttemptRepository {
+	return &MongoLoginAttemptRepository{collection: db.Collection("login_attempts")}
+}
+
+// EnsureIndexes creates the TTL index on expires_at
+func (r *MongoLoginAttemptRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	return err
+}
+
+func (r *MongoLoginAttemptRepository) Get(ctx context.Context, key string) (*models.LoginAttempt, error) {
+	var entry models.LoginAttempt
+	// The TTL monitor runs once a minute, so expiry is checked here as well
+	err := r.collection.FindOne(ctx, bson.M{"_id": key, "expires_at": bson.M{"$gt": time.Now()}}).Decode(&entry)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+func (r *MongoLoginAttemptRepository) RecordFailure(ctx context.Context, key string, at time.Time, window time.Duration) (*models.LoginAttempt, error) {
+	expiresAt := at.Add(window)
+	// An update pipeline evaluates every field against the stored document,
+	// so concurrent failures are counted without a read-modify-write race
+	active := bson.M{"$gt": bson.A{"$expires_at", at}}
+	update := mongo.Pipeline{{{Key: "$set", Value: bson.M{
+		"failures":        bson.M{"$cond": bson.A{active, bson.M{"$add": bson.A{"$failures", 1}}, 1}},
+		"locked_until":    bson.M{"$cond": bson.A{active, "$locked_until", "$$REMOVE"}},
+		"expires_at":      bson.M{"$cond": bson.A{active, bson.M{"$max": bson.A{"$expires_at", expiresAt}}, expiresAt}},
+		"last_failure_at": at,
+	}}}}
+
+	var entry models.LoginAttempt
+	err := r.collection.FindOneAndUpdate(ctx, bson.M{"_id": key}, update,
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)).Decode(&entry)
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+func (r *MongoLoginAttemptRepository) Lock(ctx context.Context, key string, until time.Time, window time.Duration) error {
+	update := mongo.Pipeline{{{Key: "$set", Value: bson.M{
+		"locked_until": until,
+		"expires_at":   bson.M{"$max": bson.A{"$expires_at", until.Add(window)}},
+	}}}}
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": key}, update, options.Update().SetUpsert(true))
+	return err
+}
+
+func (r *MongoLoginAttemptRepository) Reset(ctx context.Context, key string) error {
+	_, err := r.collection.DeleteOne(ctx, bson.M{"_id": key})
+	return err
+}
@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"go-restful-api/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var _ ProfileRepository = (*MongoProfileRepository)(nil)
+
+// MongoProfileRepository stores profiles in the "profiles" collection
+type MongoProfileRepository struct {
+	collection *mongo.Collection
+}
+
+// NewMongoProfileRepository creates a ProfileRepository backed by MongoDB
+func NewMongoProfileRepository(db *mongo.Database) *MongoProfileRepository {
+	return &MongoProfileRepository{collection: db.Collection("profiles")}
+}
+
+// EnsureIndexes creates the unique index on user_id
+func (r *MongoProfileRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "user_id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+func (r *MongoProfileRepository) FindByUserID(ctx context.Context, userID primitive.ObjectID) (*models.Profile, error) {
+	var profile models.Profile
+	err := r.collection.FindOne(ctx, bson.M{"user_id": userID}).Decode(&profile)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
+
+func (r *MongoProfileRepository) Insert(ctx context.Context, profile *models.Profile) error {
+	if profile.ID.IsZero() {
+		profile.ID = primitive.NewObjectID()
+	}
+
+	_, err := r.collection.InsertOne(ctx, profile)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+func (r *MongoProfileRepository) Update(ctx context.Context, profile *models.Profile) error {
+	result, err := r.collection.ReplaceOne(ctx, bson.M{"user_id": profile.UserID}, profile)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *MongoProfileRepository) DeleteByUserID(ctx context.Context, userID primitive.ObjectID) error {
+	result, err := r.collection.DeleteOne(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
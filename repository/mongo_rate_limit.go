@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"go-restful-api/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var _ RateLimitRepository = (*MongoRateLimitRepository)(nil)
+
+// MongoRateLimitRepository stores rate limiter buckets in the "rate_limits"
+// collection, where a TTL index removes them after expiry
+type MongoRateLimitRepository struct {
+	collection *mongo.Collection
+}
+
+// NewMongoRateLimitRepository creates a RateLimitRepository backed by MongoDB
+func NewMongoRateLimitRepository(db *mongo.Database) *MongoRateLimitRepository {
+	return &MongoRateLimitRepository{collection: db.Collection("rate_limits")}
+}
+
+// EnsureIndexes creates the TTL index on expires_at
+func (r *MongoRateLimitRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	return err
+}
+
+func (r *MongoRateLimitRepository) Get(ctx context.Context, key string) (*models.RateLimitBucket, error) {
+	var bucket models.RateLimitBucket
+	err := r.collection.FindOne(ctx, bson.M{"_id": key}).Decode(&bucket)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &bucket, nil
+}
+
+func (r *MongoRateLimitRepository) Save(ctx context.Context, bucket *models.RateLimitBucket) error {
+	next := *bucket
+	next.Version++
+
+	if bucket.Version == 0 {
+		_, err := r.collection.InsertOne(ctx, next)
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrConflict
+		}
+		if err != nil {
+			return err
+		}
+	} else {
+		result, err := r.collection.ReplaceOne(ctx, bson.M{"_id": bucket.Key, "version": bucket.Version}, next)
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount == 0 {
+			return ErrConflict
+		}
+	}
+
+	bucket.Version = next.Version
+	return nil
+}
@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go-restful-api/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var _ RefreshTokenRepository = (*MongoRefreshTokenRepository)(nil)
+
+// MongoRefreshTokenRepository stores refresh tokens in the "refresh_tokens" collection
+type MongoRefreshTokenRepository struct {
+	collection *mongo.Collection
+}
+
+// NewMongoRefreshTokenRepository creates a RefreshTokenRepository backed by MongoDB
+func NewMongoRefreshTokenRepository(db *mongo.Database) *MongoRefreshTokenRepository {
+	return &MongoRefreshTokenRepository{collection: db.Collection("refresh_tokens")}
+}
+
+// EnsureIndexes creates the token hash, family and expiry (TTL) indexes
+func (r *MongoRefreshTokenRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "token_hash", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "family_id", Value: 1}}},
+		{Keys: bson.D{{Key: "user_id", Value: 1}}},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+	return err
+}
+
+func (r *MongoRefreshTokenRepository) Insert(ctx context.Context, token *models.RefreshToken) error {
+	if token.ID.IsZero() {
+		token.ID = primitive.NewObjectID()
+	}
+
+	_, err := r.collection.InsertOne(ctx, token)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+func (r *MongoRefreshTokenRepository) FindByHash(ctx context.Context, tokenHash string) (*models.RefreshToken, error) {
+	var token models.RefreshToken
+	err := r.collection.FindOne(ctx, bson.M{"token_hash": tokenHash}).Decode(&token)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (r *MongoRefreshTokenRepository) MarkUsed(ctx context.Context, id primitive.ObjectID, at time.Time) error {
+	filter := bson.M{
+		"_id":        id,
+		"used_at":    bson.M{"$exists": false},
+		"revoked_at": bson.M{"$exists": false},
+	}
+	result, err := r.collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"used_at": at}})
+	if err != nil {
+		return err
+	}
+	if result.ModifiedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *MongoRefreshTokenRepository) RevokeFamily(ctx context.Context, familyID primitive.ObjectID, at time.Time) error {
+	return r.revoke(ctx, bson.M{"family_id": familyID}, at)
+}
+
+func (r *MongoRefreshTokenRepository) RevokeUser(ctx context.Context, userID primitive.ObjectID, at time.Time) error {
+	return r.revoke(ctx, bson.M{"user_id": userID}, at)
+}
+
+func (r *MongoRefreshTokenRepository) revoke(ctx context.Context, filter bson.M, at time.Time) error {
+	filter["revoked_at"] = bson.M{"$exists": false}
+	_, err := r.collection.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"revoked_at": at}})
+	return err
+}
@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var _ RevocationRepository = (*MongoRevocationRepository)(nil)
+
+type mongoRevocation struct {
+	Key       string    `bson:"_id"`
+	NotBefore time.Time `bson:"not_before,omitempty"`
+	ExpiresAt time.Time `bson:"expires_at"`
+}
+
+// MongoRevocationRepository stores revocations in the "revoked_tokens"
+// collection, where a TTL index removes them after expiry
+type MongoRevocationRepository struct {
+	collection *mongo.Collection
+}
+
+// NewMongoRevocationRepository creates a RevocationRepository backed by MongoDB
+func NewMongoRevocationRepository(db *mongo.Database) *MongoRevocationRepository {
+	return &MongoRevocationRepository{collection: db.Collection("revoked_tokens")}
+}
+
+// EnsureIndexes creates the TTL index on expires_at
+func (r *MongoRevocationRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	return err
+}
+
+func (r *MongoRevocationRepository) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	return r.put(ctx, mongoRevocation{Key: revokedTokenKey(jti), ExpiresAt: expiresAt})
+}
+
+func (r *MongoRevocationRepository) ClaimToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	_, err := r.collection.InsertOne(ctx, mongoRevocation{Key: revokedTokenKey(jti), ExpiresAt: expiresAt})
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+func (r *MongoRevocationRepository) RevokeUserTokens(ctx context.Context, userID primitive.ObjectID, issuedBefore, expiresAt time.Time) error {
+	return r.put(ctx, mongoRevocation{Key: revokedUserKey(userID), NotBefore: issuedBefore, ExpiresAt: expiresAt})
+}
+
+func (r *MongoRevocationRepository) put(ctx context.Context, entry mongoRevocation) error {
+	_, err := r.collection.ReplaceOne(ctx, bson.M{"_id": entry.Key}, entry, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (r *MongoRevocationRepository) IsRevoked(ctx context.Context, jti string, userID primitive.ObjectID, issuedAt time.Time) (bool, error) {
+	filter := bson.M{
+		// The TTL monitor runs once a minute, so expiry is checked here as well
+		"expires_at": bson.M{"$gt": time.Now()},
+		"$or": bson.A{
+			bson.M{"_id": revokedTokenKey(jti)},
+			bson.M{"_id": revokedUserKey(userID), "not_before": bson.M{"$gte": issuedAt}},
+		},
+	}
+	count, err := r.collection.CountDocuments(ctx, filter, options.Count().SetLimit(1))
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
@@ -0,0 +1,255 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"time"
+
+	"go-restful-api/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var _ UserRepository = (*MongoUserRepository)(nil)
+
+// MongoUserRepository stores users in the "users" collection
+type MongoUserRepository struct {
+	collection *mongo.Collection
+}
+
+// NewMongoUserRepository creates a UserRepository backed by MongoDB
+func NewMongoUserRepository(db *mongo.Database) *MongoUserRepository {
+	return &MongoUserRepository{collection: db.Collection("users")}
+}
+
+// EnsureIndexes creates the unique index on email and the created_at index
+// used for listings. Users stored before created_at existed get the creation
+// time encoded in their ObjectID, and users stored before email verification
+// existed are marked verified. Emails are normalized as well.
+func (r *MongoUserRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "email", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = r.collection.UpdateMany(ctx,
+		bson.M{"created_at": bson.M{"$exists": false}},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{"created_at": bson.M{"$toDate": "$_id"}}}}},
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.collection.UpdateMany(ctx,
+		bson.M{"email_verified": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"email_verified": true}},
+	)
+	if err != nil {
+		return err
+	}
+
+	return r.normalizeEmails(ctx)
+}
+
+// normalizeEmails lowercases and trims the emails stored before they were
+// normalized. It fails without changing anything when two users would end
+// up with the same address.
+func (r *MongoUserRepository) normalizeEmails(ctx context.Context) error {
+	cursor, err := r.collection.Find(ctx, bson.M{},
+		options.Find().SetProjection(bson.M{"email": 1}).SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		return err
+	}
+	var users []models.User
+	if err := cursor.All(ctx, &users); err != nil {
+		return err
+	}
+
+	byEmail := make(map[string][]string)
+	var emails []string
+	for _, user := range users {
+		email := models.NormalizeEmail(user.Email)
+		if byEmail[email] == nil {
+			emails = append(emails, email)
+		}
+		byEmail[email] = append(byEmail[email], user.ID.Hex())
+	}
+	var collisions [][]string
+	for _, email := range emails {
+		if ids := byEmail[email]; len(ids) > 1 {
+			collisions = append(collisions, ids)
+		}
+	}
+	if len(collisions) > 0 {
+		return emailCollisionError(collisions)
+	}
+
+	for _, user := range users {
+		email := models.NormalizeEmail(user.Email)
+		if email == user.Email {
+			continue
+		}
+		if _, err := r.collection.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$set": bson.M{"email": email}}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *MongoUserRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.User, error) {
+	return r.findOne(ctx, bson.M{"_id": id})
+}
+
+func (r *MongoUserRepository) FindByEmail(ctx context.Context, email string) (*models.User, error) {
+	return r.findOne(ctx, bson.M{"email": email})
+}
+
+func (r *MongoUserRepository) findOne(ctx context.Context, filter bson.M) (*models.User, error) {
+	var user models.User
+	err := r.collection.FindOne(ctx, filter).Decode(&user)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r *MongoUserRepository) List(ctx context.Context, opts UserListOptions) ([]models.User, int64, error) {
+	filter := bson.M{}
+	if opts.Name != "" {
+		filter["name"] = bson.M{"$regex": regexp.QuoteMeta(opts.Name), "$options": "i"}
+	}
+	if opts.Email != "" {
+		filter["email"] = bson.M{"$regex": regexp.QuoteMeta(opts.Email), "$options": "i"}
+	}
+	created := bson.M{}
+	if !opts.CreatedAfter.IsZero() {
+		created["$gt"] = opts.CreatedAfter
+	}
+	if !opts.CreatedBefore.IsZero() {
+		created["$lt"] = opts.CreatedBefore
+	}
+	if len(created) > 0 {
+		filter["created_at"] = created
+	}
+
+	total, err := r.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	direction := 1
+	if opts.Descending {
+		direction = -1
+	}
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: opts.sortField(), Value: direction}, {Key: "_id", Value: direction}}).
+		SetSkip(int64(opts.Offset))
+	if opts.Limit > 0 {
+		findOptions.SetLimit(int64(opts.Limit))
+	}
+
+	cursor, err := r.collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	users := []models.User{}
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, 0, err
+	}
+	return users, total, nil
+}
+
+func (r *MongoUserRepository) Insert(ctx context.Context, user *models.User) error {
+	if user.ID.IsZero() {
+		user.ID = primitive.NewObjectID()
+	}
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = time.Now().UTC()
+	}
+
+	_, err := r.collection.InsertOne(ctx, user)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+func (r *MongoUserRepository) Update(ctx context.Context, user *models.User) error {
+	result, err := r.collection.ReplaceOne(ctx, bson.M{"_id": user.ID}, user)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *MongoUserRepository) SetMFA(ctx context.Context, user *models.User) error {
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$set": bson.M{
+		"totp_secret":    user.TOTPSecret,
+		"mfa_enabled":    user.MFAEnabled,
+		"recovery_codes": user.RecoveryCodes,
+	}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *MongoUserRepository) SaveTOTPStep(ctx context.Context, id primitive.ObjectID, step int64) error {
+	// totp_last_step is omitted until the first code is accepted
+	filter := bson.M{"_id": id, "totp_last_step": bson.M{"$not": bson.M{"$gte": step}}}
+	result, err := r.collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"totp_last_step": step}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrConflict
+	}
+	return nil
+}
+
+func (r *MongoUserRepository) UseRecoveryCode(ctx context.Context, id primitive.ObjectID, hash string) error {
+	filter := bson.M{"_id": id, "recovery_codes": hash}
+	result, err := r.collection.UpdateOne(ctx, filter, bson.M{"$pull": bson.M{"recovery_codes": hash}})
+	if err != nil {
+		return err
+	}
+	if result.ModifiedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *MongoUserRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	result, err := r.collection.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
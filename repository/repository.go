@@ -0,0 +1,181 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go-restful-api/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	// ErrNotFound is returned when no record matches the query
+	ErrNotFound = errors.New("record not found")
+	// ErrDuplicate is returned when a write violates a uniqueness rule
+	ErrDuplicate = errors.New("duplicate record")
+	// ErrConflict is returned when a record changed since it was read
+	ErrConflict = errors.New("record changed concurrently")
+)
+
+// UserRepository persists user accounts
+type UserRepository interface {
+	FindByID(ctx context.Context, id primitive.ObjectID) (*models.User, error)
+	FindByEmail(ctx context.Context, email string) (*models.User, error)
+	// List returns the page of users selected by opts and the number of
+	// users matching its filters across all pages
+	List(ctx context.Context, opts UserListOptions) ([]models.User, int64, error)
+	// Insert stores a new user, assigning an ID and creation time when none are set.
+	// It returns ErrDuplicate when the email is already registered.
+	Insert(ctx context.Context, user *models.User) error
+	// Update replaces the stored user with the same ID.
+	// It returns ErrNotFound or ErrDuplicate on email conflicts.
+	Update(ctx context.Context, user *models.User) error
+	// SetMFA stores the TOTP secret, MFA flag and recovery codes of the
+	// user, leaving its other fields alone. It returns ErrNotFound.
+	SetMFA(ctx context.Context, user *models.User) error
+	// SaveTOTPStep records step as the last accepted TOTP step if the stored
+	// one is lower. It returns ErrConflict when it is not, so each code is
+	// accepted once.
+	SaveTOTPStep(ctx context.Context, id primitive.ObjectID, step int64) error
+	// UseRecoveryCode atomically removes the recovery code hash.
+	// It returns ErrNotFound when the user has no such code.
+	UseRecoveryCode(ctx context.Context, id primitive.ObjectID, hash string) error
+	Delete(ctx context.Context, id primitive.ObjectID) error
+}
+
+// Fields a user listing can be sorted by
+const (
+	UserSortCreatedAt = "created_at"
+	UserSortName      = "name"
+	UserSortEmail     = "email"
+)
+
+// UserListOptions filters, sorts and pages a user listing
+type UserListOptions struct {
+	// Name and Email match case-insensitive substrings
+	Name  string
+	Email string
+	// CreatedAfter and CreatedBefore are exclusive bounds, ignored when zero
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	// SortBy is one of the UserSort fields, creation time by default.
+	// Ties are broken by ID in the same direction.
+	SortBy     string
+	Descending bool
+	Offset     int
+	// Limit caps the page size, zero returns all remaining users
+	Limit int
+}
+
+// IsValidUserSort reports whether users can be sorted by the field
+func IsValidUserSort(field string) bool {
+	switch field {
+	case UserSortCreatedAt, UserSortName, UserSortEmail:
+		return true
+	}
+	return false
+}
+
+func (o UserListOptions) sortField() string {
+	if IsValidUserSort(o.SortBy) {
+		return o.SortBy
+	}
+	return UserSortCreatedAt
+}
+
+// ProfileRepository persists user profiles, at most one per user
+type ProfileRepository interface {
+	FindByUserID(ctx context.Context, userID primitive.ObjectID) (*models.Profile, error)
+	// Insert stores a new profile, assigning an ID when none is set.
+	// It returns ErrDuplicate when the user already has a profile.
+	Insert(ctx context.Context, profile *models.Profile) error
+	// Update replaces the stored profile of profile.UserID
+	Update(ctx context.Context, profile *models.Profile) error
+	DeleteByUserID(ctx context.Context, userID primitive.ObjectID) error
+}
+
+// RefreshTokenRepository persists refresh tokens for rotation and reuse detection
+type RefreshTokenRepository interface {
+	Insert(ctx context.Context, token *models.RefreshToken) error
+	FindByHash(ctx context.Context, tokenHash string) (*models.RefreshToken, error)
+	// MarkUsed atomically flags an unused, unrevoked token as used.
+	// It returns ErrNotFound when the token was already used or revoked.
+	MarkUsed(ctx context.Context, id primitive.ObjectID, at time.Time) error
+	RevokeFamily(ctx context.Context, familyID primitive.ObjectID, at time.Time) error
+	RevokeUser(ctx context.Context, userID primitive.ObjectID, at time.Time) error
+}
+
+// AccountTokenRepository persists single-use tokens mailed to users
+type AccountTokenRepository interface {
+	Insert(ctx context.Context, token *models.AccountToken) error
+	FindByHash(ctx context.Context, purpose, tokenHash string) (*models.AccountToken, error)
+	// MarkUsed atomically flags an unused token as used.
+	// It returns ErrNotFound when the token was already used.
+	MarkUsed(ctx context.Context, id primitive.ObjectID, at time.Time) error
+	// DeleteByUser removes every token of the user issued for the purpose
+	DeleteByUser(ctx context.Context, userID primitive.ObjectID, purpose string) error
+}
+
+// LoginAttemptRepository counts failed logins per key. Counters live in
+// storage so lockouts survive restarts and are shared by every replica.
+type LoginAttemptRepository interface {
+	// Get returns the unexpired entry of key, ErrNotFound if there is none
+	Get(ctx context.Context, key string) (*models.LoginAttempt, error)
+	// RecordFailure atomically counts a failure at the given time and returns
+	// the updated entry. An expired entry starts again at one failure. The
+	// entry lives at least until at+window.
+	RecordFailure(ctx context.Context, key string, at time.Time, window time.Duration) (*models.LoginAttempt, error)
+	// Lock locks key until the given time and keeps the entry for window after that
+	Lock(ctx context.Context, key string, until time.Time, window time.Duration) error
+	// Reset forgets key
+	Reset(ctx context.Context, key string) error
+}
+
+// RateLimitRepository stores rate limiter buckets. Writes use optimistic
+// concurrency, so processes sharing the store never lose a request.
+type RateLimitRepository interface {
+	// Get returns the bucket of key, ErrNotFound if there is none. Expired
+	// buckets may still be returned; callers treat them as stale state.
+	Get(ctx context.Context, key string) (*models.RateLimitBucket, error)
+	// Save stores the bucket if its Version matches the stored one, or
+	// creates it when Version is 0, and then increments Version. It returns
+	// ErrConflict when another writer got there first.
+	Save(ctx context.Context, bucket *models.RateLimitBucket) error
+}
+
+// RevocationRepository records access tokens revoked before their expiry.
+// Entries only need to live as long as the tokens they revoke.
+type RevocationRepository interface {
+	// RevokeToken revokes a single access token by its jti claim
+	RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error
+	// ClaimToken revokes a single token like RevokeToken, but returns
+	// ErrDuplicate when it was already revoked, so one-time tokens are
+	// accepted once
+	ClaimToken(ctx context.Context, jti string, expiresAt time.Time) error
+	// RevokeUserTokens revokes every access token of the user issued at or before issuedBefore
+	RevokeUserTokens(ctx context.Context, userID primitive.ObjectID, issuedBefore, expiresAt time.Time) error
+	// IsRevoked reports whether a token with the given jti, subject and issue time is revoked
+	IsRevoked(ctx context.Context, jti string, userID primitive.ObjectID, issuedAt time.Time) (bool, error)
+}
+
+func revokedTokenKey(jti string) string {
+	return "jti:" + jti
+}
+
+func revokedUserKey(userID primitive.ObjectID) string {
+	return "user:" + userID.Hex()
+}
+
+// emailCollisionError reports users whose emails only differ in case or
+// surrounding spaces. Each group holds the IDs of users sharing an address.
+func emailCollisionError(groups [][]string) error {
+	users := make([]string, len(groups))
+	for i, ids := range groups {
+		users[i] = strings.Join(ids, ", ")
+	}
+	return fmt.Errorf("emails collide once normalized, change them so they differ and migrate again: users %s",
+		strings.Join(users, "; users "))
+}
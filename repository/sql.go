@@ -0,0 +1,220 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"go-restful-api/config"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+
+	_ "github.com/jackc/pgx/v5/stdlib" // Register the "pgx" database/sql driver
+)
+
+// sqlDialect captures the differences between the supported SQL databases
+type sqlDialect struct {
+	name          string
+	driver        string
+	timestampType string
+	numbered      bool // $1, $2 placeholders instead of ?
+}
+
+var (
+	dialectSQLite = sqlDialect{
+		name:          config.StorageSQLite,
+		driver:        "sqlite",
+		timestampType: "TIMESTAMP",
+	}
+	dialectPostgres = sqlDialect{
+		name:          config.StoragePostgres,
+		driver:        "pgx",
+		timestampType: "TIMESTAMPTZ",
+		numbered:      true,
+	}
+)
+
+// rebind rewrites ? placeholders into the dialect's placeholder syntax
+func (d sqlDialect) rebind(query string) string {
+	if !d.numbered {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// objectIDTime returns an expression for the creation time stored in the
+// first four bytes of an ObjectID hex column
+func (d sqlDialect) objectIDTime(column string) string {
+	if d.name == config.StoragePostgres {
+		return `to_timestamp(('x' || substr(` + column + `, 1, 8))::bit(32)::bigint)`
+	}
+
+	// SQLite has no hex parsing, add up the eight digits by hand
+	digits := make([]string, 8)
+	for i := range digits {
+		digits[i] = fmt.Sprintf("(instr('0123456789abcdef', lower(substr(%s, %d, 1))) - 1) * %d",
+			column, i+1, 1<<(4*(7-i)))
+	}
+	return `datetime(` + strings.Join(digits, " + ") + `, 'unixepoch') || '+00:00'`
+}
+
+// sqlDB wraps a connection pool together with its dialect
+type sqlDB struct {
+	*sql.DB
+	dialect sqlDialect
+}
+
+func (db *sqlDB) exec(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	ctx, op := db.startSQL(ctx, query)
+	result, err := db.ExecContext(ctx, db.dialect.rebind(query), args...)
+	err = translateSQLError(err)
+	op.end(err)
+	return result, err
+}
+
+// queryRow runs the query right away; the span does not cover the later Scan
+func (db *sqlDB) queryRow(ctx context.Context, query string, args ...any) *sql.Row {
+	ctx, op := db.startSQL(ctx, query)
+	row := db.QueryRowContext(ctx, db.dialect.rebind(query), args...)
+	op.end(row.Err())
+	return row
+}
+
+// query returns once the first results are available; the span does not cover reading the rows
+func (db *sqlDB) query(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	ctx, op := db.startSQL(ctx, query)
+	rows, err := db.QueryContext(ctx, db.dialect.rebind(query), args...)
+	op.end(err)
+	return rows, err
+}
+
+// translateSQLError maps constraint violations onto the repository errors
+func translateSQLError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		switch sqliteErr.Code() {
+		case sqlite3.SQLITE_CONSTRAINT_UNIQUE, sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY:
+			return ErrDuplicate
+		case sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY:
+			return ErrNotFound
+		}
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case "23505": // unique_violation
+			return ErrDuplicate
+		case "23503": // foreign_key_violation
+			return ErrNotFound
+		}
+	}
+
+	return err
+}
+
+// rowsAffected turns an UPDATE or DELETE that matched nothing into ErrNotFound
+func rowsAffected(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func openSQL(ctx context.Context, driver string, cfg config.SQLConfig) (*Store, error) {
+	dialect := dialectSQLite
+	dsn := cfg.DSN
+	if driver == config.StoragePostgres {
+		dialect = dialectPostgres
+	} else {
+		dsn = sqliteDSN(dsn)
+	}
+
+	pool, err := sql.Open(dialect.driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s database: %w", dialect.name, err)
+	}
+	if cfg.MaxOpenConns > 0 {
+		pool.SetMaxOpenConns(cfg.MaxOpenConns)
+	}
+	if err := pool.PingContext(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("failed to connect to %s database: %w", dialect.name, err)
+	}
+
+	db := &sqlDB{DB: pool, dialect: dialect}
+	return &Store{
+		Users:         newSQLUserRepository(db),
+		Profiles:      newSQLProfileRepository(db),
+		RefreshTokens: newSQLRefreshTokenRepository(db),
+		Revocations:   newSQLRevocationRepository(db),
+		AccountTokens: newSQLAccountTokenRepository(db),
+		LoginAttempts: newSQLLoginAttemptRepository(db),
+		RateLimits:    newSQLRateLimitRepository(db),
+		migrate: func(ctx context.Context) error {
+			return migrateSQL(ctx, db)
+		},
+		ping: pool.PingContext,
+		close: func(context.Context) error {
+			return pool.Close()
+		},
+	}, nil
+}
+
+// sqliteDSN adds the connection parameters the repositories rely on: foreign
+// keys (off by default in SQLite, set per connection), a busy timeout for
+// concurrent writers and a time format that compares correctly as text
+func sqliteDSN(dsn string) string {
+	for _, param := range []string{"_pragma=foreign_keys(1)", "_pragma=busy_timeout(5000)", "_time_format=sqlite"} {
+		if strings.Contains(dsn, param) {
+			continue
+		}
+		sep := "?"
+		if strings.Contains(dsn, "?") {
+			sep = "&"
+		}
+		dsn += sep + param
+	}
+	return dsn
+}
+
+func nullTime(t *time.Time) sql.NullTime {
+	if t == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: t.UTC(), Valid: true}
+}
+
+func timePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"go-restful-api/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var _ AccountTokenRepository = (*SQLAccountTokenRepository)(nil)
+
+// SQLAccountTokenRepository stores account tokens in the "account_tokens" table
+type SQLAccountTokenRepository struct {
+	db *sqlDB
+}
+
+func newSQLAccountTokenRepository(db *sqlDB) *SQLAccountTokenRepository {
+	return &SQLAccountTokenRepository{db: db}
+}
+
+const accountTokenColumns = `id, user_id, purpose, token_hash, created_at, expires_at, used_at`
+
+func (r *SQLAccountTokenRepository) Insert(ctx context.Context, token *models.AccountToken) error {
+	if token.ID.IsZero() {
+		token.ID = primitive.NewObjectID()
+	}
+
+	// Expired tokens are never needed again, drop them as new ones come in
+	if _, err := r.db.exec(ctx, `DELETE FROM account_tokens WHERE expires_at < ?`, time.Now().UTC()); err != nil {
+		return err
+	}
+
+	_, err := r.db.exec(ctx, `INSERT INTO account_tokens (`+accountTokenColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		token.ID.Hex(), token.UserID.Hex(), token.Purpose, token.TokenHash,
+		token.CreatedAt.UTC(), token.ExpiresAt.UTC(), nullTime(token.UsedAt))
+	return err
+}
+
+func (r *SQLAccountTokenRepository) FindByHash(ctx context.Context, purpose, tokenHash string) (*models.AccountToken, error) {
+	var (
+		token      models.AccountToken
+		id, userID string
+		usedAt     sql.NullTime
+	)
+	err := r.db.queryRow(ctx, `SELECT `+accountTokenColumns+` FROM account_tokens WHERE token_hash = ? AND purpose = ?`, tokenHash, purpose).
+		Scan(&id, &userID, &token.Purpose, &token.TokenHash, &token.CreatedAt, &token.ExpiresAt, &usedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if token.ID, err = primitive.ObjectIDFromHex(id); err != nil {
+		return nil, err
+	}
+	if token.UserID, err = primitive.ObjectIDFromHex(userID); err != nil {
+		return nil, err
+	}
+	token.UsedAt = timePtr(usedAt)
+	return &token, nil
+}
+
+func (r *SQLAccountTokenRepository) MarkUsed(ctx context.Context, id primitive.ObjectID, at time.Time) error {
+	return rowsAffected(r.db.exec(ctx, `UPDATE account_tokens SET used_at = ? WHERE id = ? AND used_at IS NULL`,
+		at.UTC(), id.Hex()))
+}
+
+func (r *SQLAccountTokenRepository) DeleteByUser(ctx context.Context, userID primitive.ObjectID, purpose string) error {
+	_, err := r.db.exec(ctx, `DELETE FROM account_tokens WHERE user_id = ? AND purpose = ?`, userID.Hex(), purpose)
+	return err
+}
@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"go-restful-api/models"
+)
+
+var _ LoginAttemptRepository = (*SQLLoginAttemptRepository)(nil)
+
+// SQLLoginAttemptRepository stores login attempts in the "login_attempts" table
+type SQLLoginAttemptRepository struct {
+	db *sqlDB
+}
+
+func newSQLLoginAttemptRepository(db *sqlDB) *SQLLoginAttemptRepository {
+	return &SQLLoginAttemptRepository{db: db}
+}
+
+const loginAttemptColumns = `id, failures, last_failure_at, locked_until, expires_at`
+
+func scanLoginAttempt(row interface{ Scan(...any) error }) (*models.LoginAttempt, error) {
+	var (
+		entry       models.LoginAttempt
+		lockedUntil sql.NullTime
+	)
+	err := row.Scan(&entry.Key, &entry.Failures, &entry.LastFailureAt, &lockedUntil, &entry.ExpiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	entry.LockedUntil = timePtr(lockedUntil)
+	return &entry, nil
+}
+
+func (r *SQLLoginAttemptRepository) Get(ctx context.Context, key string) (*models.LoginAttempt, error) {
+	return scanLoginAttempt(r.db.queryRow(ctx, `SELECT `+loginAttemptColumns+` FROM login_attempts WHERE id = ? AND expires_at > ?`,
+		key, time.Now().UTC()))
+}
+
+func (r *SQLLoginAttemptRepository) RecordFailure(ctx context.Context, key string, at time.Time, window time.Duration) (*models.LoginAttempt, error) {
+	if _, err := r.db.exec(ctx, `DELETE FROM login_attempts WHERE expires_at < ?`, at.UTC()); err != nil {
+		return nil, err
+	}
+
+	// The upsert counts concurrent failures without a read-modify-write race.
+	// On conflict the login_attempts columns hold the stored values.
+	return scanLoginAttempt(r.db.queryRow(ctx, `INSERT INTO login_attempts (`+loginAttemptColumns+`) VALUES (?, 1, ?, NULL, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			failures = CASE WHEN login_attempts.expires_at > excluded.last_failure_at THEN login_attempts.failures + 1 ELSE 1 END,
+			locked_until = CASE WHEN login_attempts.expires_at > excluded.last_failure_at THEN login_attempts.locked_until ELSE NULL END,
+			expires_at = CASE WHEN login_attempts.expires_at > excluded.expires_at THEN login_attempts.expires_at ELSE excluded.expires_at END,
+			last_failure_at = excluded.last_failure_at
+		RETURNING `+loginAttemptColumns,
+		key, at.UTC(), at.Add(window).UTC()))
+}
+
+func (r *SQLLoginAttemptRepository) Lock(ctx context.Context, key string, until time.Time, window time.Duration) error {
+	_, err := r.db.exec(ctx, `INSERT INTO login_attempts (`+loginAttemptColumns+`) VALUES (?, 0, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			locked_until = excluded.locked_until,
+			expires_at = CASE WHEN login_attempts.expires_at > excluded.expires_at THEN login_attempts.expires_at ELSE excluded.expires_at END`,
+		key, time.Now().UTC(), until.UTC(), until.Add(window).UTC())
+	return err
+}
+
+func (r *SQLLoginAttemptRepository) Reset(ctx context.Context, key string) error {
+	_, err := r.db.exec(ctx, `DELETE FROM login_attempts WHERE id = ?`, key)
+	return err
+}
@@ -0,0 +1,287 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+// sqlMigration is one forward-only schema change
+type sqlMigration struct {
+	version    int
+	name       string
+	statements func(d sqlDialect) []string
+	// check, when set, runs before the statements and fails the migration
+	// when the stored data cannot be migrated
+	check func(ctx context.Context, tx *sql.Tx) error
+}
+
+// sqlMigrations lists every schema change in the order it must be applied.
+// Never edit an applied migration, append a new one instead.
+var sqlMigrations = []sqlMigration{
+	{
+		version: 1,
+		name:    "create users and profiles",
+		statements: func(d sqlDialect) []string {
+			return []string{
+				`CREATE TABLE users (
+					id       CHAR(24) PRIMARY KEY,
+					name     TEXT NOT NULL,
+					email    TEXT NOT NULL,
+					password TEXT NOT NULL
+				)`,
+				`CREATE UNIQUE INDEX users_email_key ON users (email)`,
+				`CREATE TABLE profiles (
+					id         CHAR(24) PRIMARY KEY,
+					user_id    CHAR(24) NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+					bio        TEXT NOT NULL DEFAULT '',
+					avatar     TEXT NOT NULL DEFAULT '',
+					created_at ` + d.timestampType + ` NOT NULL,
+					updated_at ` + d.timestampType + ` NOT NULL
+				)`,
+				`CREATE UNIQUE INDEX profiles_user_id_key ON profiles (user_id)`,
+			}
+		},
+	},
+	{
+		version: 2,
+		name:    "create refresh_tokens",
+		statements: func(d sqlDialect) []string {
+			return []string{
+				`CREATE TABLE refresh_tokens (
+					id         CHAR(24) PRIMARY KEY,
+					user_id    CHAR(24) NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+					family_id  CHAR(24) NOT NULL,
+					token_hash CHAR(64) NOT NULL,
+					created_at ` + d.timestampType + ` NOT NULL,
+					expires_at ` + d.timestampType + ` NOT NULL,
+					used_at    ` + d.timestampType + `,
+					revoked_at ` + d.timestampType + `
+				)`,
+				`CREATE UNIQUE INDEX refresh_tokens_token_hash_key ON refresh_tokens (token_hash)`,
+				`CREATE INDEX refresh_tokens_family_id_idx ON refresh_tokens (family_id)`,
+				`CREATE INDEX refresh_tokens_user_id_idx ON refresh_tokens (user_id)`,
+			}
+		},
+	},
+	{
+		version: 3,
+		name:    "create revoked_tokens",
+		statements: func(d sqlDialect) []string {
+			return []string{
+				`CREATE TABLE revoked_tokens (
+					id         VARCHAR(100) PRIMARY KEY,
+					not_before ` + d.timestampType + `,
+					expires_at ` + d.timestampType + ` NOT NULL
+				)`,
+				`CREATE INDEX revoked_tokens_expires_at_idx ON revoked_tokens (expires_at)`,
+			}
+		},
+	},
+	{
+		version: 4,
+		name:    "add users.roles",
+		statements: func(d sqlDialect) []string {
+			return []string{
+				// Comma-separated role names
+				`ALTER TABLE users ADD COLUMN roles TEXT NOT NULL DEFAULT 'user'`,
+			}
+		},
+	},
+	{
+		version: 5,
+		name:    "add users.created_at",
+		statements: func(d sqlDialect) []string {
+			return []string{
+				`ALTER TABLE users ADD COLUMN created_at ` + d.timestampType,
+				// Existing users get the creation time encoded in their ObjectID
+				`UPDATE users SET created_at = ` + d.objectIDTime("id"),
+				`CREATE INDEX users_created_at_idx ON users (created_at, id)`,
+			}
+		},
+	},
+	{
+		version: 6,
+		name:    "add users.email_verified and create account_tokens",
+		statements: func(d sqlDialect) []string {
+			return []string{
+				`ALTER TABLE users ADD COLUMN email_verified BOOLEAN NOT NULL DEFAULT FALSE`,
+				// Accounts created before verification existed stay usable
+				`UPDATE users SET email_verified = TRUE`,
+				`CREATE TABLE account_tokens (
+					id         CHAR(24) PRIMARY KEY,
+					user_id    CHAR(24) NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+					purpose    VARCHAR(32) NOT NULL,
+					token_hash CHAR(64) NOT NULL,
+					created_at ` + d.timestampType + ` NOT NULL,
+					expires_at ` + d.timestampType + ` NOT NULL,
+					used_at    ` + d.timestampType + `
+				)`,
+				`CREATE UNIQUE INDEX account_tokens_token_hash_key ON account_tokens (token_hash)`,
+				`CREATE INDEX account_tokens_user_id_idx ON account_tokens (user_id, purpose)`,
+			}
+		},
+	},
+	{
+		version: 7,
+		name:    "add users TOTP columns",
+		statements: func(d sqlDialect) []string {
+			return []string{
+				`ALTER TABLE users ADD COLUMN totp_secret TEXT NOT NULL DEFAULT ''`,
+				`ALTER TABLE users ADD COLUMN mfa_enabled BOOLEAN NOT NULL DEFAULT FALSE`,
+				// Comma-separated SHA-256 hashes
+				`ALTER TABLE users ADD COLUMN recovery_codes TEXT NOT NULL DEFAULT ''`,
+				`ALTER TABLE users ADD COLUMN totp_last_step BIGINT NOT NULL DEFAULT 0`,
+			}
+		},
+	},
+	{
+		version: 8,
+		name:    "create login_attempts",
+		statements: func(d sqlDialect) []string {
+			return []string{
+				// id is "account:<email>" or "ip:<address>"
+				`CREATE TABLE login_attempts (
+					id              VARCHAR(320) PRIMARY KEY,
+					failures        INTEGER NOT NULL,
+					last_failure_at ` + d.timestampType + ` NOT NULL,
+					locked_until    ` + d.timestampType + `,
+					expires_at      ` + d.timestampType + ` NOT NULL
+				)`,
+				`CREATE INDEX login_attempts_expires_at_idx ON login_attempts (expires_at)`,
+			}
+		},
+	},
+	{
+		version: 9,
+		name:    "create rate_limits",
+		statements: func(d sqlDialect) []string {
+			return []string{
+				`CREATE TABLE rate_limits (
+					id         VARCHAR(320) PRIMARY KEY,
+					value      DOUBLE PRECISION NOT NULL,
+					previous   DOUBLE PRECISION NOT NULL,
+					start      ` + d.timestampType + ` NOT NULL,
+					expires_at ` + d.timestampType + ` NOT NULL,
+					version    BIGINT NOT NULL
+				)`,
+				`CREATE INDEX rate_limits_expires_at_idx ON rate_limits (expires_at)`,
+			}
+		},
+	},
+	{
+		version: 10,
+		name:    "normalize users.email",
+		statements: func(d sqlDialect) []string {
+			return []string{
+				`UPDATE users SET email = LOWER(TRIM(email)) WHERE email <> LOWER(TRIM(email))`,
+			}
+		},
+		check: checkEmailCollisions,
+	},
+	{
+		version: 11,
+		name:    "add profiles.avatar_version",
+		statements: func(d sqlDialect) []string {
+			return []string{
+				`ALTER TABLE profiles ADD COLUMN avatar_version TEXT NOT NULL DEFAULT ''`,
+			}
+		},
+	},
+}
+
+// migrateSQL applies all migrations newer than the recorded schema version
+func migrateSQL(ctx context.Context, db *sqlDB) error {
+	_, err := db.exec(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		name       TEXT NOT NULL,
+		applied_at `+db.dialect.timestampType+` NOT NULL
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	var current int
+	err = db.queryRow(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current)
+	if err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	for _, m := range sqlMigrations {
+		if m.version <= current {
+			continue
+		}
+		if err := applySQLMigration(ctx, db, m); err != nil {
+			return fmt.Errorf("migration %d (%s) failed: %w", m.version, m.name, err)
+		}
+		log.Printf("Applied migration %d: %s", m.version, m.name)
+	}
+
+	return nil
+}
+
+func applySQLMigration(ctx context.Context, db *sqlDB, m sqlMigration) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if m.check != nil {
+		if err := m.check(ctx, tx); err != nil {
+			return err
+		}
+	}
+	for _, stmt := range m.statements(db.dialect) {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, db.dialect.rebind(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`),
+		m.version, m.name, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// checkEmailCollisions fails when two users have the same email once it is
+// normalized, since only one of them could keep it
+func checkEmailCollisions(ctx context.Context, tx *sql.Tx) error {
+	rows, err := tx.QueryContext(ctx, `SELECT id, LOWER(TRIM(email)) AS normalized FROM users
+		WHERE LOWER(TRIM(email)) IN (
+			SELECT LOWER(TRIM(email)) FROM users GROUP BY LOWER(TRIM(email)) HAVING COUNT(*) > 1
+		)
+		ORDER BY normalized, id`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var (
+		groups [][]string
+		last   string
+	)
+	for rows.Next() {
+		var id, email string
+		if err := rows.Scan(&id, &email); err != nil {
+			return err
+		}
+		if len(groups) == 0 || email != last {
+			groups = append(groups, nil)
+			last = email
+		}
+		groups[len(groups)-1] = append(groups[len(groups)-1], id)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(groups) > 0 {
+		return emailCollisionError(groups)
+	}
+	return nil
+}
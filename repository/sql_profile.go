@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"go-restful-api/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var _ ProfileRepository = (*SQLProfileRepository)(nil)
+
+// SQLProfileRepository stores profiles in the "profiles" table, which has a
+// unique user_id referencing users
+type SQLProfileRepository struct {
+	db *sqlDB
+}
+
+func newSQLProfileRepository(db *sqlDB) *SQLProfileRepository {
+	return &SQLProfileRepository{db: db}
+}
+
+const profileColumns = `id, user_id, bio, avatar, avatar_version, created_at, updated_at`
+
+func scanProfile(row interface{ Scan(...any) error }) (*models.Profile, error) {
+	var (
+		profile    models.Profile
+		id, userID string
+	)
+	err := row.Scan(&id, &userID, &profile.Bio, &profile.Avatar, &profile.AvatarVersion, &profile.CreatedAt, &profile.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if profile.ID, err = primitive.ObjectIDFromHex(id); err != nil {
+		return nil, err
+	}
+	if profile.UserID, err = primitive.ObjectIDFromHex(userID); err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
+
+func (r *SQLProfileRepository) FindByUserID(ctx context.Context, userID primitive.ObjectID) (*models.Profile, error) {
+	return scanProfile(r.db.queryRow(ctx, `SELECT `+profileColumns+` FROM profiles WHERE user_id = ?`, userID.Hex()))
+}
+
+func (r *SQLProfileRepository) Insert(ctx context.Context, profile *models.Profile) error {
+	if profile.ID.IsZero() {
+		profile.ID = primitive.NewObjectID()
+	}
+
+	_, err := r.db.exec(ctx, `INSERT INTO profiles (`+profileColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		profile.ID.Hex(), profile.UserID.Hex(), profile.Bio, profile.Avatar, profile.AvatarVersion, profile.CreatedAt.UTC(), profile.UpdatedAt.UTC())
+	return err
+}
+
+func (r *SQLProfileRepository) Update(ctx context.Context, profile *models.Profile) error {
+	return rowsAffected(r.db.exec(ctx, `UPDATE profiles SET bio = ?, avatar = ?, avatar_version = ?, updated_at = ? WHERE user_id = ?`,
+		profile.Bio, profile.Avatar, profile.AvatarVersion, profile.UpdatedAt.UTC(), profile.UserID.Hex()))
+}
+
+func (r *SQLProfileRepository) DeleteByUserID(ctx context.Context, userID primitive.ObjectID) error {
+	return rowsAffected(r.db.exec(ctx, `DELETE FROM profiles WHERE user_id = ?`, userID.Hex()))
+}
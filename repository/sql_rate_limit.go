@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"go-restful-api/models"
+)
+
+var _ RateLimitRepository = (*SQLRateLimitRepository)(nil)
+
+// SQLRateLimitRepository stores rate limiter buckets in the "rate_limits" table
+type SQLRateLimitRepository struct {
+	db *sqlDB
+}
+
+func newSQLRateLimitRepository(db *sqlDB) *SQLRateLimitRepository {
+	return &SQLRateLimitRepository{db: db}
+}
+
+const rateLimitColumns = `id, value, previous, start, expires_at, version`
+
+func (r *SQLRateLimitRepository) Get(ctx context.Context, key string) (*models.RateLimitBucket, error) {
+	var bucket models.RateLimitBucket
+	err := r.db.queryRow(ctx, `SELECT `+rateLimitColumns+` FROM rate_limits WHERE id = ?`, key).
+		Scan(&bucket.Key, &bucket.Value, &bucket.Previous, &bucket.Start, &bucket.ExpiresAt, &bucket.Version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &bucket, nil
+}
+
+func (r *SQLRateLimitRepository) Save(ctx context.Context, bucket *models.RateLimitBucket) error {
+	next := bucket.Version + 1
+
+	if bucket.Version == 0 {
+		// Expired buckets are never needed again, drop them as new ones come in
+		if _, err := r.db.exec(ctx, `DELETE FROM rate_limits WHERE expires_at < ?`, time.Now().UTC()); err != nil {
+			return err
+		}
+
+		_, err := r.db.exec(ctx, `INSERT INTO rate_limits (`+rateLimitColumns+`) VALUES (?, ?, ?, ?, ?, ?)`,
+			bucket.Key, bucket.Value, bucket.Previous, bucket.Start.UTC(), bucket.ExpiresAt.UTC(), next)
+		if errors.Is(err, ErrDuplicate) {
+			return ErrConflict
+		}
+		if err != nil {
+			return err
+		}
+	} else {
+		err := rowsAffected(r.db.exec(ctx, `UPDATE rate_limits SET value = ?, previous = ?, start = ?, expires_at = ?, version = ?
+			WHERE id = ? AND version = ?`,
+			bucket.Value, bucket.Previous, bucket.Start.UTC(), bucket.ExpiresAt.UTC(), next, bucket.Key, bucket.Version))
+		if errors.Is(err, ErrNotFound) {
+			return ErrConflict
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	bucket.Version = next
+	return nil
+}
@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"go-restful-api/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var _ RefreshTokenRepository = (*SQLRefreshTokenRepository)(nil)
+
+// SQLRefreshTokenRepository stores refresh tokens in the "refresh_tokens" table
+type SQLRefreshTokenRepository struct {
+	db *sqlDB
+}
+
+func newSQLRefreshTokenRepository(db *sqlDB) *SQLRefreshTokenRepository {
+	return &SQLRefreshTokenRepository{db: db}
+}
+
+const refreshTokenColumns = `id, user_id, family_id, token_hash, created_at, expires_at, used_at, revoked_at`
+
+func (r *SQLRefreshTokenRepository) Insert(ctx context.Context, token *models.RefreshToken) error {
+	if token.ID.IsZero() {
+		token.ID = primitive.NewObjectID()
+	}
+
+	// Expired tokens are never needed again, drop them as new ones come in
+	if _, err := r.db.exec(ctx, `DELETE FROM refresh_tokens WHERE expires_at < ?`, time.Now().UTC()); err != nil {
+		return err
+	}
+
+	_, err := r.db.exec(ctx, `INSERT INTO refresh_tokens (`+refreshTokenColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		token.ID.Hex(), token.UserID.Hex(), token.FamilyID.Hex(), token.TokenHash,
+		token.CreatedAt.UTC(), token.ExpiresAt.UTC(), nullTime(token.UsedAt), nullTime(token.RevokedAt))
+	return err
+}
+
+func (r *SQLRefreshTokenRepository) FindByHash(ctx context.Context, tokenHash string) (*models.RefreshToken, error) {
+	var (
+		token                models.RefreshToken
+		id, userID, familyID string
+		usedAt, revokedAt    sql.NullTime
+	)
+	err := r.db.queryRow(ctx, `SELECT `+refreshTokenColumns+` FROM refresh_tokens WHERE token_hash = ?`, tokenHash).
+		Scan(&id, &userID, &familyID, &token.TokenHash, &token.CreatedAt, &token.ExpiresAt, &usedAt, &revokedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if token.ID, err = primitive.ObjectIDFromHex(id); err != nil {
+		return nil, err
+	}
+	if token.UserID, err = primitive.ObjectIDFromHex(userID); err != nil {
+		return nil, err
+	}
+	if token.FamilyID, err = primitive.ObjectIDFromHex(familyID); err != nil {
+		return nil, err
+	}
+	token.UsedAt = timePtr(usedAt)
+	token.RevokedAt = timePtr(revokedAt)
+	return &token, nil
+}
+
+func (r *SQLRefreshTokenRepository) MarkUsed(ctx context.Context, id primitive.ObjectID, at time.Time) error {
+	return rowsAffected(r.db.exec(ctx,
+		`UPDATE refresh_tokens SET used_at = ? WHERE id = ? AND used_at IS NULL AND revoked_at IS NULL`,
+		at.UTC(), id.Hex()))
+}
+
+func (r *SQLRefreshTokenRepository) RevokeFamily(ctx context.Context, familyID primitive.ObjectID, at time.Time) error {
+	_, err := r.db.exec(ctx, `UPDATE refresh_tokens SET revoked_at = ? WHERE family_id = ? AND revoked_at IS NULL`,
+		at.UTC(), familyID.Hex())
+	return err
+}
+
+func (r *SQLRefreshTokenRepository) RevokeUser(ctx context.Context, userID primitive.ObjectID, at time.Time) error {
+	_, err := r.db.exec(ctx, `UPDATE refresh_tokens SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL`,
+		at.UTC(), userID.Hex())
+	return err
+}
@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var _ RevocationRepository = (*SQLRevocationRepository)(nil)
+
+// SQLRevocationRepository stores revocations in the "revoked_tokens" table
+type SQLRevocationRepository struct {
+	db *sqlDB
+}
+
+func newSQLRevocationRepository(db *sqlDB) *SQLRevocationRepository {
+	return &SQLRevocationRepository{db: db}
+}
+
+func (r *SQLRevocationRepository) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	return r.put(ctx, revokedTokenKey(jti), nil, expiresAt)
+}
+
+func (r *SQLRevocationRepository) ClaimToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	if _, err := r.db.exec(ctx, `DELETE FROM revoked_tokens WHERE expires_at < ?`, time.Now().UTC()); err != nil {
+		return err
+	}
+
+	// The primary key turns a second claim into ErrDuplicate
+	_, err := r.db.exec(ctx, `INSERT INTO revoked_tokens (id, expires_at) VALUES (?, ?)`,
+		revokedTokenKey(jti), expiresAt.UTC())
+	return err
+}
+
+func (r *SQLRevocationRepository) RevokeUserTokens(ctx context.Context, userID primitive.ObjectID, issuedBefore, expiresAt time.Time) error {
+	return r.put(ctx, revokedUserKey(userID), &issuedBefore, expiresAt)
+}
+
+func (r *SQLRevocationRepository) put(ctx context.Context, key string, notBefore *time.Time, expiresAt time.Time) error {
+	if _, err := r.db.exec(ctx, `DELETE FROM revoked_tokens WHERE expires_at < ?`, time.Now().UTC()); err != nil {
+		return err
+	}
+
+	_, err := r.db.exec(ctx, `INSERT INTO revoked_tokens (id, not_before, expires_at) VALUES (?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET not_before = excluded.not_before, expires_at = excluded.expires_at`,
+		key, nullTime(notBefore), expiresAt.UTC())
+	return err
+}
+
+func (r *SQLRevocationRepository) IsRevoked(ctx context.Context, jti string, userID primitive.ObjectID, issuedAt time.Time) (bool, error) {
+	var count int
+	err := r.db.queryRow(ctx, `SELECT COUNT(*) FROM revoked_tokens WHERE expires_at > ?
+		AND (id = ? OR (id = ? AND not_before >= ?))`,
+		time.Now().UTC(), revokedTokenKey(jti), revokedUserKey(userID), issuedAt.UTC()).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
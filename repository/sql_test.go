@@ -0,0 +1,241 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go-restful-api/config"
+	"go-restful-api/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// openTestSQLite opens a fresh SQLite database in a temporary directory
+func openTestSQLite(t *testing.T) (*Store, *sqlDB) {
+	t.Helper()
+	ctx := context.Background()
+	store, err := openSQL(ctx, config.StorageSQLite, config.SQLConfig{DSN: filepath.Join(t.TempDir(), "test.db")})
+	if err != nil {
+		t.Fatalf("openSQL() error = %v", err)
+	}
+	t.Cleanup(func() { store.Close(ctx) })
+	return store, store.Users.(*SQLUserRepository).db
+}
+
+func TestSQLDialectRebind(t *testing.T) {
+	tests := []struct {
+		name    string
+		dialect sqlDialect
+		query   string
+		want    string
+	}{
+		{"sqlite keeps question marks", dialectSQLite, "SELECT * FROM users WHERE id = ? AND email = ?", "SELECT * FROM users WHERE id = ? AND email = ?"},
+		{"postgres numbers placeholders", dialectPostgres, "SELECT * FROM users WHERE id = ? AND email = ?", "SELECT * FROM users WHERE id = $1 AND email = $2"},
+		{"postgres without placeholders", dialectPostgres, "SELECT 1", "SELECT 1"},
+		{"postgres past nine", dialectPostgres, "VALUES (?,?,?,?,?,?,?,?,?,?)", "VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10)"},
+		{"multibyte text", dialectPostgres, "SELECT 'é' WHERE a = ?", "SELECT 'é' WHERE a = $1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.dialect.rebind(tt.query); got != tt.want {
+				t.Errorf("rebind() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSQLiteDSN(t *testing.T) {
+	const params = "_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_time_format=sqlite"
+	tests := []struct {
+		dsn  string
+		want string
+	}{
+		{"app.db", "app.db?" + params},
+		{"file:app.db?mode=rwc", "file:app.db?mode=rwc&" + params},
+		{"app.db?_pragma=foreign_keys(1)", "app.db?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_time_format=sqlite"},
+		{"app.db?" + params, "app.db?" + params},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dsn, func(t *testing.T) {
+			if got := sqliteDSN(tt.dsn); got != tt.want {
+				t.Errorf("sqliteDSN() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSQLMigrationsAreOrdered(t *testing.T) {
+	for i, m := range sqlMigrations {
+		if m.version != i+1 {
+			t.Errorf("migration %q has version %d, want %d", m.name, m.version, i+1)
+		}
+		for _, d := range []sqlDialect{dialectSQLite, dialectPostgres} {
+			if len(m.statements(d)) == 0 {
+				t.Errorf("migration %d has no statements for %s", m.version, d.name)
+			}
+		}
+	}
+}
+
+func TestMigrateSQL(t *testing.T) {
+	ctx := context.Background()
+	store, db := openTestSQLite(t)
+
+	// Migrating an up-to-date schema is a no-op
+	for range 2 {
+		if err := store.Migrate(ctx); err != nil {
+			t.Fatalf("Migrate() error = %v", err)
+		}
+	}
+
+	var version, applied int
+	if err := db.queryRow(ctx, `SELECT MAX(version), COUNT(*) FROM schema_migrations`).Scan(&version, &applied); err != nil {
+		t.Fatal(err)
+	}
+	if last := sqlMigrations[len(sqlMigrations)-1].version; version != last || applied != len(sqlMigrations) {
+		t.Errorf("schema_migrations has %d entries up to %d, want %d up to %d", applied, version, len(sqlMigrations), last)
+	}
+
+	// Deleting a user cascades to their profile
+	user := &models.User{Name: "Ann", Email: "ann@example.com", Password: "x"}
+	if err := store.Users.Insert(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Profiles.Insert(ctx, &models.Profile{UserID: user.ID, CreatedAt: time.Now(), UpdatedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Users.Delete(ctx, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Profiles.FindByUserID(ctx, user.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("FindByUserID() after deleting the user error = %v, want ErrNotFound", err)
+	}
+}
+
+// migrateBeforeEmailNormalization migrates a fresh database up to the
+// migration that normalizes emails, so users can be stored the way older
+// versions did
+func migrateBeforeEmailNormalization(t *testing.T) (*Store, *sqlDB) {
+	t.Helper()
+	store, db := openTestSQLite(t)
+
+	all := sqlMigrations
+	sqlMigrations = all[:9]
+	err := store.Migrate(context.Background())
+	sqlMigrations = all
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store, db
+}
+
+// insertRawUser stores a user with the email exactly as given and returns its ID
+func insertRawUser(t *testing.T, db *sqlDB, name, email string) string {
+	t.Helper()
+	id := primitive.NewObjectID().Hex()
+	_, err := db.exec(context.Background(), `INSERT INTO users (id, name, email, password, created_at) VALUES (?, ?, ?, '', ?)`,
+		id, name, email, time.Now().UTC())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestMigrateSQLNormalizesEmails(t *testing.T) {
+	ctx := context.Background()
+	store, db := migrateBeforeEmailNormalization(t)
+
+	tests := []struct {
+		name  string
+		email string
+		want  string
+	}{
+		{"mixed", " Ann@Example.com", "ann@example.com"},
+		{"upper", "BOB@example.com", "bob@example.com"},
+		{"clean", "carol@example.com", "carol@example.com"},
+	}
+	for _, tt := range tests {
+		insertRawUser(t, db, tt.name, tt.email)
+	}
+
+	if err := store.Migrate(ctx); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var email string
+			if err := db.queryRow(ctx, `SELECT email FROM users WHERE name = ?`, tt.name).Scan(&email); err != nil {
+				t.Fatal(err)
+			}
+			if email != tt.want {
+				t.Errorf("email = %q, want %q", email, tt.want)
+			}
+		})
+	}
+}
+
+func TestMigrateSQLEmailCollisions(t *testing.T) {
+	ctx := context.Background()
+	store, db := migrateBeforeEmailNormalization(t)
+
+	colliding := []string{
+		insertRawUser(t, db, "upper", "BOB@example.com"),
+		insertRawUser(t, db, "lower", "bob@example.com"),
+	}
+	insertRawUser(t, db, "mixed", " Ann@Example.com")
+
+	err := store.Migrate(ctx)
+	if err == nil {
+		t.Fatal("Migrate() with colliding emails succeeded")
+	}
+	for _, id := range colliding {
+		if !strings.Contains(err.Error(), id) {
+			t.Errorf("Migrate() error = %v, want it to list user %s", err, id)
+		}
+	}
+
+	// Nothing was changed, not even the emails that could be normalized
+	var email string
+	if err := db.queryRow(ctx, `SELECT email FROM users WHERE name = 'mixed'`).Scan(&email); err != nil {
+		t.Fatal(err)
+	}
+	if email != " Ann@Example.com" {
+		t.Errorf("email = %q, want it unchanged", email)
+	}
+	var version int
+	if err := db.queryRow(ctx, `SELECT MAX(version) FROM schema_migrations`).Scan(&version); err != nil {
+		t.Fatal(err)
+	}
+	if version != 9 {
+		t.Errorf("schema version = %d, want 9", version)
+	}
+}
+
+func TestSQLConditionalWrites(t *testing.T) {
+	store, _ := openTestSQLite(t)
+	if err := store.Migrate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	testUserMFAWrites(t, store.Users)
+	testClaimToken(t, store.Revocations)
+}
+
+func TestSQLObjectIDTime(t *testing.T) {
+	ctx := context.Background()
+	_, db := openTestSQLite(t)
+
+	created := time.Date(2026, 10, 18, 11, 30, 15, 0, time.UTC)
+	id := primitive.NewObjectIDFromTimestamp(created)
+
+	var got string
+	if err := db.queryRow(ctx, `SELECT `+db.dialect.objectIDTime("'"+id.Hex()+"'")).Scan(&got); err != nil {
+		t.Fatal(err)
+	}
+	if want := "2026-10-18 11:30:15+00:00"; got != want {
+		t.Errorf("objectIDTime() = %q, want %q", got, want)
+	}
+}
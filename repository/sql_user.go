@@ -0,0 +1,205 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"go-restful-api/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var _ UserRepository = (*SQLUserRepository)(nil)
+
+// SQLUserRepository stores users in the "users" table. IDs are kept as
+// ObjectID hex strings so the API contract is the same as with MongoDB.
+type SQLUserRepository struct {
+	db *sqlDB
+}
+
+func newSQLUserRepository(db *sqlDB) *SQLUserRepository {
+	return &SQLUserRepository{db: db}
+}
+
+const userColumns = `id, name, email, password, roles, created_at, email_verified, totp_secret, mfa_enabled, recovery_codes, totp_last_step`
+
+func scanUser(row interface{ Scan(...any) error }) (*models.User, error) {
+	var (
+		user          models.User
+		id, roles     string
+		recoveryCodes string
+		createdAt     sql.NullTime
+	)
+	err := row.Scan(&id, &user.Name, &user.Email, &user.Password, &roles, &createdAt, &user.EmailVerified,
+		&user.TOTPSecret, &user.MFAEnabled, &recoveryCodes, &user.TOTPLastStep)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+	user.ID = objID
+	user.CreatedAt = createdAt.Time
+	if roles != "" {
+		user.Roles = strings.Split(roles, ",")
+	}
+	if recoveryCodes != "" {
+		user.RecoveryCodes = strings.Split(recoveryCodes, ",")
+	}
+	return &user, nil
+}
+
+func (r *SQLUserRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.User, error) {
+	return scanUser(r.db.queryRow(ctx, `SELECT `+userColumns+` FROM users WHERE id = ?`, id.Hex()))
+}
+
+func (r *SQLUserRepository) FindByEmail(ctx context.Context, email string) (*models.User, error) {
+	return scanUser(r.db.queryRow(ctx, `SELECT `+userColumns+` FROM users WHERE email = ?`, email))
+}
+
+func (r *SQLUserRepository) List(ctx context.Context, opts UserListOptions) ([]models.User, int64, error) {
+	var (
+		where []string
+		args  []any
+	)
+	if opts.Name != "" {
+		where = append(where, `LOWER(name) LIKE ? ESCAPE '\'`)
+		args = append(args, likePattern(opts.Name))
+	}
+	if opts.Email != "" {
+		where = append(where, `LOWER(email) LIKE ? ESCAPE '\'`)
+		args = append(args, likePattern(opts.Email))
+	}
+	if !opts.CreatedAfter.IsZero() {
+		where = append(where, `created_at > ?`)
+		args = append(args, opts.CreatedAfter.UTC())
+	}
+	if !opts.CreatedBefore.IsZero() {
+		where = append(where, `created_at < ?`)
+		args = append(args, opts.CreatedBefore.UTC())
+	}
+
+	filter := ""
+	if len(where) > 0 {
+		filter = ` WHERE ` + strings.Join(where, ` AND `)
+	}
+
+	var total int64
+	if err := r.db.queryRow(ctx, `SELECT COUNT(*) FROM users`+filter, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	// The sort field is one of the UserSort constants, never user input
+	direction := ` ASC`
+	if opts.Descending {
+		direction = ` DESC`
+	}
+	query := `SELECT ` + userColumns + ` FROM users` + filter +
+		` ORDER BY ` + opts.sortField() + direction + `, id` + direction
+	// Neither database accepts OFFSET without a LIMIT in the same syntax
+	limit := int64(math.MaxInt64)
+	if opts.Limit > 0 {
+		limit = int64(opts.Limit)
+	}
+	query += ` LIMIT ? OFFSET ?`
+	args = append(args, limit, opts.Offset)
+
+	rows, err := r.db.query(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	users := []models.User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		users = append(users, *user)
+	}
+	return users, total, rows.Err()
+}
+
+// likePattern builds a case-insensitive substring pattern, escaping the
+// LIKE wildcards in s
+func likePattern(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(strings.ToLower(s))
+	return "%" + s + "%"
+}
+
+func (r *SQLUserRepository) Insert(ctx context.Context, user *models.User) error {
+	if user.ID.IsZero() {
+		user.ID = primitive.NewObjectID()
+	}
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = time.Now().UTC()
+	}
+
+	_, err := r.db.exec(ctx, `INSERT INTO users (`+userColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		user.ID.Hex(), user.Name, user.Email, user.Password, strings.Join(user.Roles, ","), user.CreatedAt.UTC(), user.EmailVerified,
+		user.TOTPSecret, user.MFAEnabled, strings.Join(user.RecoveryCodes, ","), user.TOTPLastStep)
+	return err
+}
+
+func (r *SQLUserRepository) Update(ctx context.Context, user *models.User) error {
+	return rowsAffected(r.db.exec(ctx, `UPDATE users SET name = ?, email = ?, password = ?, roles = ?, email_verified = ?,
+		totp_secret = ?, mfa_enabled = ?, recovery_codes = ?, totp_last_step = ? WHERE id = ?`,
+		user.Name, user.Email, user.Password, strings.Join(user.Roles, ","), user.EmailVerified,
+		user.TOTPSecret, user.MFAEnabled, strings.Join(user.RecoveryCodes, ","), user.TOTPLastStep, user.ID.Hex()))
+}
+
+func (r *SQLUserRepository) SetMFA(ctx context.Context, user *models.User) error {
+	return rowsAffected(r.db.exec(ctx, `UPDATE users SET totp_secret = ?, mfa_enabled = ?, recovery_codes = ? WHERE id = ?`,
+		user.TOTPSecret, user.MFAEnabled, strings.Join(user.RecoveryCodes, ","), user.ID.Hex()))
+}
+
+func (r *SQLUserRepository) SaveTOTPStep(ctx context.Context, id primitive.ObjectID, step int64) error {
+	err := rowsAffected(r.db.exec(ctx, `UPDATE users SET totp_last_step = ? WHERE id = ? AND totp_last_step < ?`,
+		step, id.Hex(), step))
+	if errors.Is(err, ErrNotFound) {
+		return ErrConflict
+	}
+	return err
+}
+
+// UseRecoveryCode removes the hash from the comma separated column with a
+// compare-and-swap, retried when another write changed the codes in between
+func (r *SQLUserRepository) UseRecoveryCode(ctx context.Context, id primitive.ObjectID, hash string) error {
+	for {
+		var stored string
+		err := r.db.queryRow(ctx, `SELECT recovery_codes FROM users WHERE id = ?`, id.Hex()).Scan(&stored)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		codes := strings.Split(stored, ",")
+		i := slices.Index(codes, hash)
+		if stored == "" || i < 0 {
+			return ErrNotFound
+		}
+		remaining := strings.Join(slices.Delete(codes, i, i+1), ",")
+
+		err = rowsAffected(r.db.exec(ctx, `UPDATE users SET recovery_codes = ? WHERE id = ? AND recovery_codes = ?`,
+			remaining, id.Hex(), stored))
+		if !errors.Is(err, ErrNotFound) {
+			return err
+		}
+	}
+}
+
+func (r *SQLUserRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	return rowsAffected(r.db.exec(ctx, `DELETE FROM users WHERE id = ?`, id.Hex()))
+}
@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"go-restful-api/config"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Store bundles the repositories of one storage backend
+type Store struct {
+	Users         UserRepository
+	Profiles      ProfileRepository
+	RefreshTokens RefreshTokenRepository
+	Revocations   RevocationRepository
+	AccountTokens AccountTokenRepository
+	LoginAttempts LoginAttemptRepository
+	RateLimits    RateLimitRepository
+
+	migrate func(ctx context.Context) error
+	ping    func(ctx context.Context) error
+	close   func(ctx context.Context) error
+}
+
+// Open creates the repositories for the configured storage driver
+func Open(ctx context.Context, cfg *config.Config) (*Store, error) {
+	switch cfg.Storage.Driver {
+	case config.StorageMemory:
+		log.Println("Using in-memory storage, data is lost on restart")
+		return NewMemoryStore(), nil
+	case config.StorageMongo:
+		return openMongo(ctx, cfg.Mongo)
+	case config.StorageSQLite, config.StoragePostgres:
+		return openSQL(ctx, cfg.Storage.Driver, cfg.SQL)
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", cfg.Storage.Driver)
+	}
+}
+
+// NewMemoryStore creates a Store that keeps everything in process memory
+func NewMemoryStore() *Store {
+	return &Store{
+		Users:         NewMemoryUserRepository(),
+		Profiles:      NewMemoryProfileRepository(),
+		RefreshTokens: NewMemoryRefreshTokenRepository(),
+		Revocations:   NewMemoryRevocationRepository(),
+		AccountTokens: NewMemoryAccountTokenRepository(),
+		LoginAttempts: NewMemoryLoginAttemptRepository(),
+		RateLimits:    NewMemoryRateLimitRepository(),
+	}
+}
+
+func openMongo(ctx context.Context, cfg config.MongoConfig) (*Store, error) {
+	db, err := config.ConnectDatabase(cfg, options.Client().SetMonitor(newMongoMonitor(cfg.Database)))
+	if err != nil {
+		return nil, err
+	}
+
+	users := NewMongoUserRepository(db)
+	profiles := NewMongoProfileRepository(db)
+	refreshTokens := NewMongoRefreshTokenRepository(db)
+	revocations := NewMongoRevocationRepository(db)
+	accountTokens := NewMongoAccountTokenRepository(db)
+	loginAttempts := NewMongoLoginAttemptRepository(db)
+	rateLimits := NewMongoRateLimitRepository(db)
+
+	return &Store{
+		Users:         users,
+		Profiles:      profiles,
+		RefreshTokens: refreshTokens,
+		Revocations:   revocations,
+		AccountTokens: accountTokens,
+		LoginAttempts: loginAttempts,
+		RateLimits:    rateLimits,
+		migrate: func(ctx context.Context) error {
+			// Unique and TTL indexes back the uniqueness and expiry rules of each repository
+			for _, repo := range []interface{ EnsureIndexes(context.Context) error }{
+				users, profiles, refreshTokens, revocations, accountTokens, loginAttempts, rateLimits,
+			} {
+				if err := repo.EnsureIndexes(ctx); err != nil {
+					return fmt.Errorf("failed to create indexes: %w", err)
+				}
+			}
+			return nil
+		},
+		ping: func(ctx context.Context) error {
+			return db.Client().Ping(ctx, nil)
+		},
+		close: db.Client().Disconnect,
+	}, nil
+}
+
+// Migrate brings the schema up to date: SQL migrations for the SQL
+// backends and indexes for MongoDB. It is a no-op for the memory backend.
+func (s *Store) Migrate(ctx context.Context) error {
+	if s.migrate == nil {
+		return nil
+	}
+	return s.migrate(ctx)
+}
+
+// Ping checks that the backend is reachable. The memory backend always is.
+func (s *Store) Ping(ctx context.Context) error {
+	if s.ping == nil {
+		return nil
+	}
+	return s.ping(ctx)
+}
+
+// Close releases the connections held by the backend
+func (s *Store) Close(ctx context.Context) error {
+	if s.close == nil {
+		return nil
+	}
+	return s.close(ctx)
+}
@@ -0,0 +1,29 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"go-restful-api/controllers"
+)
+
+// RegisterAuthRoutes registers session management routes
+func RegisterAuthRoutes(api *gin.RouterGroup, auth *controllers.AuthController, authMiddleware gin.HandlerFunc, limits RateLimits) {
+	authRoutes := api.Group("/auth")
+	{
+		// Public routes: the mailed or refresh token itself is the credential
+		authRoutes.POST("/refresh", auth.RefreshToken)
+		authRoutes.POST("/verify-email", limits.Auth, auth.VerifyEmail)
+		authRoutes.POST("/resend-verification", limits.Auth, auth.ResendVerification)
+		authRoutes.POST("/forgot-password", limits.Auth, auth.ForgotPassword)
+		authRoutes.POST("/reset-password", limits.Auth, auth.ResetPassword)
+		authRoutes.POST("/mfa/verify", limits.Auth, auth.VerifyMFA)
+
+		// Protected routes: Require authentication
+		authRoutes.Use(authMiddleware)
+
+		authRoutes.POST("/logout", auth.Logout)
+		authRoutes.POST("/logout-all", auth.LogoutAll)
+		authRoutes.POST("/mfa/enroll", auth.EnrollMFA)
+		authRoutes.POST("/mfa/confirm", auth.ConfirmMFA)
+		authRoutes.POST("/mfa/disable", auth.DisableMFA)
+	}
+}
@@ -0,0 +1,13 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"go-restful-api/controllers"
+)
+
+// RegisterHealthRoutes registers the liveness and readiness probes at the
+// server root, outside authentication and rate limiting
+func RegisterHealthRoutes(router *gin.Engine, health *controllers.HealthController) {
+	router.GET("/healthz", health.Live)
+	router.GET("/readyz", health.Ready)
+}
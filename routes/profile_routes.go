@@ -3,18 +3,21 @@ package routes
 import (
 	"github.com/gin-gonic/gin"
 	"go-restful-api/controllers"
-	"go-restful-api/middleware"
 )
 
-func RegiterProfileRoutes(api *gin.RouterGroup) {
+func RegiterProfileRoutes(api *gin.RouterGroup, profiles *controllers.ProfileController, auth gin.HandlerFunc, limits RateLimits) {
 	profileRoutes := api.Group("/profiles")
 	{
 		// Protected route: Require Authenticated
-		profileRoutes.Use(middleware.AuthMiddleware())
+		profileRoutes.Use(auth)
 
-		profileRoutes.POST("/",controllers.CreateProfileByUserID)
-		profileRoutes.GET("/", controllers.GetProfileByUserID)
-		profileRoutes.PUT("/", controllers.UpdateProfileByUserID)
-		profileRoutes.DELETE("/", controllers.DeleteProfileByUserID)
+		profileRoutes.POST("/", profiles.CreateProfileByUserID)
+		profileRoutes.GET("/", limits.ProfileRead, profiles.GetProfileByUserID)
+		profileRoutes.PUT("/", profiles.UpdateProfileByUserID)
+		profileRoutes.DELETE("/", profiles.DeleteProfileByUserID)
+		profileRoutes.PUT("/avatar", profiles.UploadAvatar)
 	}
-}
\ No newline at end of file
+
+	// Public so avatars can be used in <img> tags
+	api.GET("/profiles/:userId/avatar", profiles.GetAvatar)
+}
@@ -0,0 +1,95 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go-restful-api/blob"
+	"go-restful-api/config"
+	"go-restful-api/controllers"
+	"go-restful-api/middleware"
+	"go-restful-api/models"
+	"go-restful-api/repository"
+	"go-restful-api/services"
+	"go-restful-api/utils"
+)
+
+// TestProfileRoutesAvatarIsReadOnly checks that clients cannot point the
+// avatar anywhere else than at the uploaded image
+func TestProfileRoutesAvatarIsReadOnly(t *testing.T) {
+	ctx := context.Background()
+	store := repository.NewMemoryStore()
+	tokens := utils.NewTokenManager(utils.NewHMACKey("test-secret"), nil, time.Minute)
+	sessions := services.NewSessionService(store.Users, store.RefreshTokens, store.Revocations, tokens, time.Hour)
+	blobs, err := blob.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	avatars := services.NewAvatarService(store.Profiles, blobs, "http://localhost")
+
+	user := &models.User{Name: "Ann", Email: "ann@example.com", Roles: []string{models.RoleUser}}
+	if err := store.Users.Insert(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	pair, err := sessions.Start(ctx, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(middleware.Errors())
+	unlimited := func(c *gin.Context) { c.Next() }
+	profiles := controllers.NewProfileController(store.Profiles, avatars, config.AvatarConfig{MaxUploadSize: 1 << 20})
+	RegiterProfileRoutes(router.Group("/api/v1"), profiles, middleware.AuthMiddleware(tokens, sessions), RateLimits{ProfileRead: unlimited})
+
+	send := func(method, body string, want int) {
+		t.Helper()
+		req := httptest.NewRequest(method, "/api/v1/profiles/", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+pair.AccessToken)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != want {
+			t.Fatalf("%s /profiles = %d, want %d: %s", method, w.Code, want, w.Body)
+		}
+	}
+
+	send(http.MethodPost, `{"bio": "Hi", "avatar": "https://example.com/other.png"}`, http.StatusCreated)
+	profile, err := store.Profiles.FindByUserID(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile.Avatar != "" {
+		t.Errorf("avatar after create = %q, want none", profile.Avatar)
+	}
+
+	var img bytes.Buffer
+	if err := png.Encode(&img, image.NewGray(image.Rect(0, 0, 64, 64))); err != nil {
+		t.Fatal(err)
+	}
+	uploaded, err := avatars.Upload(ctx, user.ID, img.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	send(http.MethodPut, `{"bio": "Hello", "avatar": "https://example.com/other.png"}`, http.StatusOK)
+	profile, err = store.Profiles.FindByUserID(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile.Bio != "Hello" {
+		t.Errorf("bio = %q, want it updated", profile.Bio)
+	}
+	if profile.Avatar != uploaded.Avatar || profile.AvatarVersion != uploaded.AvatarVersion {
+		t.Errorf("avatar = %q version %q, want the upload %q version %q", profile.Avatar, profile.AvatarVersion, uploaded.Avatar, uploaded.AvatarVersion)
+	}
+}
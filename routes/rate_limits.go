@@ -0,0 +1,14 @@
+package routes
+
+import "github.com/gin-gonic/gin"
+
+// RateLimits are the throttling middlewares of the route groups, built from
+// the policies in config.RateLimitConfig
+type RateLimits struct {
+	// Auth guards login, the second factor and the mailed token endpoints
+	Auth gin.HandlerFunc
+	// Register guards account registration
+	Register gin.HandlerFunc
+	// ProfileRead guards reading profiles
+	ProfileRead gin.HandlerFunc
+}
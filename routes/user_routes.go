@@ -4,22 +4,29 @@ import (
 	"github.com/gin-gonic/gin"
 	"go-restful-api/controllers"
 	"go-restful-api/middleware"
+	"go-restful-api/models"
 )
 
 // RegisterUserRoutes registers routes for user-related operations
-func RegisterUserRoutes(api *gin.RouterGroup) {
+func RegisterUserRoutes(api *gin.RouterGroup, users *controllers.UserController, auth gin.HandlerFunc, limits RateLimits) {
 	userRoutes := api.Group("/users")
 	{
 		// Public route: Create user (registration)
-		userRoutes.POST("/", controllers.CreateUser)
-		userRoutes.POST("/login", controllers.LoginUser)
+		userRoutes.POST("/", limits.Register, users.CreateUser)
+		userRoutes.POST("/login", limits.Auth, users.LoginUser)
 
 		// Protected routes: Require authentication
-		userRoutes.Use(middleware.AuthMiddleware()) // Apply AuthMiddleware to all routes below
+		userRoutes.Use(auth) // Apply AuthMiddleware to all routes below
 
-		userRoutes.GET("/", controllers.GetUsers)
-		userRoutes.GET("/:id", controllers.GetUserByID)
-		userRoutes.PUT("/:id", controllers.UpdateUser)
-		userRoutes.DELETE("/:id", controllers.DeleteUser)
+		// Only administrators can list accounts, everyone else is limited to their own
+		selfOrAdmin := middleware.RequireSelfOrPermission("id", models.PermissionManageUsers)
+
+		userRoutes.GET("/", middleware.RequirePermission(models.PermissionListUsers), users.GetUsers)
+		userRoutes.GET("/:id", selfOrAdmin, users.GetUserByID)
+		userRoutes.PUT("/:id", selfOrAdmin, users.UpdateUser)
+		userRoutes.PATCH("/:id", selfOrAdmin, users.PatchUser)
+		userRoutes.DELETE("/:id", selfOrAdmin, users.DeleteUser)
+		userRoutes.PUT("/me/password", users.ChangePassword)
+		userRoutes.POST("/:id/unlock", middleware.RequirePermission(models.PermissionManageUsers), users.UnlockUser)
 	}
 }
@@ -0,0 +1,124 @@
+package routes
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go-restful-api/blob"
+	"go-restful-api/config"
+	"go-restful-api/controllers"
+	"go-restful-api/mail"
+	"go-restful-api/middleware"
+	"go-restful-api/models"
+	"go-restful-api/repository"
+	"go-restful-api/services"
+	"go-restful-api/utils"
+)
+
+// testAccounts are the users of newTestUserRouter and their access tokens
+type testAccounts struct {
+	ann, bob, admin *models.User
+	tokens          map[*models.User]string
+}
+
+// newTestUserRouter serves the user routes on memory repositories, with two
+// plain users and an administrator signed in
+func newTestUserRouter(t *testing.T) (*gin.Engine, *testAccounts) {
+	t.Helper()
+	ctx := context.Background()
+	store := repository.NewMemoryStore()
+	tokens := utils.NewTokenManager(utils.NewHMACKey("test-secret"), nil, time.Minute)
+	sessions := services.NewSessionService(store.Users, store.RefreshTokens, store.Revocations, tokens, time.Hour)
+	mailer := mail.NewLogMailer("noreply@example.com")
+	accountService := services.NewAccountService(store.Users, store.AccountTokens, sessions, mailer, config.AuthConfig{}, "http://localhost")
+	guard := services.NewLoginGuard(store.LoginAttempts, config.LockoutConfig{})
+	mfa := services.NewMFAService(store.Users, store.Revocations, tokens, sessions, guard, config.AuthConfig{})
+	blobs, err := blob.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	avatars := services.NewAvatarService(store.Profiles, blobs, "http://localhost")
+
+	accounts := &testAccounts{
+		ann:    &models.User{Name: "Ann", Email: "ann@example.com", Roles: []string{models.RoleUser}},
+		bob:    &models.User{Name: "Bob", Email: "bob@example.com", Roles: []string{models.RoleUser}},
+		admin:  &models.User{Name: "Admin", Email: "admin@example.com", Roles: []string{models.RoleAdmin}},
+		tokens: make(map[*models.User]string),
+	}
+	for _, user := range []*models.User{accounts.ann, accounts.bob, accounts.admin} {
+		if err := store.Users.Insert(ctx, user); err != nil {
+			t.Fatal(err)
+		}
+		pair, err := sessions.Start(ctx, user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		accounts.tokens[user] = pair.AccessToken
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(middleware.Errors())
+	users := controllers.NewUserController(store.Users, store.Profiles, avatars, sessions, accountService, mfa, guard)
+	unlimited := func(c *gin.Context) { c.Next() }
+	limits := RateLimits{Auth: unlimited, Register: unlimited, ProfileRead: unlimited}
+	RegisterUserRoutes(router.Group("/api/v1"), users, middleware.AuthMiddleware(tokens, sessions), limits)
+	return router, accounts
+}
+
+// TestUserRoutesPermissions checks which accounts each protected user route admits
+func TestUserRoutesPermissions(t *testing.T) {
+	type request struct {
+		method string
+		// path is built from the accounts, as their IDs are assigned on insert
+		path func(a *testAccounts) string
+		// as picks the signed in account, nil sends no token
+		as   func(a *testAccounts) *models.User
+		want int
+	}
+	ann := func(a *testAccounts) *models.User { return a.ann }
+	admin := func(a *testAccounts) *models.User { return a.admin }
+	users := func(a *testAccounts) string { return "/api/v1/users/" }
+	annPath := func(a *testAccounts) string { return "/api/v1/users/" + a.ann.ID.Hex() }
+	bobPath := func(a *testAccounts) string { return "/api/v1/users/" + a.bob.ID.Hex() }
+	annUnlock := func(a *testAccounts) string { return annPath(a) + "/unlock" }
+	bobUnlock := func(a *testAccounts) string { return bobPath(a) + "/unlock" }
+
+	tests := []struct {
+		name string
+		request
+	}{
+		{"list as user", request{http.MethodGet, users, ann, http.StatusForbidden}},
+		{"list as admin", request{http.MethodGet, users, admin, http.StatusOK}},
+		{"list without token", request{http.MethodGet, users, nil, http.StatusUnauthorized}},
+		{"read own account", request{http.MethodGet, annPath, ann, http.StatusOK}},
+		{"read another account", request{http.MethodGet, bobPath, ann, http.StatusForbidden}},
+		{"read another account as admin", request{http.MethodGet, bobPath, admin, http.StatusOK}},
+		{"update another account", request{http.MethodPut, bobPath, ann, http.StatusForbidden}},
+		{"unlock another account", request{http.MethodPost, bobUnlock, ann, http.StatusForbidden}},
+		{"unlock own account", request{http.MethodPost, annUnlock, ann, http.StatusForbidden}},
+		{"unlock another account as admin", request{http.MethodPost, bobUnlock, admin, http.StatusOK}},
+		{"delete another account", request{http.MethodDelete, bobPath, ann, http.StatusForbidden}},
+		{"delete another account as admin", request{http.MethodDelete, bobPath, admin, http.StatusOK}},
+		{"delete own account", request{http.MethodDelete, annPath, ann, http.StatusOK}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, accounts := newTestUserRouter(t)
+			req := httptest.NewRequest(tt.method, tt.path(accounts), nil)
+			if tt.as != nil {
+				req.Header.Set("Authorization", "Bearer "+accounts.tokens[tt.as(accounts)])
+			}
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Errorf("%s %s = %d, want %d: %s", tt.method, req.URL.Path, w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,14 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"go-restful-api/controllers"
+)
+
+// RegisterWellKnownRoutes registers public discovery documents at the server root
+func RegisterWellKnownRoutes(router *gin.Engine, jwks *controllers.JWKSController) {
+	wellKnown := router.Group("/.well-known")
+	{
+		wellKnown.GET("/jwks.json", jwks.GetJWKS)
+	}
+}
@@ -0,0 +1,308 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"go-restful-api/config"
+	"go-restful-api/mail"
+	"go-restful-api/models"
+	"go-restful-api/repository"
+	"go-restful-api/utils"
+	"go-restful-api/validation"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	// ErrInvalidAccountToken is returned for unknown, expired or already used account tokens
+	ErrInvalidAccountToken = errors.New("invalid or expired token")
+	// ErrEmailNotVerified is returned when login requires a verified email address
+	ErrEmailNotVerified = errors.New("email address is not verified")
+)
+
+// accountTokenBytes is the entropy of a mailed account token
+const accountTokenBytes = 32
+
+// mailTimeout bounds the lookup and mailing done after responding
+const mailTimeout = time.Minute
+
+// AccountService runs the account workflows that are confirmed by email
+type AccountService struct {
+	users         repository.UserRepository
+	accountTokens repository.AccountTokenRepository
+	sessions      *SessionService
+	mailer        mail.Mailer
+	cfg           config.AuthConfig
+	publicURL     string
+	// pending counts the emails still being sent in the background
+	pending sync.WaitGroup
+}
+
+// NewAccountService creates an AccountService. publicURL is the external
+// base URL of the API, used in the instructions of mailed tokens.
+func NewAccountService(users repository.UserRepository, accountTokens repository.AccountTokenRepository, sessions *SessionService, mailer mail.Mailer, cfg config.AuthConfig, publicURL string) *AccountService {
+	return &AccountService{
+		users:         users,
+		accountTokens: accountTokens,
+		sessions:      sessions,
+		mailer:        mailer,
+		cfg:           cfg,
+		publicURL:     publicURL,
+	}
+}
+
+// CheckLogin returns ErrEmailNotVerified when the user may not log in yet
+func (s *AccountService) CheckLogin(user *models.User) error {
+	if s.cfg.RequireVerifiedEmail && !user.EmailVerified {
+		return ErrEmailNotVerified
+	}
+	return nil
+}
+
+// SendVerification mails a new verification token to the user, invalidating
+// any token sent before
+func (s *AccountService) SendVerification(ctx context.Context, user *models.User) error {
+	token, err := s.issue(ctx, user.ID, models.TokenPurposeVerifyEmail, s.cfg.VerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hi %s,\n\n"+
+			"please confirm your email address by sending the token below to\n"+
+			"POST %s/api/v1/auth/verify-email\n\n"+
+			"%s\n\n"+
+			"The token expires in %s. If you did not create an account, ignore this email.\n",
+			user.Name, s.publicURL, token, formatTTL(s.cfg.VerificationTTL)),
+	})
+}
+
+// ResendVerification mails a new verification token to the account with the
+// email address. Unknown and already verified addresses are ignored, and the
+// work happens after returning, so neither the result nor the response time
+// reveals which accounts exist.
+func (s *AccountService) ResendVerification(ctx context.Context, email string) {
+	s.background(ctx, func(ctx context.Context) error {
+		user, err := s.users.FindByEmail(ctx, email)
+		if errors.Is(err, repository.ErrNotFound) || (err == nil && user.EmailVerified) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return s.SendVerification(ctx, user)
+	}, "verification email", email)
+}
+
+// VerifyEmail consumes a verification token and marks the email of its user as verified
+func (s *AccountService) VerifyEmail(ctx context.Context, token string) error {
+	stored, err := s.consume(ctx, models.TokenPurposeVerifyEmail, token)
+	if err != nil {
+		return err
+	}
+
+	user, err := s.users.FindByID(ctx, stored.UserID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrInvalidAccountToken
+	}
+	if err != nil {
+		return err
+	}
+
+	user.EmailVerified = true
+	return s.users.Update(ctx, user)
+}
+
+// ForgotPassword mails a password reset token to the account with the email
+// address. Unknown addresses are ignored, and the work happens after
+// returning, so neither the result nor the response time reveals which
+// accounts exist.
+func (s *AccountService) ForgotPassword(ctx context.Context, email string) {
+	s.background(ctx, func(ctx context.Context) error {
+		user, err := s.users.FindByEmail(ctx, email)
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return s.sendPasswordReset(ctx, user)
+	}, "password reset email", email)
+}
+
+// Wait blocks until the emails sent in the background are done, or until
+// ctx ends
+func (s *AccountService) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		s.pending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// background runs job after the request is answered, keeping the values of
+// ctx but not its cancellation. A failure would reveal that the account
+// exists, so it is only logged.
+func (s *AccountService) background(ctx context.Context, job func(context.Context) error, what, email string) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), mailTimeout)
+	s.pending.Add(1)
+	go func() {
+		defer s.pending.Done()
+		defer cancel()
+		if err := job(ctx); err != nil {
+			log.Printf("Failed to send %s to %s: %v", what, email, err)
+		}
+	}()
+}
+
+func (s *AccountService) sendPasswordReset(ctx context.Context, user *models.User) error {
+	token, err := s.issue(ctx, user.ID, models.TokenPurposeResetPassword, s.cfg.PasswordResetTTL)
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\n"+
+			"someone asked to reset the password of your account. To choose a new\n"+
+			"password, send the token below together with it to\n"+
+			"POST %s/api/v1/auth/reset-password\n\n"+
+			"%s\n\n"+
+			"The token expires in %s. If you did not ask for a reset, ignore this email\n"+
+			"and your password stays unchanged.\n",
+			user.Name, s.publicURL, token, formatTTL(s.cfg.PasswordResetTTL)),
+	})
+}
+
+// ResetPassword consumes a password reset token, sets the new password and
+// signs the user out of every session. Receiving the token proves ownership
+// of the address, so the email counts as verified afterwards.
+func (s *AccountService) ResetPassword(ctx context.Context, token, password string) error {
+	stored, err := s.lookup(ctx, models.TokenPurposeResetPassword, token)
+	if err != nil {
+		return err
+	}
+
+	user, err := s.users.FindByID(ctx, stored.UserID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrInvalidAccountToken
+	}
+	if err != nil {
+		return err
+	}
+
+	// Checked before the token is used up, so the user can pick another password
+	if err := validation.CheckPassword(password, user.Email); err != nil {
+		return err
+	}
+	if err := s.markUsed(ctx, stored); err != nil {
+		return err
+	}
+
+	if user.Password, err = utils.HashPassword(password); err != nil {
+		return err
+	}
+	user.EmailVerified = true
+	if err := s.users.Update(ctx, user); err != nil {
+		return err
+	}
+
+	return s.sessions.LogoutAll(ctx, user.ID)
+}
+
+// issue stores a new token for the purpose, replacing earlier tokens of the
+// user for the same purpose, and returns its plain value
+func (s *AccountService) issue(ctx context.Context, userID primitive.ObjectID, purpose string, ttl time.Duration) (string, error) {
+	if err := s.accountTokens.DeleteByUser(ctx, userID, purpose); err != nil {
+		return "", err
+	}
+
+	token, err := utils.GenerateRandomToken(accountTokenBytes)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now().UTC()
+	err = s.accountTokens.Insert(ctx, &models.AccountToken{
+		ID:        primitive.NewObjectID(),
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: utils.HashToken(token),
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// consume looks up an unexpired token for the purpose and marks it used
+func (s *AccountService) consume(ctx context.Context, purpose, token string) (*models.AccountToken, error) {
+	stored, err := s.lookup(ctx, purpose, token)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.markUsed(ctx, stored); err != nil {
+		return nil, err
+	}
+	return stored, nil
+}
+
+// lookup returns the unused, unexpired token without using it up
+func (s *AccountService) lookup(ctx context.Context, purpose, token string) (*models.AccountToken, error) {
+	stored, err := s.accountTokens.FindByHash(ctx, purpose, utils.HashToken(token))
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrInvalidAccountToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if stored.UsedAt != nil || time.Now().After(stored.ExpiresAt) {
+		return nil, ErrInvalidAccountToken
+	}
+	return stored, nil
+}
+
+// markUsed uses up a token found by lookup
+func (s *AccountService) markUsed(ctx context.Context, stored *models.AccountToken) error {
+	// Only one concurrent request can consume the token
+	err := s.accountTokens.MarkUsed(ctx, stored.ID, time.Now().UTC())
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrInvalidAccountToken
+	}
+	return err
+}
+
+// formatTTL renders a token lifetime for humans, e.g. "24 hours"
+func formatTTL(d time.Duration) string {
+	switch {
+	case d >= time.Hour && d%time.Hour == 0:
+		return pluralize(int(d/time.Hour), "hour")
+	case d >= time.Minute && d%time.Minute == 0:
+		return pluralize(int(d/time.Minute), "minute")
+	default:
+		return d.String()
+	}
+}
+
+func pluralize(n int, unit string) string {
+	if n == 1 {
+		return "1 " + unit
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
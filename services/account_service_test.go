@@ -0,0 +1,190 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go-restful-api/config"
+	"go-restful-api/mail"
+	"go-restful-api/models"
+	"go-restful-api/repository"
+	"go-restful-api/utils"
+)
+
+// captureMailer keeps the messages it is asked to send
+type captureMailer struct {
+	mu       sync.Mutex
+	messages []mail.Message
+}
+
+func (m *captureMailer) Send(ctx context.Context, msg mail.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// sent returns the messages sent so far
+func (m *captureMailer) sent() []mail.Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]mail.Message(nil), m.messages...)
+}
+
+// mailedToken returns the token of a message, which is written on a
+// paragraph of its own after the endpoint to send it to
+func mailedToken(t *testing.T, msg mail.Message) string {
+	t.Helper()
+	paragraphs := strings.Split(msg.Body, "\n\n")
+	if len(paragraphs) < 3 {
+		t.Fatalf("no token in %q", msg.Body)
+	}
+	return paragraphs[2]
+}
+
+func newTestAccountService(t *testing.T) (*AccountService, *repository.Store, *captureMailer) {
+	t.Helper()
+	store := repository.NewMemoryStore()
+	mailer := &captureMailer{}
+	tokens := utils.NewTokenManager(utils.NewHMACKey("test-secret"), nil, time.Minute)
+	sessions := NewSessionService(store.Users, store.RefreshTokens, store.Revocations, tokens, time.Hour)
+	cfg := config.AuthConfig{RequireVerifiedEmail: true, VerificationTTL: time.Hour, PasswordResetTTL: time.Hour}
+	return NewAccountService(store.Users, store.AccountTokens, sessions, mailer, cfg, "http://localhost"), store, mailer
+}
+
+func TestAccountServiceVerifyEmail(t *testing.T) {
+	ctx := context.Background()
+	accounts, store, mailer := newTestAccountService(t)
+	user := &models.User{Name: "Ann", Email: "ann@example.com"}
+	if err := store.Users.Insert(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	if err := accounts.CheckLogin(user); !errors.Is(err, ErrEmailNotVerified) {
+		t.Fatalf("CheckLogin before verifying = %v, want %v", err, ErrEmailNotVerified)
+	}
+
+	if err := accounts.SendVerification(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	first := mailedToken(t, mailer.sent()[0])
+	// A new token replaces the one sent before
+	if err := accounts.SendVerification(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	sent := mailer.sent()
+	if len(sent) != 2 || sent[1].To != user.Email {
+		t.Fatalf("sent %+v, want two messages to %s", sent, user.Email)
+	}
+	second := mailedToken(t, sent[1])
+
+	if err := accounts.VerifyEmail(ctx, first); !errors.Is(err, ErrInvalidAccountToken) {
+		t.Errorf("VerifyEmail with a replaced token = %v, want %v", err, ErrInvalidAccountToken)
+	}
+	if err := accounts.VerifyEmail(ctx, second); err != nil {
+		t.Fatalf("VerifyEmail = %v", err)
+	}
+	if err := accounts.VerifyEmail(ctx, second); !errors.Is(err, ErrInvalidAccountToken) {
+		t.Errorf("VerifyEmail with a used token = %v, want %v", err, ErrInvalidAccountToken)
+	}
+
+	stored, err := store.Users.FindByID(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stored.EmailVerified {
+		t.Error("email not verified")
+	}
+	if err := accounts.CheckLogin(stored); err != nil {
+		t.Errorf("CheckLogin after verifying = %v", err)
+	}
+}
+
+func TestAccountServiceResendVerification(t *testing.T) {
+	ctx := context.Background()
+	accounts, store, mailer := newTestAccountService(t)
+	unverified := &models.User{Name: "Ann", Email: "ann@example.com"}
+	verified := &models.User{Name: "Bob", Email: "bob@example.com", EmailVerified: true}
+	for _, user := range []*models.User{unverified, verified} {
+		if err := store.Users.Insert(ctx, user); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		email string
+		sent  bool
+	}{
+		{"unverified", unverified.Email, true},
+		{"verified", verified.Email, false},
+		{"unknown", "nobody@example.com", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := len(mailer.sent())
+			accounts.ResendVerification(ctx, tt.email)
+			if err := accounts.Wait(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if sent := len(mailer.sent()) > before; sent != tt.sent {
+				t.Errorf("sent = %v, want %v", sent, tt.sent)
+			}
+		})
+	}
+}
+
+func TestAccountServiceResetPassword(t *testing.T) {
+	ctx := context.Background()
+	accounts, store, mailer := newTestAccountService(t)
+	hash, err := utils.HashPassword("old-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := &models.User{Name: "Ann", Email: "ann@example.com", Password: hash}
+	if err := store.Users.Insert(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	pair, err := accounts.sessions.Start(ctx, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	accounts.ForgotPassword(ctx, "nobody@example.com")
+	accounts.ForgotPassword(ctx, user.Email)
+	if err := accounts.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	sent := mailer.sent()
+	if len(sent) != 1 || sent[0].To != user.Email {
+		t.Fatalf("sent %+v, want one message to %s", sent, user.Email)
+	}
+	token := mailedToken(t, sent[0])
+
+	if err := accounts.VerifyEmail(ctx, token); !errors.Is(err, ErrInvalidAccountToken) {
+		t.Errorf("VerifyEmail with a reset token = %v, want %v", err, ErrInvalidAccountToken)
+	}
+	if err := accounts.ResetPassword(ctx, token, "new-password"); err != nil {
+		t.Fatalf("ResetPassword = %v", err)
+	}
+	if err := accounts.ResetPassword(ctx, token, "other-password"); !errors.Is(err, ErrInvalidAccountToken) {
+		t.Errorf("ResetPassword with a used token = %v, want %v", err, ErrInvalidAccountToken)
+	}
+
+	stored, err := store.Users.FindByID(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.CheckPassword("new-password", stored.Password); err != nil {
+		t.Error("new password not set")
+	}
+	if !stored.EmailVerified {
+		t.Error("email not verified")
+	}
+	if _, err := accounts.sessions.Refresh(ctx, pair.RefreshToken); err == nil {
+		t.Error("session still valid after the reset")
+	}
+}
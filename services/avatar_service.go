@@ -0,0 +1,166 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"runtime"
+	"time"
+
+	"go-restful-api/blob"
+	"go-restful-api/models"
+	"go-restful-api/repository"
+	"go-restful-api/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AvatarSizes are the edge lengths in pixels of the square thumbnails kept
+// for every avatar, largest first
+var AvatarSizes = []int{512, 256, 128, 64}
+
+// DefaultAvatarSize is served when no size is requested
+const DefaultAvatarSize = 256
+
+// maxAvatarPixels refuses images that would take too much memory to
+// decode, 64MB as RGBA
+const maxAvatarPixels = 16_000_000
+
+// ErrNoAvatar is returned for profiles without an uploaded avatar
+var ErrNoAvatar = errors.New("no avatar uploaded")
+
+// AvatarService resizes uploaded avatars and keeps them in a blob store
+type AvatarService struct {
+	profiles  repository.ProfileRepository
+	blobs     blob.Store
+	publicURL string
+	// decoding holds a slot for every image being decoded and resized, so
+	// parallel uploads cannot add up to more memory than a few images
+	decoding chan struct{}
+}
+
+// NewAvatarService creates an AvatarService that processes one image per CPU at a time
+func NewAvatarService(profiles repository.ProfileRepository, blobs blob.Store, publicURL string) *AvatarService {
+	return &AvatarService{
+		profiles:  profiles,
+		blobs:     blobs,
+		publicURL: publicURL,
+		decoding:  make(chan struct{}, runtime.NumCPU()),
+	}
+}
+
+// Upload replaces the avatar of the user's profile with thumbnails of the
+// image and points the profile's avatar URL at them. It returns
+// repository.ErrNotFound without a profile and the utils image errors for
+// unusable images.
+func (s *AvatarService) Upload(ctx context.Context, userID primitive.ObjectID, data []byte) (*models.Profile, error) {
+	profile, err := s.profiles.FindByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// The same image always gets the same version, and so the same URL
+	sum := sha256.Sum256(data)
+	version := hex.EncodeToString(sum[:8])
+
+	images, err := s.resize(ctx, data)
+	if err != nil {
+		return nil, err
+	}
+	for i, image := range images {
+		if err := s.blobs.Put(ctx, avatarKey(userID, version, AvatarSizes[i]), image.contentType, image.data); err != nil {
+			return nil, fmt.Errorf("failed to store avatar: %w", err)
+		}
+	}
+
+	previous := profile.AvatarVersion
+	profile.AvatarVersion = version
+	profile.Avatar = fmt.Sprintf("%s/api/v1/profiles/%s/avatar?v=%s", s.publicURL, userID.Hex(), version)
+	profile.UpdatedAt = time.Now()
+	if err := s.profiles.Update(ctx, profile); err != nil {
+		return nil, err
+	}
+
+	if previous != "" && previous != version {
+		s.deleteImages(ctx, userID, previous)
+	}
+	return profile, nil
+}
+
+// Version returns the version of the user's avatar, ErrNoAvatar when none
+// was uploaded
+func (s *AvatarService) Version(ctx context.Context, userID primitive.ObjectID) (string, error) {
+	profile, err := s.profiles.FindByUserID(ctx, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return "", ErrNoAvatar
+	}
+	if err != nil {
+		return "", err
+	}
+	if profile.AvatarVersion == "" {
+		return "", ErrNoAvatar
+	}
+	return profile.AvatarVersion, nil
+}
+
+// Open returns the thumbnail of the avatar version in one of AvatarSizes
+func (s *AvatarService) Open(ctx context.Context, userID primitive.ObjectID, version string, size int) (*blob.Object, error) {
+	obj, err := s.blobs.Get(ctx, avatarKey(userID, version, size))
+	if errors.Is(err, blob.ErrNotFound) {
+		return nil, ErrNoAvatar
+	}
+	return obj, err
+}
+
+// Delete removes the stored images of the profile's avatar. Failures are
+// logged, they only leave unreachable files behind.
+func (s *AvatarService) Delete(ctx context.Context, profile *models.Profile) {
+	if profile.AvatarVersion != "" {
+		s.deleteImages(ctx, profile.UserID, profile.AvatarVersion)
+	}
+}
+
+func (s *AvatarService) deleteImages(ctx context.Context, userID primitive.ObjectID, version string) {
+	for _, size := range AvatarSizes {
+		if err := s.blobs.Delete(ctx, avatarKey(userID, version, size)); err != nil {
+			log.Printf("Failed to delete avatar of user %s: %v", userID.Hex(), err)
+		}
+	}
+}
+
+type encodedImage struct {
+	data        []byte
+	contentType string
+}
+
+// resize decodes the upload and encodes a thumbnail for each of AvatarSizes.
+// It waits for a free decoding slot, the full-size image is dropped before
+// the slot is released.
+func (s *AvatarService) resize(ctx context.Context, data []byte) ([]encodedImage, error) {
+	select {
+	case s.decoding <- struct{}{}:
+		defer func() { <-s.decoding }()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	img, orientation, err := utils.DecodeImage(data, maxAvatarPixels)
+	if err != nil {
+		return nil, err
+	}
+
+	thumbs := utils.SquareThumbnails(img, orientation, AvatarSizes)
+	images := make([]encodedImage, len(thumbs))
+	for i, thumb := range thumbs {
+		if images[i].data, images[i].contentType, err = utils.EncodeImage(thumb); err != nil {
+			return nil, err
+		}
+	}
+	return images, nil
+}
+
+func avatarKey(userID primitive.ObjectID, version string, size int) string {
+	return fmt.Sprintf("avatars/%s/%s/%d", userID.Hex(), version, size)
+}
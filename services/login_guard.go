@@ -0,0 +1,135 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go-restful-api/config"
+	"go-restful-api/models"
+	"go-restful-api/repository"
+)
+
+// LockedError is returned while an account or client address is locked out
+// after too many failed logins
+type LockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("too many failed login attempts, retry in %s", e.RetryAfter.Round(time.Second))
+}
+
+// LoginGuard protects the login against brute force. Failures are counted
+// per account and per client IP; a key that reaches its threshold is locked
+// with a lockout that doubles with every further failure.
+type LoginGuard struct {
+	attempts repository.LoginAttemptRepository
+	cfg      config.LockoutConfig
+}
+
+// NewLoginGuard creates a LoginGuard. With cfg.Enabled unset every method is a no-op.
+func NewLoginGuard(attempts repository.LoginAttemptRepository, cfg config.LockoutConfig) *LoginGuard {
+	return &LoginGuard{attempts: attempts, cfg: cfg}
+}
+
+// Check returns a *LockedError when the account or the client address is
+// locked. It is called before the password is checked, so a locked key
+// does not collect further failures.
+func (g *LoginGuard) Check(ctx context.Context, email, ip string) error {
+	if !g.cfg.Enabled {
+		return nil
+	}
+
+	now := time.Now()
+	var retryAfter time.Duration
+	for _, key := range []string{accountKey(email), ipKey(ip)} {
+		entry, err := g.attempts.Get(ctx, key)
+		if errors.Is(err, repository.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if entry.LockedUntil != nil && entry.LockedUntil.After(now) {
+			retryAfter = max(retryAfter, entry.LockedUntil.Sub(now))
+		}
+	}
+
+	if retryAfter > 0 {
+		return &LockedError{RetryAfter: retryAfter}
+	}
+	return nil
+}
+
+// Fail records a failed login or second factor. It returns a *LockedError
+// when this failure locked the account or the client address.
+func (g *LoginGuard) Fail(ctx context.Context, email, ip string) error {
+	if !g.cfg.Enabled {
+		return nil
+	}
+
+	now := time.Now()
+	var retryAfter time.Duration
+	for _, key := range []struct {
+		name      string
+		threshold int
+	}{
+		{accountKey(email), g.cfg.AccountThreshold},
+		{ipKey(ip), g.cfg.IPThreshold},
+	} {
+		entry, err := g.attempts.RecordFailure(ctx, key.name, now, g.cfg.Window)
+		if err != nil {
+			return err
+		}
+		if entry.Failures < key.threshold {
+			continue
+		}
+
+		lockout := g.lockout(entry, key.threshold)
+		if err := g.attempts.Lock(ctx, key.name, now.Add(lockout), g.cfg.Window); err != nil {
+			return err
+		}
+		retryAfter = max(retryAfter, lockout)
+	}
+
+	if retryAfter > 0 {
+		return &LockedError{RetryAfter: retryAfter}
+	}
+	return nil
+}
+
+// Succeed clears the failures of the account after a successful login. The
+// counter of the client address is kept, otherwise an attacker could reset
+// it by logging into an account of their own between guesses.
+func (g *LoginGuard) Succeed(ctx context.Context, email string) error {
+	if !g.cfg.Enabled {
+		return nil
+	}
+	return g.attempts.Reset(ctx, accountKey(email))
+}
+
+// Unlock lifts the lockout of an account and clears its failures
+func (g *LoginGuard) Unlock(ctx context.Context, email string) error {
+	return g.attempts.Reset(ctx, accountKey(email))
+}
+
+// lockout is BaseDuration for the failure reaching the threshold and doubles
+// for every failure after it, capped at MaxDuration
+func (g *LoginGuard) lockout(entry *models.LoginAttempt, threshold int) time.Duration {
+	lockout := g.cfg.BaseDuration
+	for i := threshold; i < entry.Failures && lockout < g.cfg.MaxDuration; i++ {
+		lockout *= 2
+	}
+	return min(lockout, g.cfg.MaxDuration)
+}
+
+func accountKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
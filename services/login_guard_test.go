@@ -0,0 +1,184 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go-restful-api/config"
+	"go-restful-api/models"
+	"go-restful-api/repository"
+)
+
+var testLockout = config.LockoutConfig{
+	Enabled:          true,
+	AccountThreshold: 3,
+	IPThreshold:      5,
+	Window:           15 * time.Minute,
+	BaseDuration:     time.Minute,
+	MaxDuration:      10 * time.Minute,
+}
+
+func TestLoginGuardLockoutDuration(t *testing.T) {
+	g := NewLoginGuard(repository.NewMemoryLoginAttemptRepository(), testLockout)
+
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{3, time.Minute},
+		{4, 2 * time.Minute},
+		{5, 4 * time.Minute},
+		{6, 8 * time.Minute},
+		{7, 10 * time.Minute},
+		{50, 10 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := g.lockout(&models.LoginAttempt{Failures: tt.failures}, testLockout.AccountThreshold); got != tt.want {
+			t.Errorf("lockout(%d failures) = %s, want %s", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestLoginGuard(t *testing.T) {
+	ctx := context.Background()
+
+	// steps run in order; each fails or succeeds a login and states whether
+	// it is locked afterwards, for the given account and address
+	type step struct {
+		email, ip string
+		succeed   bool
+		wantLock  bool
+	}
+	fail := func(email, ip string, wantLock bool) step { return step{email: email, ip: ip, wantLock: wantLock} }
+	tests := []struct {
+		name  string
+		cfg   config.LockoutConfig
+		steps []step
+	}{
+		{
+			name: "account threshold",
+			cfg:  testLockout,
+			steps: []step{
+				fail("ann@example.com", "10.0.0.1", false),
+				fail("ann@example.com", "10.0.0.2", false),
+				fail("ann@example.com", "10.0.0.3", true),
+			},
+		},
+		{
+			name: "email case does not split the counter",
+			cfg:  testLockout,
+			steps: []step{
+				fail("ann@example.com", "10.0.0.1", false),
+				fail("Ann@Example.com", "10.0.0.1", false),
+				fail(" ANN@example.com", "10.0.0.1", true),
+			},
+		},
+		{
+			name: "success clears the account",
+			cfg:  testLockout,
+			steps: []step{
+				fail("ann@example.com", "10.0.0.1", false),
+				fail("ann@example.com", "10.0.0.1", false),
+				{email: "ann@example.com", ip: "10.0.0.1", succeed: true},
+				fail("ann@example.com", "10.0.0.1", false),
+			},
+		},
+		{
+			name: "address threshold across accounts",
+			cfg:  testLockout,
+			steps: []step{
+				fail("a@example.com", "10.0.0.1", false),
+				fail("b@example.com", "10.0.0.1", false),
+				fail("c@example.com", "10.0.0.1", false),
+				fail("d@example.com", "10.0.0.1", false),
+				fail("e@example.com", "10.0.0.1", true),
+			},
+		},
+		{
+			name: "success keeps the address counter",
+			cfg:  testLockout,
+			steps: []step{
+				fail("a@example.com", "10.0.0.1", false),
+				fail("b@example.com", "10.0.0.1", false),
+				fail("c@example.com", "10.0.0.1", false),
+				fail("d@example.com", "10.0.0.1", false),
+				{email: "mine@example.com", ip: "10.0.0.1", succeed: true},
+				fail("e@example.com", "10.0.0.1", true),
+			},
+		},
+		{
+			name: "disabled",
+			cfg:  config.LockoutConfig{AccountThreshold: 1, IPThreshold: 1, BaseDuration: time.Minute, MaxDuration: time.Minute},
+			steps: []step{
+				fail("ann@example.com", "10.0.0.1", false),
+				fail("ann@example.com", "10.0.0.1", false),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewLoginGuard(repository.NewMemoryLoginAttemptRepository(), tt.cfg)
+			for i, s := range tt.steps {
+				var err error
+				if s.succeed {
+					err = g.Succeed(ctx, s.email)
+				} else {
+					err = g.Fail(ctx, s.email, s.ip)
+				}
+				var locked *LockedError
+				if err != nil && !errors.As(err, &locked) {
+					t.Fatalf("step %d: error = %v", i, err)
+				}
+				if got := locked != nil; got != s.wantLock {
+					t.Fatalf("step %d: locked = %v, want %v", i, got, s.wantLock)
+				}
+
+				// Check agrees with the failure that locked
+				err = g.Check(ctx, s.email, s.ip)
+				if got := errors.As(err, &locked); got != s.wantLock {
+					t.Fatalf("step %d: Check() error = %v, want locked %v", i, err, s.wantLock)
+				}
+			}
+		})
+	}
+}
+
+func TestLoginGuardLockedAddressOnly(t *testing.T) {
+	ctx := context.Background()
+	g := NewLoginGuard(repository.NewMemoryLoginAttemptRepository(), testLockout)
+	for _, email := range []string{"a@example.com", "b@example.com", "c@example.com", "d@example.com", "e@example.com"} {
+		g.Fail(ctx, email, "10.0.0.1")
+	}
+
+	tests := []struct {
+		name      string
+		email, ip string
+		want      bool
+	}{
+		{"other account from the locked address", "new@example.com", "10.0.0.1", true},
+		{"other account from another address", "new@example.com", "10.0.0.2", false},
+		{"failed account from another address", "a@example.com", "10.0.0.2", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var locked *LockedError
+			err := g.Check(ctx, tt.email, tt.ip)
+			if got := errors.As(err, &locked); got != tt.want {
+				t.Errorf("Check() error = %v, want locked %v", err, tt.want)
+			}
+			if locked != nil && (locked.RetryAfter <= 0 || locked.RetryAfter > testLockout.BaseDuration) {
+				t.Errorf("RetryAfter = %s, want up to %s", locked.RetryAfter, testLockout.BaseDuration)
+			}
+		})
+	}
+
+	// Unlocking an account leaves the address locked
+	if err := g.Unlock(ctx, "a@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Check(ctx, "a@example.com", "10.0.0.1"); err == nil {
+		t.Error("Check() after Unlock() passed for the locked address")
+	}
+}
@@ -0,0 +1,363 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"image/png"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+	"go-restful-api/config"
+	"go-restful-api/models"
+	"go-restful-api/repository"
+	"go-restful-api/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	// ErrMFAAlreadyEnabled is returned when enrolling an account that already uses MFA
+	ErrMFAAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	// ErrMFANotEnrolled is returned when confirming or disabling MFA without an enrollment
+	ErrMFANotEnrolled = errors.New("two-factor authentication is not set up")
+	// ErrInvalidMFACode is returned for wrong, replayed or used codes
+	ErrInvalidMFACode = errors.New("invalid two-factor code")
+	// ErrInvalidMFAChallenge is returned for unknown, expired or used login challenges
+	ErrInvalidMFAChallenge = errors.New("invalid or expired MFA token")
+	// ErrIncorrectPassword is returned when enrolling or confirming MFA with a wrong password
+	ErrIncorrectPassword = errors.New("incorrect password")
+)
+
+const (
+	// totpPeriod and totpDigits are the RFC 6238 defaults understood by every authenticator app
+	totpPeriod = 30
+	totpDigits = otp.DigitsSix
+	// totpSkew is the number of time steps accepted before and after the current one
+	totpSkew = 1
+
+	recoveryCodeCount = 10
+	// recoveryCodeBytes gives codes of 10 hex digits, shown as xxxxx-xxxxx
+	recoveryCodeBytes = 5
+	qrCodeSize        = 256
+)
+
+// MFAService manages TOTP enrollment and the second step of a login
+type MFAService struct {
+	users       repository.UserRepository
+	revocations repository.RevocationRepository
+	tokens      *utils.TokenManager
+	sessions    *SessionService
+	guard       *LoginGuard
+	cfg         config.AuthConfig
+}
+
+// NewMFAService creates an MFAService. Wrong codes count as failed logins of the guard.
+func NewMFAService(users repository.UserRepository, revocations repository.RevocationRepository, tokens *utils.TokenManager, sessions *SessionService, guard *LoginGuard, cfg config.AuthConfig) *MFAService {
+	return &MFAService{
+		users:       users,
+		revocations: revocations,
+		tokens:      tokens,
+		sessions:    sessions,
+		guard:       guard,
+		cfg:         cfg,
+	}
+}
+
+// Enroll generates a new TOTP secret for the user. The secret is stored but
+// not enforced until Confirm is called with a code from the authenticator;
+// enrolling again before that replaces it. It requires the password so a
+// stolen access token alone cannot bind the account to another authenticator.
+func (s *MFAService) Enroll(ctx context.Context, userID primitive.ObjectID, password, ip string) (*models.MFAEnrollment, error) {
+	user, err := s.users.FindByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.MFAEnabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	if err := s.checkPassword(ctx, user, password, ip); err != nil {
+		return nil, err
+	}
+
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      s.cfg.MFAIssuer,
+		AccountName: user.Email,
+		Period:      totpPeriod,
+		Digits:      totpDigits,
+		Algorithm:   otp.AlgorithmSHA1,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	img, err := key.Image(qrCodeSize, qrCodeSize)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+
+	user.TOTPSecret = key.Secret()
+	user.RecoveryCodes = nil
+	if err := s.users.SetMFA(ctx, user); err != nil {
+		return nil, err
+	}
+
+	return &models.MFAEnrollment{
+		Secret: key.Secret(),
+		URI:    key.URL(),
+		QRCode: "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()),
+	}, nil
+}
+
+// Confirm enables MFA once the user proves the authenticator works and
+// returns the recovery codes. They are only stored as hashes, so this is the
+// only time they can be shown. Like Enroll, it requires the password.
+func (s *MFAService) Confirm(ctx context.Context, userID primitive.ObjectID, password, code, ip string) ([]string, error) {
+	user, err := s.users.FindByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.MFAEnabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	if user.TOTPSecret == "" {
+		return nil, ErrMFANotEnrolled
+	}
+	if err := s.checkPassword(ctx, user, password, ip); err != nil {
+		return nil, err
+	}
+	step, ok := s.checkTOTP(user, code)
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+	if err := s.useCode(ctx, user, usedCode{step: step}); err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, recoveryCodeBytes)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		raw := hex.EncodeToString(b)
+		codes[i] = raw[:len(raw)/2] + "-" + raw[len(raw)/2:]
+		hashes[i] = utils.HashToken(raw)
+	}
+
+	user.MFAEnabled = true
+	user.RecoveryCodes = hashes
+	if err := s.users.SetMFA(ctx, user); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Disable turns MFA off. It requires the password and a current code so a
+// stolen access token alone cannot remove the second factor.
+func (s *MFAService) Disable(ctx context.Context, userID primitive.ObjectID, password, code, ip string) error {
+	user, err := s.users.FindByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !user.MFAEnabled {
+		return ErrMFANotEnrolled
+	}
+	if err := s.guard.Check(ctx, user.Email, ip); err != nil {
+		return err
+	}
+	used, ok := s.checkCode(user, code)
+	if utils.CheckPassword(password, user.Password) != nil || !ok {
+		return s.fail(ctx, user, ip)
+	}
+	if err := s.useCode(ctx, user, used); err != nil {
+		return err
+	}
+
+	user.MFAEnabled = false
+	user.TOTPSecret = ""
+	user.RecoveryCodes = nil
+	return s.users.SetMFA(ctx, user)
+}
+
+// Challenge issues the token a user with MFA exchanges at Verify after the
+// password check
+func (s *MFAService) Challenge(user *models.User) (*models.MFAChallenge, error) {
+	token, err := s.tokens.GenerateMFAChallenge(user.ID.Hex(), s.cfg.MFAChallengeTTL)
+	if err != nil {
+		return nil, err
+	}
+	return &models.MFAChallenge{
+		Message:     "MFA required",
+		MFARequired: true,
+		MFAToken:    token,
+		ExpiresIn:   int64(s.cfg.MFAChallengeTTL.Seconds()),
+	}, nil
+}
+
+// Verify exchanges a login challenge and a TOTP or recovery code for a new
+// session. Each challenge and code can be used once, also by concurrent
+// requests: the challenge is claimed and the code used up with conditional
+// writes before the session starts. ip is the client address for the
+// brute-force protection.
+func (s *MFAService) Verify(ctx context.Context, challenge, code, ip string) (*models.TokenPair, error) {
+	claims, err := s.tokens.ValidateMFAChallenge(challenge)
+	if err != nil {
+		return nil, ErrInvalidMFAChallenge
+	}
+	revoked, err := s.sessions.IsRevoked(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, ErrInvalidMFAChallenge
+	}
+
+	userID, err := primitive.ObjectIDFromHex(claims.UserID)
+	if err != nil {
+		return nil, ErrInvalidMFAChallenge
+	}
+	user, err := s.users.FindByID(ctx, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrInvalidMFAChallenge
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !user.MFAEnabled {
+		return nil, ErrInvalidMFAChallenge
+	}
+
+	if err := s.guard.Check(ctx, user.Email, ip); err != nil {
+		return nil, err
+	}
+	used, ok := s.checkCode(user, code)
+	if !ok {
+		return nil, s.fail(ctx, user, ip)
+	}
+	err = s.revocations.ClaimToken(ctx, claims.ID, claims.ExpiresAt.Time)
+	if errors.Is(err, repository.ErrDuplicate) {
+		return nil, ErrInvalidMFAChallenge
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := s.useCode(ctx, user, used); err != nil {
+		return nil, err
+	}
+
+	if err := s.guard.Succeed(ctx, user.Email); err != nil {
+		return nil, err
+	}
+
+	return s.sessions.Start(ctx, user)
+}
+
+// checkPassword verifies the password of a signed-in user, counting a wrong
+// one as a failed login. It returns the *LockedError when the account or
+// address is locked, ErrIncorrectPassword for a wrong password.
+func (s *MFAService) checkPassword(ctx context.Context, user *models.User, password, ip string) error {
+	if err := s.guard.Check(ctx, user.Email, ip); err != nil {
+		return err
+	}
+	if utils.CheckPassword(password, user.Password) == nil {
+		return nil
+	}
+	if err := s.guard.Fail(ctx, user.Email, ip); err != nil {
+		return err
+	}
+	return ErrIncorrectPassword
+}
+
+// fail counts a wrong code as a failed login. It returns the *LockedError
+// when the failure locked the account, ErrInvalidMFACode otherwise.
+func (s *MFAService) fail(ctx context.Context, user *models.User, ip string) error {
+	if err := s.guard.Fail(ctx, user.Email, ip); err != nil {
+		return err
+	}
+	return ErrInvalidMFACode
+}
+
+// usedCode is an accepted code: the TOTP step it belongs to, or the hash of
+// the recovery code
+type usedCode struct {
+	step         int64
+	recoveryHash string
+}
+
+// checkCode accepts a TOTP code or an unused recovery code. It only reads
+// the user; useCode records the use.
+func (s *MFAService) checkCode(user *models.User, code string) (usedCode, bool) {
+	if step, ok := s.checkTOTP(user, code); ok {
+		return usedCode{step: step}, true
+	}
+
+	hash := utils.HashToken(normalizeRecoveryCode(code))
+	if !slices.Contains(user.RecoveryCodes, hash) {
+		return usedCode{}, false
+	}
+	return usedCode{recoveryHash: hash}, true
+}
+
+// useCode saves the TOTP step or removes the recovery code with a
+// conditional write. It returns ErrInvalidMFACode when another request used
+// the code first.
+func (s *MFAService) useCode(ctx context.Context, user *models.User, used usedCode) error {
+	var err error
+	if used.recoveryHash != "" {
+		err = s.users.UseRecoveryCode(ctx, user.ID, used.recoveryHash)
+	} else {
+		err = s.users.SaveTOTPStep(ctx, user.ID, used.step)
+	}
+	if errors.Is(err, repository.ErrNotFound) || errors.Is(err, repository.ErrConflict) {
+		return ErrInvalidMFACode
+	}
+	return err
+}
+
+// checkTOTP validates the code against the time steps around now and
+// returns the matching step. Steps at or before the last accepted one are
+// rejected so an observed code cannot be replayed.
+func (s *MFAService) checkTOTP(user *models.User, code string) (int64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != totpDigits.Length() {
+		return 0, false
+	}
+
+	now := time.Now().Unix() / totpPeriod
+	for step := now - totpSkew; step <= now+totpSkew; step++ {
+		if step <= user.TOTPLastStep {
+			continue
+		}
+		expected, err := totp.GenerateCodeCustom(user.TOTPSecret, time.Unix(step*totpPeriod, 0), totp.ValidateOpts{
+			Period:    totpPeriod,
+			Digits:    totpDigits,
+			Algorithm: otp.AlgorithmSHA1,
+		})
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// normalizeRecoveryCode lets users type recovery codes without the dash or
+// in upper case
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
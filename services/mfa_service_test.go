@@ -0,0 +1,311 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+	"go-restful-api/config"
+	"go-restful-api/models"
+	"go-restful-api/repository"
+	"go-restful-api/utils"
+)
+
+const testPassword = "correct horse battery"
+
+// newTestMFA creates an MFAService on memory repositories and a user with a password
+func newTestMFA(t *testing.T, lockout config.LockoutConfig) (*MFAService, *models.User) {
+	t.Helper()
+	ctx := context.Background()
+	store := repository.NewMemoryStore()
+
+	hash, err := utils.HashPassword(testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := &models.User{Name: "Ann", Email: "ann@example.com", Password: hash}
+	if err := store.Users.Insert(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+
+	tokens := utils.NewTokenManager(utils.NewHMACKey("test-secret"), nil, time.Minute)
+	sessions := NewSessionService(store.Users, store.RefreshTokens, store.Revocations, tokens, time.Hour)
+	guard := NewLoginGuard(store.LoginAttempts, lockout)
+	mfa := NewMFAService(store.Users, store.Revocations, tokens, sessions, guard, config.AuthConfig{
+		MFAIssuer:       "test",
+		MFAChallengeTTL: time.Minute,
+	})
+	return mfa, user
+}
+
+// codeAt returns the TOTP code of the secret for the step offset from now
+func codeAt(t *testing.T, secret string, offset int64) string {
+	t.Helper()
+	at := time.Unix((time.Now().Unix()/totpPeriod+offset)*totpPeriod, 0)
+	code, err := totp.GenerateCodeCustom(secret, at, totp.ValidateOpts{Period: totpPeriod, Digits: totpDigits, Algorithm: otp.AlgorithmSHA1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+func TestMFAServiceEnrollAndConfirm(t *testing.T) {
+	ctx := context.Background()
+	mfa, user := newTestMFA(t, config.LockoutConfig{})
+
+	if _, err := mfa.Enroll(ctx, user.ID, "wrong", "127.0.0.1"); !errors.Is(err, ErrIncorrectPassword) {
+		t.Fatalf("Enroll() with a wrong password error = %v, want ErrIncorrectPassword", err)
+	}
+	if _, err := mfa.Confirm(ctx, user.ID, testPassword, "123456", "127.0.0.1"); !errors.Is(err, ErrMFANotEnrolled) {
+		t.Fatalf("Confirm() before Enroll() error = %v, want ErrMFANotEnrolled", err)
+	}
+
+	enrollment, err := mfa.Enroll(ctx, user.ID, testPassword, "127.0.0.1")
+	if err != nil {
+		t.Fatalf("Enroll() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		code     string
+		want     error
+	}{
+		{"wrong password", "wrong", codeAt(t, enrollment.Secret, 0), ErrIncorrectPassword},
+		{"wrong code", testPassword, "000000", ErrInvalidMFACode},
+		{"valid", testPassword, codeAt(t, enrollment.Secret, 0), nil},
+		{"already enabled", testPassword, codeAt(t, enrollment.Secret, 1), ErrMFAAlreadyEnabled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			codes, err := mfa.Confirm(ctx, user.ID, tt.password, tt.code, "127.0.0.1")
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Confirm() error = %v, want %v", err, tt.want)
+			}
+			if err != nil {
+				return
+			}
+
+			if len(codes) != recoveryCodeCount {
+				t.Errorf("Confirm() returned %d recovery codes, want %d", len(codes), recoveryCodeCount)
+			}
+			format := regexp.MustCompile(`^[0-9a-f]{5}-[0-9a-f]{5}$`)
+			for _, code := range codes {
+				if !format.MatchString(code) {
+					t.Errorf("recovery code %q is not formatted as xxxxx-xxxxx", code)
+				}
+			}
+		})
+	}
+
+	if _, err := mfa.Enroll(ctx, user.ID, testPassword, "127.0.0.1"); !errors.Is(err, ErrMFAAlreadyEnabled) {
+		t.Errorf("Enroll() after Confirm() error = %v, want ErrMFAAlreadyEnabled", err)
+	}
+}
+
+func TestMFAServiceCheckTOTP(t *testing.T) {
+	mfa, _ := newTestMFA(t, config.LockoutConfig{})
+	key, err := totp.Generate(totp.GenerateOpts{Issuer: "test", AccountName: "ann@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := key.Secret()
+
+	tests := []struct {
+		name string
+		// codes are presented in order to the same user, only the last result is checked
+		codes []string
+		want  bool
+	}{
+		{"current step", []string{codeAt(t, secret, 0)}, true},
+		{"previous step within the skew", []string{codeAt(t, secret, -1)}, true},
+		{"next step within the skew", []string{codeAt(t, secret, 1)}, true},
+		{"outside the skew", []string{codeAt(t, secret, -3)}, false},
+		{"replayed code", []string{codeAt(t, secret, 0), codeAt(t, secret, 0)}, false},
+		{"older step after a newer one", []string{codeAt(t, secret, 0), codeAt(t, secret, -1)}, false},
+		{"newer step after an older one", []string{codeAt(t, secret, -1), codeAt(t, secret, 0)}, true},
+		{"surrounding whitespace", []string{" " + codeAt(t, secret, 0) + " "}, true},
+		{"wrong length", []string{"12345"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := &models.User{TOTPSecret: secret}
+			var got bool
+			for _, code := range tt.codes {
+				var step int64
+				if step, got = mfa.checkTOTP(user, code); got {
+					user.TOTPLastStep = step
+				}
+			}
+			if got != tt.want {
+				t.Errorf("checkTOTP() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMFAServiceRecoveryCodes(t *testing.T) {
+	mfa, _ := newTestMFA(t, config.LockoutConfig{})
+	user := &models.User{RecoveryCodes: []string{utils.HashToken("abcde12345"), utils.HashToken("0123456789")}}
+
+	tests := []struct {
+		name string
+		code string
+		want bool
+	}{
+		{"as shown", "abcde-12345", true},
+		{"without dash in upper case", "ABCDE12345", true},
+		{"with spaces", "abcde 12345", true},
+		{"unknown code", "fffff-fffff", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			used, got := mfa.checkCode(user, tt.code)
+			if got != tt.want {
+				t.Errorf("checkCode() = %v, want %v", got, tt.want)
+			}
+			if got && used.recoveryHash != user.RecoveryCodes[0] {
+				t.Errorf("checkCode() matched %q, want the first code", used.recoveryHash)
+			}
+		})
+	}
+}
+
+func TestMFAServiceVerify(t *testing.T) {
+	ctx := context.Background()
+	mfa, user := newTestMFA(t, config.LockoutConfig{
+		Enabled:          true,
+		AccountThreshold: 2,
+		IPThreshold:      100,
+		Window:           time.Hour,
+		BaseDuration:     time.Minute,
+		MaxDuration:      time.Hour,
+	})
+
+	enrollment, err := mfa.Enroll(ctx, user.ID, testPassword, "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	recovery, err := mfa.Confirm(ctx, user.ID, testPassword, codeAt(t, enrollment.Secret, -1), "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	challenge, err := mfa.Challenge(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mfa.Verify(ctx, challenge.MFAToken, "000000", "127.0.0.1"); !errors.Is(err, ErrInvalidMFACode) {
+		t.Fatalf("Verify() with a wrong code error = %v, want ErrInvalidMFACode", err)
+	}
+	if _, err := mfa.Verify(ctx, challenge.MFAToken, recovery[0], "127.0.0.1"); err != nil {
+		t.Fatalf("Verify() with a recovery code error = %v", err)
+	}
+	// The successful verification cleared the failure, so one more does not lock
+	second, err := mfa.Challenge(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mfa.Verify(ctx, second.MFAToken, recovery[0], "127.0.0.1"); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("Verify() with a used recovery code error = %v, want ErrInvalidMFACode", err)
+	}
+
+	tests := []struct {
+		name      string
+		challenge string
+		want      error
+	}{
+		{"used challenge", challenge.MFAToken, ErrInvalidMFAChallenge},
+		{"malformed challenge", "not-a-token", ErrInvalidMFAChallenge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := mfa.Verify(ctx, tt.challenge, recovery[1], "127.0.0.1"); !errors.Is(err, tt.want) {
+				t.Errorf("Verify() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	// A second wrong code reaches the threshold
+	third, err := mfa.Challenge(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var locked *LockedError
+	if _, err := mfa.Verify(ctx, third.MFAToken, "000000", "127.0.0.1"); !errors.As(err, &locked) {
+		t.Errorf("Verify() error = %v, want a LockedError", err)
+	}
+}
+
+func TestMFAServiceVerifyConcurrent(t *testing.T) {
+	ctx := context.Background()
+	mfa, user := newTestMFA(t, config.LockoutConfig{})
+
+	enrollment, err := mfa.Enroll(ctx, user.ID, testPassword, "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	recovery, err := mfa.Confirm(ctx, user.ID, testPassword, codeAt(t, enrollment.Secret, -1), "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		code string
+		// sameChallenge sends every request with one challenge instead of one each
+		sameChallenge bool
+	}{
+		{"one challenge", codeAt(t, enrollment.Secret, 0), true},
+		{"one TOTP code", codeAt(t, enrollment.Secret, 1), false},
+		{"one recovery code", recovery[0], false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			const requests = 8
+			challenges := make([]string, requests)
+			for i := range challenges {
+				if i > 0 && tt.sameChallenge {
+					challenges[i] = challenges[0]
+					continue
+				}
+				challenge, err := mfa.Challenge(user)
+				if err != nil {
+					t.Fatal(err)
+				}
+				challenges[i] = challenge.MFAToken
+			}
+
+			var wg sync.WaitGroup
+			results := make(chan error, requests)
+			for _, challenge := range challenges {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					_, err := mfa.Verify(ctx, challenge, tt.code, "127.0.0.1")
+					results <- err
+				}()
+			}
+			wg.Wait()
+			close(results)
+
+			succeeded := 0
+			for err := range results {
+				switch {
+				case err == nil:
+					succeeded++
+				case !errors.Is(err, ErrInvalidMFACode) && !errors.Is(err, ErrInvalidMFAChallenge):
+					t.Errorf("Verify() error = %v", err)
+				}
+			}
+			if succeeded != 1 {
+				t.Errorf("%d of %d concurrent verifications succeeded, want 1", succeeded, requests)
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go-restful-api/models"
+	"go-restful-api/repository"
+	"go-restful-api/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	// ErrInvalidRefreshToken is returned for unknown, expired or revoked refresh tokens
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	// ErrRefreshTokenReused is returned when an already rotated refresh token is
+	// presented again. The whole token family is revoked when this happens.
+	ErrRefreshTokenReused = errors.New("refresh token reuse detected")
+)
+
+// refreshTokenBytes is the entropy of an opaque refresh token
+const refreshTokenBytes = 32
+
+// SessionService issues access/refresh token pairs, rotates refresh tokens
+// and revokes sessions on logout
+type SessionService struct {
+	users         repository.UserRepository
+	refreshTokens repository.RefreshTokenRepository
+	revocations   repository.RevocationRepository
+	tokens        *utils.TokenManager
+	refreshTTL    time.Duration
+}
+
+// NewSessionService creates a SessionService
+func NewSessionService(users repository.UserRepository, refreshTokens repository.RefreshTokenRepository, revocations repository.RevocationRepository, tokens *utils.TokenManager, refreshTTL time.Duration) *SessionService {
+	return &SessionService{
+		users:         users,
+		refreshTokens: refreshTokens,
+		revocations:   revocations,
+		tokens:        tokens,
+		refreshTTL:    refreshTTL,
+	}
+}
+
+// Start issues a new token pair for a freshly authenticated user, opening a new token family
+func (s *SessionService) Start(ctx context.Context, user *models.User) (*models.TokenPair, error) {
+	return s.issue(ctx, user, primitive.NewObjectID())
+}
+
+// Refresh exchanges a valid refresh token for a new token pair. The presented
+// token is marked as used; presenting it again revokes its whole family.
+func (s *SessionService) Refresh(ctx context.Context, refreshToken string) (*models.TokenPair, error) {
+	stored, err := s.refreshTokens.FindByHash(ctx, utils.HashToken(refreshToken))
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if stored.RevokedAt != nil || now.After(stored.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+	if stored.UsedAt != nil {
+		return nil, s.revokeReused(ctx, stored)
+	}
+
+	// Only one of two concurrent refreshes with the same token can win
+	err = s.refreshTokens.MarkUsed(ctx, stored.ID, now)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, s.revokeReused(ctx, stored)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.users.FindByID(ctx, stored.UserID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return s.issue(ctx, user, stored.FamilyID)
+}
+
+// Logout revokes the access token described by claims and, when given, the
+// refresh token family it was issued with
+func (s *SessionService) Logout(ctx context.Context, claims *models.Claims, refreshToken string) error {
+	if claims.ID != "" && claims.ExpiresAt != nil {
+		if err := s.revocations.RevokeToken(ctx, claims.ID, claims.ExpiresAt.Time); err != nil {
+			return err
+		}
+	}
+
+	if refreshToken == "" {
+		return nil
+	}
+
+	stored, err := s.refreshTokens.FindByHash(ctx, utils.HashToken(refreshToken))
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if stored.UserID.Hex() != claims.UserID {
+		return nil
+	}
+	return s.refreshTokens.RevokeFamily(ctx, stored.FamilyID, time.Now())
+}
+
+// LogoutAll ends every session of the user: all refresh tokens are revoked
+// and every access token issued up to now is rejected until it expires.
+// Token issue times have second precision, so a token issued within the
+// same second as the logout is rejected as well.
+func (s *SessionService) LogoutAll(ctx context.Context, userID primitive.ObjectID) error {
+	now := time.Now()
+	if err := s.refreshTokens.RevokeUser(ctx, userID, now); err != nil {
+		return err
+	}
+	return s.revocations.RevokeUserTokens(ctx, userID, now, now.Add(s.tokens.TTL()))
+}
+
+// IsRevoked reports whether the access token described by claims was revoked
+func (s *SessionService) IsRevoked(ctx context.Context, claims *models.Claims) (bool, error) {
+	userID, err := primitive.ObjectIDFromHex(claims.UserID)
+	if err != nil {
+		return true, nil
+	}
+
+	var issuedAt time.Time
+	if claims.IssuedAt != nil {
+		issuedAt = claims.IssuedAt.Time
+	}
+	return s.revocations.IsRevoked(ctx, claims.ID, userID, issuedAt)
+}
+
+func (s *SessionService) revokeReused(ctx context.Context, stored *models.RefreshToken) error {
+	if err := s.refreshTokens.RevokeFamily(ctx, stored.FamilyID, time.Now()); err != nil {
+		return err
+	}
+	return ErrRefreshTokenReused
+}
+
+func (s *SessionService) issue(ctx context.Context, user *models.User, familyID primitive.ObjectID) (*models.TokenPair, error) {
+	accessToken, err := s.tokens.GenerateToken(user.ID.Hex(), user.Email, user.Roles)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := utils.GenerateRandomToken(refreshTokenBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	err = s.refreshTokens.Insert(ctx, &models.RefreshToken{
+		UserID:    user.ID,
+		FamilyID:  familyID,
+		TokenHash: utils.HashToken(refreshToken),
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.refreshTTL),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(s.tokens.TTL().Seconds()),
+	}, nil
+}
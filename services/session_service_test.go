@@ -0,0 +1,179 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go-restful-api/models"
+	"go-restful-api/repository"
+	"go-restful-api/utils"
+)
+
+// newTestSessions creates a SessionService on memory repositories and a user to sign in
+func newTestSessions(t *testing.T, refreshTTL time.Duration) (*SessionService, *models.User) {
+	t.Helper()
+	users := repository.NewMemoryUserRepository()
+	user := &models.User{Name: "Ann", Email: "ann@example.com", Roles: []string{models.RoleUser}}
+	if err := users.Insert(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+	tokens := utils.NewTokenManager(utils.NewHMACKey("test-secret"), nil, time.Minute)
+	sessions := NewSessionService(users, repository.NewMemoryRefreshTokenRepository(), repository.NewMemoryRevocationRepository(), tokens, refreshTTL)
+	return sessions, user
+}
+
+func TestSessionServiceRefresh(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name       string
+		refreshTTL time.Duration
+		// run returns the refresh token to present after preparing the session
+		run  func(t *testing.T, s *SessionService, user *models.User, first *models.TokenPair) string
+		want error
+	}{
+		{
+			name: "fresh token",
+			run: func(t *testing.T, s *SessionService, user *models.User, first *models.TokenPair) string {
+				return first.RefreshToken
+			},
+		},
+		{
+			name: "rotated token",
+			run: func(t *testing.T, s *SessionService, user *models.User, first *models.TokenPair) string {
+				second, err := s.Refresh(ctx, first.RefreshToken)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return second.RefreshToken
+			},
+		},
+		{
+			name: "unknown token",
+			run: func(t *testing.T, s *SessionService, user *models.User, first *models.TokenPair) string {
+				return "not-a-token"
+			},
+			want: ErrInvalidRefreshToken,
+		},
+		{
+			name:       "expired token",
+			refreshTTL: -time.Second,
+			run: func(t *testing.T, s *SessionService, user *models.User, first *models.TokenPair) string {
+				return first.RefreshToken
+			},
+			want: ErrInvalidRefreshToken,
+		},
+		{
+			name: "used token",
+			run: func(t *testing.T, s *SessionService, user *models.User, first *models.TokenPair) string {
+				if _, err := s.Refresh(ctx, first.RefreshToken); err != nil {
+					t.Fatal(err)
+				}
+				return first.RefreshToken
+			},
+			want: ErrRefreshTokenReused,
+		},
+		{
+			name: "successor of a reused token",
+			run: func(t *testing.T, s *SessionService, user *models.User, first *models.TokenPair) string {
+				second, err := s.Refresh(ctx, first.RefreshToken)
+				if err != nil {
+					t.Fatal(err)
+				}
+				// The reuse revokes the whole family, including the token the thief holds
+				if _, err := s.Refresh(ctx, first.RefreshToken); !errors.Is(err, ErrRefreshTokenReused) {
+					t.Fatalf("reuse error = %v, want ErrRefreshTokenReused", err)
+				}
+				return second.RefreshToken
+			},
+			want: ErrInvalidRefreshToken,
+		},
+		{
+			name: "other family survives a reuse",
+			run: func(t *testing.T, s *SessionService, user *models.User, first *models.TokenPair) string {
+				other, err := s.Start(ctx, user)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := s.Refresh(ctx, first.RefreshToken); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := s.Refresh(ctx, first.RefreshToken); !errors.Is(err, ErrRefreshTokenReused) {
+					t.Fatalf("reuse error = %v, want ErrRefreshTokenReused", err)
+				}
+				return other.RefreshToken
+			},
+		},
+		{
+			name: "after logout",
+			run: func(t *testing.T, s *SessionService, user *models.User, first *models.TokenPair) string {
+				claims, err := s.tokens.ValidateToken(first.AccessToken)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := s.Logout(ctx, claims, first.RefreshToken); err != nil {
+					t.Fatal(err)
+				}
+				return first.RefreshToken
+			},
+			want: ErrInvalidRefreshToken,
+		},
+		{
+			name: "after logout everywhere",
+			run: func(t *testing.T, s *SessionService, user *models.User, first *models.TokenPair) string {
+				if err := s.LogoutAll(ctx, user.ID); err != nil {
+					t.Fatal(err)
+				}
+				return first.RefreshToken
+			},
+			want: ErrInvalidRefreshToken,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ttl := tt.refreshTTL
+			if ttl == 0 {
+				ttl = time.Hour
+			}
+			s, user := newTestSessions(t, ttl)
+			first, err := s.Start(ctx, user)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			pair, err := s.Refresh(ctx, tt.run(t, s, user, first))
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Refresh() error = %v, want %v", err, tt.want)
+			}
+			if err == nil && (pair.AccessToken == "" || pair.RefreshToken == first.RefreshToken) {
+				t.Errorf("Refresh() = %+v, want a new token pair", pair)
+			}
+		})
+	}
+}
+
+func TestSessionServiceLogoutAllRevokesAccessTokens(t *testing.T) {
+	ctx := context.Background()
+	s, user := newTestSessions(t, time.Hour)
+
+	pair, err := s.Start(ctx, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := s.tokens.ValidateToken(pair.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if revoked, err := s.IsRevoked(ctx, claims); err != nil || revoked {
+		t.Fatalf("IsRevoked() before logout = %v, %v", revoked, err)
+	}
+	if err := s.LogoutAll(ctx, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if revoked, err := s.IsRevoked(ctx, claims); err != nil || !revoked {
+		t.Errorf("IsRevoked() after logout = %v, %v, want true", revoked, err)
+	}
+}
@@ -0,0 +1,192 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+
+	xdraw "golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+var (
+	// ErrUnsupportedImage is returned for data that is not a JPEG, PNG, GIF or WebP image
+	ErrUnsupportedImage = errors.New("unsupported image format")
+	// ErrImageTooLarge is returned for images with more pixels than allowed
+	ErrImageTooLarge = errors.New("image dimensions too large")
+	// ErrInvalidImage is returned for images that cannot be decoded
+	ErrInvalidImage = errors.New("invalid image")
+)
+
+// imageTypes are the formats accepted by DecodeImage, by sniffed content type
+var imageTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// DecodeImage decodes a JPEG, PNG, GIF or WebP image. The format is sniffed
+// from the data rather than trusted from the client, and the dimensions are
+// checked against maxPixels before the pixels are decoded. It also returns
+// the EXIF orientation of JPEG images, 1 when there is none.
+func DecodeImage(data []byte, maxPixels int) (image.Image, int, error) {
+	if !imageTypes[http.DetectContentType(data)] {
+		return nil, 0, ErrUnsupportedImage
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, 0, ErrInvalidImage
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		return nil, 0, ErrInvalidImage
+	}
+	if cfg.Width*cfg.Height > maxPixels {
+		return nil, 0, ErrImageTooLarge
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, 0, ErrInvalidImage
+	}
+	return img, jpegOrientation(data), nil
+}
+
+// SquareThumbnails crops the centered square of img and scales it to each
+// of the sizes, in pixels. Sizes must be in descending order; each thumbnail
+// is scaled from the previous one. The EXIF orientation is applied, as the
+// thumbnails carry no metadata.
+func SquareThumbnails(img image.Image, orientation int, sizes []int) []*image.NRGBA {
+	bounds := img.Bounds()
+	side := min(bounds.Dx(), bounds.Dy())
+	// Orientation only rotates and flips, so the centered square stays centered
+	src := image.Rect(0, 0, side, side).Add(bounds.Min).Add(image.Pt((bounds.Dx()-side)/2, (bounds.Dy()-side)/2))
+
+	thumbs := make([]*image.NRGBA, 0, len(sizes))
+	var prev image.Image = img
+	for _, size := range sizes {
+		dst := image.NewNRGBA(image.Rect(0, 0, size, size))
+		xdraw.CatmullRom.Scale(dst, dst.Bounds(), prev, src, draw.Src, nil)
+		thumbs = append(thumbs, dst)
+		prev, src = dst, dst.Bounds()
+	}
+	for i, thumb := range thumbs {
+		thumbs[i] = orient(thumb, orientation)
+	}
+	return thumbs
+}
+
+// EncodeImage encodes opaque images as JPEG and others as PNG, keeping
+// transparency. The result carries no metadata.
+func EncodeImage(img *image.NRGBA) ([]byte, string, error) {
+	var buf bytes.Buffer
+	if img.Opaque() {
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85}); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), "image/jpeg", nil
+	}
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), "image/png", nil
+}
+
+// orient applies an EXIF orientation (2 to 8) to a square image
+func orient(img *image.NRGBA, orientation int) *image.NRGBA {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+	n := img.Bounds().Dx()
+	dst := image.NewNRGBA(img.Bounds())
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // mirrored
+				dx, dy = n-1-x, y
+			case 3: // upside down
+				dx, dy = n-1-x, n-1-y
+			case 4: // mirrored upside down
+				dx, dy = x, n-1-y
+			case 5: // transposed
+				dx, dy = y, x
+			case 6: // rotated 90° clockwise
+				dx, dy = n-1-y, x
+			case 7: // transversed
+				dx, dy = n-1-y, n-1-x
+			case 8: // rotated 90° counter-clockwise
+				dx, dy = y, n-1-x
+			}
+			dst.SetNRGBA(dx, dy, img.NRGBAAt(x, y))
+		}
+	}
+	return dst
+}
+
+// jpegOrientation reads the orientation tag from the EXIF segment of a
+// JPEG, returning 1 (upright) when there is none
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return 1
+		}
+		marker := data[i+1]
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		// Metadata comes before the start of scan
+		if marker == 0xDA || length < 2 || i+2+length > len(data) {
+			return 1
+		}
+		segment := data[i+4 : i+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return exifOrientation(segment[6:])
+		}
+		i += 2 + length
+	}
+	return 1
+}
+
+// exifOrientation finds tag 0x0112 in IFD0 of a TIFF structure
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	offset := int(order.Uint32(tiff[4:]))
+	if offset < 8 || offset+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[offset:]))
+	for i := 0; i < entries; i++ {
+		entry := offset + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			if o := int(order.Uint16(tiff[entry+8:])); o >= 1 && o <= 8 {
+				return o
+			}
+			return 1
+		}
+	}
+	return 1
+}
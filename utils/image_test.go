@@ -0,0 +1,216 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// testTIFF builds a TIFF header with one IFD0 entry for the orientation tag
+func testTIFF(order binary.ByteOrder, orientation uint16) []byte {
+	b := make([]byte, 26)
+	if order == binary.LittleEndian {
+		copy(b, "II")
+	} else {
+		copy(b, "MM")
+	}
+	order.PutUint16(b[2:], 42)
+	order.PutUint32(b[4:], 8)
+	order.PutUint16(b[8:], 1)
+	order.PutUint16(b[10:], 0x0112)
+	order.PutUint16(b[12:], 3) // SHORT
+	order.PutUint32(b[14:], 1)
+	order.PutUint16(b[18:], orientation)
+	return b
+}
+
+// withAPP1 inserts an APP1 segment holding payload right after the SOI
+// marker of a JPEG
+func withAPP1(jpg, payload []byte) []byte {
+	segment := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	out := append([]byte{}, jpg[:2]...)
+	out = append(out, segment...)
+	out = append(out, payload...)
+	return append(out, jpg[2:]...)
+}
+
+func testJPEG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, w, h)), nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func testPNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, w, h))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestJPEGOrientation(t *testing.T) {
+	jpg := testJPEG(t, 4, 4)
+	exif := func(tiff []byte) []byte { return append([]byte("Exif\x00\x00"), tiff...) }
+
+	tests := []struct {
+		name string
+		data []byte
+		want int
+	}{
+		{"big endian", withAPP1(jpg, exif(testTIFF(binary.BigEndian, 6))), 6},
+		{"little endian", withAPP1(jpg, exif(testTIFF(binary.LittleEndian, 8))), 8},
+		{"no exif", jpg, 1},
+		{"other app1 segment", withAPP1(jpg, []byte("http://ns.adobe.com/xap/1.0/\x00")), 1},
+		{"orientation out of range", withAPP1(jpg, exif(testTIFF(binary.BigEndian, 9))), 1},
+		{"unknown byte order", withAPP1(jpg, exif(append([]byte("XX"), testTIFF(binary.BigEndian, 6)[2:]...))), 1},
+		{"truncated ifd", withAPP1(jpg, exif(testTIFF(binary.BigEndian, 6)[:14])), 1},
+		{"truncated segment", withAPP1(jpg, exif(testTIFF(binary.BigEndian, 6)))[:20], 1},
+		{"not a jpeg", testPNG(t, 4, 4), 1},
+		{"empty", nil, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := jpegOrientation(tt.data); got != tt.want {
+				t.Errorf("jpegOrientation() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOrient(t *testing.T) {
+	// The top row of a 2x2 image is red then green; each case says where
+	// those pixels end up once the orientation is applied
+	red := color.NRGBA{R: 255, A: 255}
+	green := color.NRGBA{G: 255, A: 255}
+	tests := []struct {
+		orientation int
+		red, green  image.Point
+	}{
+		{1, image.Pt(0, 0), image.Pt(1, 0)},
+		{2, image.Pt(1, 0), image.Pt(0, 0)},
+		{3, image.Pt(1, 1), image.Pt(0, 1)},
+		{4, image.Pt(0, 1), image.Pt(1, 1)},
+		{5, image.Pt(0, 0), image.Pt(0, 1)},
+		{6, image.Pt(1, 0), image.Pt(1, 1)},
+		{7, image.Pt(1, 1), image.Pt(1, 0)},
+		{8, image.Pt(0, 1), image.Pt(0, 0)},
+		{0, image.Pt(0, 0), image.Pt(1, 0)},
+	}
+	for _, tt := range tests {
+		img := image.NewNRGBA(image.Rect(0, 0, 2, 2))
+		img.SetNRGBA(0, 0, red)
+		img.SetNRGBA(1, 0, green)
+
+		got := orient(img, tt.orientation)
+		if got.NRGBAAt(tt.red.X, tt.red.Y) != red || got.NRGBAAt(tt.green.X, tt.green.Y) != green {
+			t.Errorf("orient(%d): red at %v and green at %v expected", tt.orientation, tt.red, tt.green)
+		}
+	}
+}
+
+func TestDecodeImage(t *testing.T) {
+	rotated := withAPP1(testJPEG(t, 8, 4), append([]byte("Exif\x00\x00"), testTIFF(binary.LittleEndian, 6)...))
+
+	tests := []struct {
+		name            string
+		data            []byte
+		maxPixels       int
+		wantOrientation int
+		wantErr         error
+	}{
+		{"png", testPNG(t, 8, 4), 32, 1, nil},
+		{"jpeg with orientation", rotated, 32, 6, nil},
+		{"too many pixels", testPNG(t, 8, 4), 31, 0, ErrImageTooLarge},
+		{"not an image", []byte("<svg xmlns=\"http://www.w3.org/2000/svg\"/>"), 32, 0, ErrUnsupportedImage},
+		{"corrupt png", testPNG(t, 8, 4)[:40], 32, 0, ErrInvalidImage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img, orientation, err := DecodeImage(tt.data, tt.maxPixels)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("DecodeImage() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := img.Bounds().Size(); got != image.Pt(8, 4) {
+				t.Errorf("size = %v, want (8,4)", got)
+			}
+			if orientation != tt.wantOrientation {
+				t.Errorf("orientation = %d, want %d", orientation, tt.wantOrientation)
+			}
+		})
+	}
+}
+
+func TestSquareThumbnails(t *testing.T) {
+	// A 40x20 image, green in the centered square and red on both sides
+	img := image.NewNRGBA(image.Rect(0, 0, 40, 20))
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 40; x++ {
+			c := color.NRGBA{R: 255, A: 255}
+			if x >= 10 && x < 30 {
+				c = color.NRGBA{G: 255, A: 255}
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+
+	for _, orientation := range []int{1, 6} {
+		thumbs := SquareThumbnails(img, orientation, []int{16, 4})
+		if len(thumbs) != 2 {
+			t.Fatalf("SquareThumbnails() returned %d thumbnails, want 2", len(thumbs))
+		}
+		for i, size := range []int{16, 4} {
+			thumb := thumbs[i]
+			if got := thumb.Bounds().Size(); got != image.Pt(size, size) {
+				t.Errorf("orientation %d: thumbnail %d is %v, want %dx%d", orientation, i, got, size, size)
+			}
+			for _, p := range []image.Point{{0, 0}, {size - 1, size - 1}} {
+				if c := thumb.NRGBAAt(p.X, p.Y); c.R > 16 || c.G < 240 {
+					t.Errorf("orientation %d: thumbnail %d at %v = %v, want the green center", orientation, i, p, c)
+				}
+			}
+		}
+	}
+}
+
+func TestEncodeImage(t *testing.T) {
+	opaque := image.NewNRGBA(image.Rect(0, 0, 2, 2))
+	for i := 3; i < len(opaque.Pix); i += 4 {
+		opaque.Pix[i] = 255
+	}
+
+	tests := []struct {
+		name string
+		img  *image.NRGBA
+		want string
+	}{
+		{"opaque", opaque, "image/jpeg"},
+		{"transparent", image.NewNRGBA(image.Rect(0, 0, 2, 2)), "image/png"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, contentType, err := EncodeImage(tt.img)
+			if err != nil {
+				t.Fatalf("EncodeImage() error = %v", err)
+			}
+			if contentType != tt.want {
+				t.Errorf("content type = %q, want %q", contentType, tt.want)
+			}
+			if _, _, err := DecodeImage(data, 4); err != nil {
+				t.Errorf("encoded image does not decode: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,245 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Supported JWT signing algorithms
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+	AlgEdDSA = "EdDSA"
+)
+
+// Key is a JWT signing or verification key identified by its kid
+type Key struct {
+	ID     string
+	Method jwt.SigningMethod
+	// signKey is the HMAC secret or private key, nil for verification-only keys
+	signKey interface{}
+	// verifyKey is the HMAC secret or public key
+	verifyKey interface{}
+}
+
+// JWK is the JSON Web Key representation of a public key (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// NewHMACKey creates a symmetric HS256 key. HMAC keys have no kid and are
+// never published in the JWKS.
+func NewHMACKey(secret string) *Key {
+	return &Key{
+		Method:    jwt.SigningMethodHS256,
+		signKey:   []byte(secret),
+		verifyKey: []byte(secret),
+	}
+}
+
+// LoadPrivateKey reads a PEM private key for the given algorithm. When kid is
+// empty the RFC 7638 thumbprint of the public key is used.
+func LoadPrivateKey(path, algorithm, kid string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key: %w", err)
+	}
+
+	var (
+		method  jwt.SigningMethod
+		private crypto.Signer
+	)
+	switch algorithm {
+	case AlgRS256:
+		method = jwt.SigningMethodRS256
+		private, err = jwt.ParseRSAPrivateKeyFromPEM(data)
+	case AlgES256:
+		method = jwt.SigningMethodES256
+		private, err = jwt.ParseECPrivateKeyFromPEM(data)
+	case AlgEdDSA:
+		method = jwt.SigningMethodEdDSA
+		var key crypto.PrivateKey
+		key, err = jwt.ParseEdPrivateKeyFromPEM(data)
+		if err == nil {
+			private = key.(ed25519.PrivateKey)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", algorithm)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s private key %s: %w", algorithm, path, err)
+	}
+
+	key := &Key{ID: kid, Method: method, signKey: private, verifyKey: private.Public()}
+	if err := key.checkCurve(); err != nil {
+		return nil, err
+	}
+	if key.ID == "" {
+		key.ID = key.Thumbprint()
+	}
+	return key, nil
+}
+
+// LoadPublicKey reads a PEM public key that is accepted for verification
+// only, typically the key that signed tokens before a rotation. The
+// algorithm is inferred from the key type. kid has to match the kid the key
+// signed with; when empty the thumbprint is used, as for LoadPrivateKey.
+func LoadPublicKey(path, kid string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read public key: %w", err)
+	}
+
+	key := &Key{}
+	if pub, err := jwt.ParseRSAPublicKeyFromPEM(data); err == nil {
+		key.Method, key.verifyKey = jwt.SigningMethodRS256, pub
+	} else if pub, err := jwt.ParseECPublicKeyFromPEM(data); err == nil {
+		key.Method, key.verifyKey = jwt.SigningMethodES256, pub
+	} else if pub, err := jwt.ParseEdPublicKeyFromPEM(data); err == nil {
+		key.Method, key.verifyKey = jwt.SigningMethodEdDSA, pub
+	} else {
+		return nil, fmt.Errorf("failed to parse public key %s: unsupported key type", path)
+	}
+
+	if err := key.checkCurve(); err != nil {
+		return nil, err
+	}
+	key.ID = kid
+	if key.ID == "" {
+		key.ID = key.Thumbprint()
+	}
+	return key, nil
+}
+
+// GenerateKeyPair creates a new signing key for the algorithm and returns the
+// PKCS#8 private key and PKIX public key, both PEM encoded
+func GenerateKeyPair(algorithm string) (privatePEM, publicPEM []byte, err error) {
+	var private crypto.Signer
+	switch algorithm {
+	case AlgRS256:
+		private, err = rsa.GenerateKey(rand.Reader, 3072)
+	case AlgES256:
+		private, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case AlgEdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, nil, fmt.Errorf("unsupported signing algorithm %q", algorithm)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, nil, err
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(private.Public())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	privatePEM = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER})
+	publicPEM = pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})
+	return privatePEM, publicPEM, nil
+}
+
+// checkCurve rejects EC keys that do not match ES256
+func (k *Key) checkCurve() error {
+	if pub, ok := k.verifyKey.(*ecdsa.PublicKey); ok && pub.Curve != elliptic.P256() {
+		return errors.New("ES256 requires a P-256 key")
+	}
+	return nil
+}
+
+// JWK returns the public JWK of an asymmetric key, or false for HMAC keys
+func (k *Key) JWK() (JWK, bool) {
+	jwk := JWK{Kid: k.ID, Use: "sig", Alg: k.Method.Alg()}
+
+	switch pub := k.verifyKey.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = encodeBase64URL(pub.N.Bytes())
+		jwk.E = encodeBase64URL(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		jwk.Kty = "EC"
+		jwk.Crv = "P-256"
+		jwk.X = encodeBase64URL(pub.X.FillBytes(make([]byte, 32)))
+		jwk.Y = encodeBase64URL(pub.Y.FillBytes(make([]byte, 32)))
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = encodeBase64URL(pub)
+	default:
+		return JWK{}, false
+	}
+	return jwk, true
+}
+
+// Thumbprint returns the RFC 7638 SHA-256 thumbprint of an asymmetric key
+func (k *Key) Thumbprint() string {
+	jwk, ok := k.JWK()
+	if !ok {
+		return ""
+	}
+
+	// Only the required members, in lexicographic order
+	var members interface{}
+	switch jwk.Kty {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N}
+	case "EC":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{jwk.Crv, jwk.Kty, jwk.X, jwk.Y}
+	case "OKP":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X}
+	}
+
+	data, _ := json.Marshal(members)
+	sum := sha256.Sum256(data)
+	return encodeBase64URL(sum[:])
+}
+
+func encodeBase64URL(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,301 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// writeKeyPair generates a key pair and returns the paths of its PEM files
+func writeKeyPair(t *testing.T, algorithm string) (privatePath, publicPath string) {
+	t.Helper()
+	var private crypto.Signer
+	var err error
+	switch algorithm {
+	case AlgRS256:
+		private, err = rsa.GenerateKey(rand.Reader, 2048)
+	case AlgES256:
+		private, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case AlgEdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(private.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	privatePEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER})
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})
+	dir := t.TempDir()
+	privatePath, publicPath = filepath.Join(dir, "jwt.key"), filepath.Join(dir, "jwt.pub")
+	if err := os.WriteFile(privatePath, privatePEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(publicPath, publicPEM, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return privatePath, publicPath
+}
+
+func TestLoadKeys(t *testing.T) {
+	tests := []struct {
+		algorithm string
+		kty       string
+		crv       string
+	}{
+		{AlgRS256, "RSA", ""},
+		{AlgES256, "EC", "P-256"},
+		{AlgEdDSA, "OKP", "Ed25519"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.algorithm, func(t *testing.T) {
+			privatePath, publicPath := writeKeyPair(t, tt.algorithm)
+
+			private, err := LoadPrivateKey(privatePath, tt.algorithm, "")
+			if err != nil {
+				t.Fatalf("LoadPrivateKey() error = %v", err)
+			}
+			public, err := LoadPublicKey(publicPath, "")
+			if err != nil {
+				t.Fatalf("LoadPublicKey() error = %v", err)
+			}
+
+			// Both halves default to the same thumbprint kid
+			if private.ID == "" || private.ID != public.ID {
+				t.Errorf("kids = %q and %q, want the same thumbprint", private.ID, public.ID)
+			}
+			if public.Method.Alg() != tt.algorithm {
+				t.Errorf("public key algorithm = %s, want %s", public.Method.Alg(), tt.algorithm)
+			}
+			jwk, ok := public.JWK()
+			if !ok || jwk.Kty != tt.kty || jwk.Crv != tt.crv || jwk.Alg != tt.algorithm || jwk.Use != "sig" {
+				t.Errorf("JWK() = %+v, %v", jwk, ok)
+			}
+
+			custom, err := LoadPublicKey(publicPath, "2025-01")
+			if err != nil || custom.ID != "2025-01" {
+				t.Errorf("LoadPublicKey() with kid = %v, %v, want kid 2025-01", custom, err)
+			}
+		})
+	}
+}
+
+func TestLoadKeyErrors(t *testing.T) {
+	rsaPrivate, _ := writeKeyPair(t, AlgRS256)
+
+	// ES256 is only defined for P-256
+	p384, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(p384.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	p384Path := filepath.Join(t.TempDir(), "p384.pub")
+	if err := os.WriteFile(p384Path, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		load func() (*Key, error)
+	}{
+		{"missing file", func() (*Key, error) { return LoadPrivateKey(filepath.Join(t.TempDir(), "none"), AlgRS256, "") }},
+		{"key of another algorithm", func() (*Key, error) { return LoadPrivateKey(rsaPrivate, AlgES256, "") }},
+		{"unsupported algorithm", func() (*Key, error) { return LoadPrivateKey(rsaPrivate, "PS256", "") }},
+		{"private key as public key", func() (*Key, error) { return LoadPublicKey(rsaPrivate, "") }},
+		{"P-384 key", func() (*Key, error) { return LoadPublicKey(p384Path, "") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.load(); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+// TestThumbprint checks the example of RFC 7638 section 3.1
+func TestThumbprint(t *testing.T) {
+	n, err := base64.RawURLEncoding.DecodeString("0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := &Key{Method: jwt.SigningMethodRS256, verifyKey: &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: 65537}}
+
+	if got, want := key.Thumbprint(), "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs"; got != want {
+		t.Errorf("Thumbprint() = %s, want %s", got, want)
+	}
+	if got := NewHMACKey("secret").Thumbprint(); got != "" {
+		t.Errorf("HMAC Thumbprint() = %q, want none", got)
+	}
+}
+
+func TestTokenManagerRotation(t *testing.T) {
+	oldPrivate, oldPublic := writeKeyPair(t, AlgES256)
+	newPrivate, _ := writeKeyPair(t, AlgEdDSA)
+	_, otherPublic := writeKeyPair(t, AlgES256)
+
+	signing, err := LoadPrivateKey(newPrivate, AlgEdDSA, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		// oldKID is the kid the old key signed with, verifyKID the one it is loaded with after the rotation
+		oldKID    string
+		verifyKID string
+		verify    string
+		wantValid bool
+	}{
+		{"thumbprint kid", "", "", oldPublic, true},
+		{"custom kid listed with the key", "2025", "2025", oldPublic, true},
+		{"custom kid listed without kid", "2025", "", oldPublic, false},
+		{"wrong key under the same kid", "2025", "2025", otherPublic, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old, err := LoadPrivateKey(oldPrivate, AlgES256, tt.oldKID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			token, err := NewTokenManager(old, nil, time.Minute).GenerateToken("user", "ann@example.com", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			verification, err := LoadPublicKey(tt.verify, tt.verifyKID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rotated := NewTokenManager(signing, []*Key{verification}, time.Minute)
+
+			_, err = rotated.ValidateToken(token)
+			if valid := err == nil; valid != tt.wantValid {
+				t.Errorf("ValidateToken() error = %v, want valid %v", err, tt.wantValid)
+			}
+		})
+	}
+}
+
+func TestTokenManagerRejectsAlgorithmConfusion(t *testing.T) {
+	privatePath, _ := writeKeyPair(t, AlgRS256)
+	signing, err := LoadPrivateKey(privatePath, AlgRS256, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewTokenManager(signing, nil, time.Minute)
+
+	// An HS256 token keyed with the public key must not pass for the RSA key
+	public, _ := signing.verifyKey.(*rsa.PublicKey)
+	der, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute))})
+	forged.Header["kid"] = signing.ID
+	token, err := forged.SignedString(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.ValidateToken(token); err == nil {
+		t.Error("ValidateToken() accepted an HS256 token for an RS256 key")
+	}
+}
+
+func TestTokenManagerAudience(t *testing.T) {
+	m := NewTokenManager(NewHMACKey("test-secret"), nil, time.Minute)
+	access, err := m.GenerateToken("user", "ann@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	challenge, err := m.GenerateMFAChallenge("user", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Tokens from before access tokens named their audience
+	legacy, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+	}).SignedString([]byte("test-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		token         string
+		wantAccess    bool
+		wantChallenge bool
+	}{
+		{"access token", access, true, false},
+		{"MFA challenge", challenge, false, true},
+		{"no audience", legacy, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := m.ValidateToken(tt.token); (err == nil) != tt.wantAccess {
+				t.Errorf("ValidateToken() error = %v, want valid %v", err, tt.wantAccess)
+			}
+			if _, err := m.ValidateMFAChallenge(tt.token); (err == nil) != tt.wantChallenge {
+				t.Errorf("ValidateMFAChallenge() error = %v, want valid %v", err, tt.wantChallenge)
+			}
+		})
+	}
+}
+
+func TestTokenManagerJWKS(t *testing.T) {
+	signingPath, _ := writeKeyPair(t, AlgEdDSA)
+	_, previousPath := writeKeyPair(t, AlgRS256)
+	signing, err := LoadPrivateKey(signingPath, AlgEdDSA, "current")
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous, err := LoadPublicKey(previousPath, "previous")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		manager *TokenManager
+		want    []string
+	}{
+		{"active key first", NewTokenManager(signing, []*Key{previous}, time.Minute), []string{"current", "previous"}},
+		{"HMAC keys are never published", NewTokenManager(NewHMACKey("secret"), nil, time.Minute), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys := tt.manager.JWKS().Keys
+			if len(keys) != len(tt.want) {
+				t.Fatalf("JWKS() has %d keys, want %v", len(keys), tt.want)
+			}
+			for i, kid := range tt.want {
+				if keys[i].Kid != kid {
+					t.Errorf("key %d kid = %q, want %q", i, keys[i].Kid, kid)
+				}
+			}
+		})
+	}
+}
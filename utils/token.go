@@ -2,35 +2,120 @@ package utils
 
 import (
 	"errors"
+	"fmt"
+	"sort"
 	"time"
 
 	"go-restful-api/models"
 	"github.com/golang-jwt/jwt/v4"
 )
 
-var jwtKey = []byte("your_secret_key") // Replace with a secure key
+// TokenManager issues and validates JWT access tokens. Tokens are signed
+// with one active key; during a key rotation the previous keys stay
+// available for verification until the tokens they signed have expired.
+type TokenManager struct {
+	signing      *Key
+	verification map[string]*Key
+	ttl          time.Duration
+}
+
+// NewTokenManager creates a TokenManager signing with the given key and
+// additionally accepting tokens signed by any of the verification keys
+func NewTokenManager(signing *Key, verification []*Key, ttl time.Duration) *TokenManager {
+	m := &TokenManager{
+		signing:      signing,
+		verification: map[string]*Key{signing.ID: signing},
+		ttl:          ttl,
+	}
+	for _, key := range verification {
+		m.verification[key.ID] = key
+	}
+	return m
+}
 
-// GenerateToken generates a new JWT token
-func GenerateToken(userID, email string) (string, error) {
-	expirationTime := time.Now().Add(24 * time.Hour)
-	claims := &models.Claims{
-		UserID: userID,
-		Email:  email,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
-		},
+// Every token names what it is for in its aud claim. Both kinds are signed
+// with the same keys, so anyone verifying access tokens against the JWKS has
+// to check the audience too.
+const (
+	accessTokenAudience = "access"
+	// mfaChallengeAudience marks MFA challenge tokens. They only prove that
+	// the password was checked and are never accepted as access tokens.
+	mfaChallengeAudience = "mfa-challenge"
+)
+
+// GenerateToken generates a new JWT token with a unique jti so it can be revoked
+func (m *TokenManager) GenerateToken(userID, email string, roles []string) (string, error) {
+	claims := &models.Claims{UserID: userID, Email: email, Roles: roles}
+	claims.Audience = jwt.ClaimStrings{accessTokenAudience}
+	return m.sign(claims, m.ttl)
+}
+
+// GenerateMFAChallenge issues a short-lived token for a user who passed the
+// password check and still has to present a second factor
+func (m *TokenManager) GenerateMFAChallenge(userID string, ttl time.Duration) (string, error) {
+	claims := &models.Claims{UserID: userID}
+	claims.Audience = jwt.ClaimStrings{mfaChallengeAudience}
+	return m.sign(claims, ttl)
+}
+
+func (m *TokenManager) sign(claims *models.Claims, ttl time.Duration) (string, error) {
+	jti, err := GenerateRandomToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	claims.ID = jti
+	claims.IssuedAt = jwt.NewNumericDate(now)
+	claims.ExpiresAt = jwt.NewNumericDate(now.Add(ttl))
+
+	token := jwt.NewWithClaims(m.signing.Method, claims)
+	if m.signing.ID != "" {
+		token.Header["kid"] = m.signing.ID
+	}
+	return token.SignedString(m.signing.signKey)
+}
+
+// ValidateToken validates the provided JWT access token
+func (m *TokenManager) ValidateToken(tokenString string) (*models.Claims, error) {
+	claims, err := m.parse(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if !claims.VerifyAudience(accessTokenAudience, true) {
+		return nil, errors.New("not an access token")
 	}
+	return claims, nil
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtKey)
+// ValidateMFAChallenge validates a token issued by GenerateMFAChallenge
+func (m *TokenManager) ValidateMFAChallenge(tokenString string) (*models.Claims, error) {
+	claims, err := m.parse(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if !claims.VerifyAudience(mfaChallengeAudience, true) {
+		return nil, errors.New("not an MFA challenge token")
+	}
+	return claims, nil
 }
 
-// ValidateToken validates the provided JWT token
-func ValidateToken(tokenString string) (*models.Claims, error) {
+func (m *TokenManager) parse(tokenString string) (*models.Claims, error) {
 	claims := &models.Claims{}
 
 	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		return jwtKey, nil
+		// Tokens without kid were signed by the HMAC key
+		kid, _ := token.Header["kid"].(string)
+		key, ok := m.verification[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+
+		// Never let the token choose the algorithm for a key
+		if token.Method.Alg() != key.Method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+		}
+		return key.verifyKey, nil
 	})
 	if err != nil {
 		return nil, err
@@ -42,3 +127,32 @@ func ValidateToken(tokenString string) (*models.Claims, error) {
 
 	return claims, nil
 }
+
+// TTL returns the lifetime of issued access tokens
+func (m *TokenManager) TTL() time.Duration {
+	return m.ttl
+}
+
+// JWKS returns the public keys that verify tokens issued by this manager
+func (m *TokenManager) JWKS() JWKS {
+	set := JWKS{Keys: []JWK{}}
+
+	// The active key is listed first
+	if jwk, ok := m.signing.JWK(); ok {
+		set.Keys = append(set.Keys, jwk)
+	}
+	ids := make([]string, 0, len(m.verification))
+	for id := range m.verification {
+		if id != m.signing.ID {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		if jwk, ok := m.verification[id].JWK(); ok {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	return set
+}
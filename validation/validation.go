@@ -0,0 +1,177 @@
+// Package validation adds the input rules the built-in validator tags do not
+// cover: the password policy and the names of people. The rules are
+// registered with the validator gin binds requests with, so they can be used
+// in binding tags.
+package validation
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"go-restful-api/config"
+	"go-restful-api/models"
+)
+
+// Rule names reported in validation errors
+const (
+	RulePasswordLength   = "password_length"
+	RuleBreachedPassword = "breached_password"
+	RuleNotEmail         = "not_email"
+	RulePersonName       = "person_name"
+)
+
+// Error lists the fields of an input that break a rule
+type Error struct {
+	Fields []models.FieldError
+}
+
+func (e *Error) Error() string {
+	parts := make([]string, 0, len(e.Fields))
+	for _, f := range e.Fields {
+		parts = append(parts, f.Field+" "+f.Message)
+	}
+	return strings.Join(parts, ", ")
+}
+
+type passwordPolicy struct {
+	minLength int
+	maxLength int
+	// breached holds the lowercased breached passwords
+	breached map[string]struct{}
+}
+
+// policy is replaced by Setup; the defaults apply until then
+var policy = passwordPolicy{minLength: 8, maxLength: config.MaxPasswordBytes}
+
+func init() {
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return
+	}
+	v.RegisterValidation(RulePasswordLength, func(fl validator.FieldLevel) bool {
+		return policy.lengthOK(fl.Field().String())
+	})
+	v.RegisterValidation(RuleBreachedPassword, func(fl validator.FieldLevel) bool {
+		return !policy.isBreached(fl.Field().String())
+	})
+	v.RegisterValidation(RulePersonName, func(fl validator.FieldLevel) bool {
+		return IsPersonName(fl.Field().String())
+	})
+	v.RegisterStructValidation(func(sl validator.StructLevel) {
+		user := sl.Current().Interface().(models.User)
+		if isEmail(user.Password, user.Email) {
+			sl.ReportError(user.Password, "password", "Password", RuleNotEmail, "")
+		}
+	}, models.User{})
+}
+
+// Setup applies the password policy of the configuration, loading the
+// breached password list. It must run before requests are served.
+func Setup(cfg config.PasswordConfig) error {
+	breached, err := loadBreached(cfg.BreachedList)
+	if err != nil {
+		return err
+	}
+	policy = passwordPolicy{minLength: cfg.MinLength, maxLength: cfg.MaxLength, breached: breached}
+	return nil
+}
+
+// CheckPassword returns an *Error naming every rule of the policy the new
+// password of the account with the email breaks, nil when there is none
+func CheckPassword(password, email string) error {
+	var fields []models.FieldError
+	if !policy.lengthOK(password) {
+		fields = append(fields, passwordError(RulePasswordLength))
+	}
+	if policy.isBreached(password) {
+		fields = append(fields, passwordError(RuleBreachedPassword))
+	}
+	if isEmail(password, email) {
+		fields = append(fields, passwordError(RuleNotEmail))
+	}
+	if len(fields) > 0 {
+		return &Error{Fields: fields}
+	}
+	return nil
+}
+
+// Message explains a rule of this package to the client, "" for other rules
+func Message(rule string) string {
+	switch rule {
+	case RulePasswordLength:
+		return fmt.Sprintf("must be %d to %d characters long", policy.minLength, policy.maxLength)
+	case RuleBreachedPassword:
+		return "appears in a list of breached passwords, choose another one"
+	case RuleNotEmail:
+		return "must not be the email address"
+	case RulePersonName:
+		return "may only contain letters, spaces, apostrophes, hyphens and periods"
+	}
+	return ""
+}
+
+// IsPersonName reports whether name is made of letters, spaces and the
+// punctuation found in names, with at least one letter
+func IsPersonName(name string) bool {
+	hasLetter := false
+	for _, r := range name {
+		switch {
+		case unicode.IsLetter(r):
+			hasLetter = true
+		case unicode.IsMark(r), r == ' ', r == '\'', r == '’', r == '-', r == '.':
+		default:
+			return false
+		}
+	}
+	return hasLetter
+}
+
+// lengthOK counts characters for the minimum and bytes for the maximum,
+// the unit bcrypt is limited by
+func (p passwordPolicy) lengthOK(password string) bool {
+	return utf8.RuneCountInString(password) >= p.minLength && len(password) <= p.maxLength
+}
+
+func (p passwordPolicy) isBreached(password string) bool {
+	_, ok := p.breached[strings.ToLower(password)]
+	return ok
+}
+
+func isEmail(password, email string) bool {
+	return email != "" && strings.EqualFold(strings.TrimSpace(password), strings.TrimSpace(email))
+}
+
+func passwordError(rule string) models.FieldError {
+	return models.FieldError{Field: "password", Rule: rule, Message: Message(rule)}
+}
+
+// loadBreached reads one password per line, ignoring blank lines. Passwords
+// are compared case-insensitively.
+func loadBreached(path string) (map[string]struct{}, error) {
+	if path == "" {
+		return nil, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open breached password list: %w", err)
+	}
+	defer f.Close()
+
+	breached := make(map[string]struct{})
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimRight(scanner.Text(), "\r"); line != "" {
+			breached[strings.ToLower(line)] = struct{}{}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read breached password list: %w", err)
+	}
+	return breached, nil
+}
@@ -0,0 +1,104 @@
+package validation
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go-restful-api/config"
+)
+
+// setupPolicy applies a policy for the test and restores the previous one after it
+func setupPolicy(t *testing.T, cfg config.PasswordConfig) {
+	t.Helper()
+	previous := policy
+	t.Cleanup(func() { policy = previous })
+	if err := Setup(cfg); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckPassword(t *testing.T) {
+	list := filepath.Join(t.TempDir(), "breached.txt")
+	if err := os.WriteFile(list, []byte("Password123\r\n\nletmein!\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	setupPolicy(t, config.PasswordConfig{MinLength: 8, MaxLength: 16, BreachedList: list})
+
+	tests := []struct {
+		name     string
+		password string
+		email    string
+		want     []string
+	}{
+		{"valid", "correct horse", "ann@example.com", nil},
+		{"too short", "short", "ann@example.com", []string{RulePasswordLength}},
+		{"minimum counts characters", "ääääääää", "ann@example.com", nil},
+		{"maximum counts bytes", "äääääääää", "ann@example.com", []string{RulePasswordLength}},
+		{"breached in another case", "PASSWORD123", "ann@example.com", []string{RuleBreachedPassword}},
+		{"the email address", " Ann@Ex.com ", "ann@ex.com", []string{RuleNotEmail}},
+		{"every broken rule", "letmein!", "letmein!", []string{RuleBreachedPassword, RuleNotEmail}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckPassword(tt.password, tt.email)
+			if tt.want == nil {
+				if err != nil {
+					t.Errorf("CheckPassword() error = %v, want nil", err)
+				}
+				return
+			}
+
+			var invalid *Error
+			if !errors.As(err, &invalid) {
+				t.Fatalf("CheckPassword() error = %v, want an *Error", err)
+			}
+			if len(invalid.Fields) != len(tt.want) {
+				t.Fatalf("fields = %+v, want rules %v", invalid.Fields, tt.want)
+			}
+			for i, field := range invalid.Fields {
+				if field.Field != "password" || field.Rule != tt.want[i] || field.Message == "" {
+					t.Errorf("field %d = %+v, want a password %s error with a message", i, field, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSetupMissingBreachedList(t *testing.T) {
+	previous := policy
+	t.Cleanup(func() { policy = previous })
+
+	cfg := config.PasswordConfig{MinLength: 8, MaxLength: 72, BreachedList: filepath.Join(t.TempDir(), "missing.txt")}
+	if err := Setup(cfg); err == nil {
+		t.Error("Setup() with a missing list succeeded")
+	}
+}
+
+func TestIsPersonName(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"Ann", true},
+		{"Mary-Jane O'Neil", true},
+		{"J. R. R. Tolkien", true},
+		{"D’Angelo", true},
+		{"Zoë Saldaña", true},
+		{"José", true},
+		{"李小龙", true},
+		{"", false},
+		{"-.'", false},
+		{"Ann2", false},
+		{"<script>", false},
+		{"Ann\tSmith", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsPersonName(tt.name); got != tt.want {
+				t.Errorf("IsPersonName(%q) = %v, want %v", tt.name, got, tt.want)
+			}
+		})
+	}
+}